@@ -0,0 +1,126 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "fmt"
+
+// CanAcquire reports whether the Mutex could be taken in the given mode right
+// now without blocking.  The answer may be out of date by the time the caller
+// acts on it, so it's only useful for assertions and diagnostics.
+func (m *Mutex) CanAcquire(mode LockMode) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.canAcquire(mode, m.load())
+}
+
+// WouldBlock is the opposite of CanAcquire: it reports whether taking the
+// Mutex in the given mode right now would block, e.g. for monitoring how
+// often traversals run into contention.
+func (m *Mutex) WouldBlock(mode LockMode) bool {
+	return !m.CanAcquire(mode)
+}
+
+// WouldBlockAll is like calling WouldBlock for each of the given modes, but
+// all against the same lock state.
+func (m *Mutex) WouldBlockAll(modes []LockMode) []bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	state := m.load()
+	ret := make([]bool, len(modes))
+	for i, mode := range modes {
+		ret[i] = !m.canAcquire(mode, state)
+	}
+	return ret
+}
+
+// canAcquire is CanAcquire against the given state, with m.mtx held.
+func (m *Mutex) canAcquire(mode LockMode, state uint64) bool {
+	return m.admits(mode) && m.compatible(mode, state) && m.underLimit(mode, state)
+}
+
+// AssertCompatible panics if any two of the given modes can't be held at the
+// same time, naming the first such pair.  It's meant for code that builds
+// lock paths or protocols to check its choice of modes at startup.
+//
+// Like the other Assert functions, it does nothing in ilock_noassert builds.
+func AssertCompatible(modes ...LockMode) {
+	if !assertionsEnabled {
+		return
+	}
+	for i := range modes {
+		for j := i + 1; j < len(modes); j++ {
+			if !Compatible(modes[i], modes[j]) {
+				panic(fmt.Sprintf("ilock: modes %v (#%d) and %v (#%d) are incompatible",
+					modes[i], i, modes[j], j))
+			}
+		}
+	}
+}
+
+// AssertLockable panics if m can't be taken in the given mode without
+// blocking, as reported by CanAcquire.
+func AssertLockable(m *Mutex, mode LockMode) {
+	if !assertionsEnabled {
+		return
+	}
+	if !m.CanAcquire(mode) {
+		panic(fmt.Sprintf("ilock: mutex %d: %s", m.ID(), m.Explain(mode)))
+	}
+}
+
+// AssertMode panics unless the calling goroutine holds m in the given mode.
+// Put at the top of a function, it both documents and enforces the lock
+// the caller is expected to hold:
+//
+//	// bump increments the counter; the caller must hold c.mtx in X.
+//	func (c *counter) bump() {
+//		c.mtx.AssertMode(ilock.ModeX)
+//		c.n++
+//	}
+//
+// Telling which goroutine holds a lock takes the goroutine tracking of
+// ilock_goroutineid builds (see XHolderIDs).  Otherwise, AssertMode can
+// only check that someone holds m in mode.  Like the other Assert
+// functions, it does nothing in ilock_noassert builds.
+func (m *Mutex) AssertMode(mode LockMode) {
+	if !assertionsEnabled {
+		return
+	}
+	if !mode.valid() {
+		panic(ErrInvalidMode)
+	}
+	id := goroutineID()
+	if id < 0 {
+		if extractMode(mode, m.load()) == 0 {
+			panic(fmt.Sprintf("ilock: mutex %d is not held in %v", m.ID(), mode))
+		}
+		return
+	}
+	for _, holder := range m.owners.holders(mode) {
+		if holder == id {
+			return
+		}
+	}
+	if m.owners.claim(mode) {
+		return
+	}
+	panic(fmt.Sprintf("ilock: mutex %d is not held in %v by goroutine %d", m.ID(), mode, id))
+}
@@ -0,0 +1,106 @@
+package ilock
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanAcquire(t *testing.T) {
+	m := New(WithMaxHolders(0, 1, 0, 0))
+	for _, mode := range modes {
+		assert.True(t, m.CanAcquire(mode), "%v", mode)
+	}
+
+	m.SLock()
+	assert.True(t, m.CanAcquire(ModeIS))
+	assert.False(t, m.CanAcquire(ModeS), "S is at its holder limit")
+	assert.False(t, m.CanAcquire(ModeIX))
+	assert.False(t, m.CanAcquire(ModeX))
+	assert.Equal(t, setS(0, 1), m.load(), "CanAcquire modified the lock state")
+}
+
+func TestAssertCompatible(t *testing.T) {
+	if !assertionsEnabled {
+		t.Skip("assertions are disabled in ilock_noassert builds")
+	}
+	assert.NotPanics(t, func() { AssertCompatible() })
+	assert.NotPanics(t, func() { AssertCompatible(ModeIS, ModeIX, ModeIX) })
+	assert.NotPanics(t, func() { AssertCompatible(ModeS, ModeIS, ModeS) })
+	assert.PanicsWithValue(t, "ilock: modes IS (#0) and X (#2) are incompatible", func() {
+		AssertCompatible(ModeIS, ModeIS, ModeX)
+	})
+	assert.PanicsWithValue(t, "ilock: modes S (#1) and IX (#2) are incompatible", func() {
+		AssertCompatible(ModeIS, ModeS, ModeIX)
+	})
+}
+
+func TestAssertLockable(t *testing.T) {
+	if !assertionsEnabled {
+		t.Skip("assertions are disabled in ilock_noassert builds")
+	}
+	m := New()
+	assert.NotPanics(t, func() { AssertLockable(m, ModeX) })
+
+	m.IXLock()
+	assert.NotPanics(t, func() { AssertLockable(m, ModeIS) })
+	assert.Panics(t, func() { AssertLockable(m, ModeS) })
+}
+
+func TestWouldBlock(t *testing.T) {
+	m := New()
+	m.IXLock()
+	assert.False(t, m.WouldBlock(ModeIS))
+	assert.False(t, m.WouldBlock(ModeIX))
+	assert.True(t, m.WouldBlock(ModeS))
+	assert.True(t, m.WouldBlock(ModeX))
+
+	assert.Equal(t, []bool{true, true, false, false}, m.WouldBlockAll(modes[:]))
+	assert.Equal(t, []bool{}, m.WouldBlockAll(nil))
+}
+
+func TestAssertMode(t *testing.T) {
+	if !assertionsEnabled {
+		t.Skip("assertions are disabled in ilock_noassert builds")
+	}
+	m := New()
+	assert.Panics(t, func() { m.AssertMode(ModeX) })
+
+	m.XLock()
+	assert.NotPanics(t, func() { m.AssertMode(ModeX) })
+	assert.Panics(t, func() { m.AssertMode(ModeS) })
+	assert.PanicsWithValue(t, ErrInvalidMode, func() { m.AssertMode(LockMode(42)) })
+}
+
+// account is guarded by an ilock.Mutex, and its helpers check that their
+// callers hold it.
+type account struct {
+	mtx     *Mutex
+	balance int
+}
+
+// deposit adds to the balance; the caller must hold a.mtx in X.
+func (a *account) deposit(n int) {
+	a.mtx.AssertMode(ModeX)
+	a.balance += n
+}
+
+// peek returns the balance; the caller must hold a.mtx in S.
+func (a *account) peek() int {
+	a.mtx.AssertMode(ModeS)
+	return a.balance
+}
+
+func ExampleMutex_AssertMode() {
+	a := &account{mtx: New()}
+
+	a.mtx.XLock()
+	a.deposit(10)
+	a.mtx.XUnlock()
+
+	a.mtx.SLock()
+	fmt.Println(a.peek())
+	a.mtx.SUnlock()
+	// Output: 10
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAdmissionRefused is returned, wrapped in a *BatchError, by Batch when
+// the Mutex is holding new acquisitions in a mode back in favour of
+// goroutines that are already waiting: writers (see
+// WithAntiStarvationThreshold), a grace period (see WithGracePeriod), or a
+// pending upgrade.
+var ErrAdmissionRefused = errors.New("ilock: acquisition held back for waiting goroutines")
+
+// LockOp is one step of a Batch: taking the Mutex in Mode if Acquire is
+// set, or releasing one hold in Mode otherwise.
+type LockOp struct {
+	Mode    LockMode
+	Acquire bool
+}
+
+func (op LockOp) String() string {
+	if op.Acquire {
+		return fmt.Sprintf("%sLock", op.Mode)
+	}
+	return fmt.Sprintf("%sUnlock", op.Mode)
+}
+
+// BatchError is returned by Batch when one of its steps couldn't be applied.
+// None of the batch has taken effect by the time the caller sees it.
+type BatchError struct {
+	Index int    // The index of the failing step
+	Op    LockOp // The failing step
+	Err   error  // Why it failed
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("ilock: batch step %d (%s): %v", e.Index, e.Op, e.Err)
+}
+
+// Unwrap returns the reason the step failed.
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// Batch applies a sequence of acquisitions and releases to the Mutex as a
+// single atomic change of the lock state, so that no other goroutine ever
+// sees the intermediate states: releasing IS and acquiring IX in one batch,
+// say, can't lose out to a writer in between.  Each acquisition is checked
+// against the state the steps before it have left, the way SwitchMode
+// checks its upgrade, and is subject to the same admission policies as
+// TryLock; like both of them, Batch never blocks.  An X hold taken in a
+// batch can't be released by a later step of the same batch.
+//
+// If any step fails, none of them are applied, and Batch returns a
+// *BatchError naming it, which wraps ErrIncompatibleUpgrade if the Mutex
+// couldn't be taken in that step's mode, ErrHolderLimitExceeded if only the
+// limit set by WithMaxHolders was in the way, ErrAdmissionRefused or
+// ErrShutdown if the Mutex refused to admit it, a *LockUnderflowError if
+// there was no hold to release, or ErrInvalidMode.
+//
+// Once the batch has been applied, the Mutex's policy, history and other
+// hooks hear about its steps in order.
+func (m *Mutex) Batch(ops []LockOp) error {
+	for i, op := range ops {
+		if !op.Mode.valid() {
+			return &BatchError{Index: i, Op: op, Err: ErrInvalidMode}
+		}
+		if op.Acquire {
+			if err := m.beforeAcquire(op.Mode); err != nil {
+				return &BatchError{Index: i, Op: op, Err: err}
+			}
+		} else if m.policy != nil {
+			m.policy.BeforeRelease(m, op.Mode)
+		}
+	}
+
+	m.mtx.Lock()
+	err := m.tryBatch(ops)
+	m.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, op := range ops {
+		if op.Acquire {
+			m.acquired(op.Mode, 0)
+		} else {
+			m.released(op.Mode)
+		}
+	}
+	return nil
+}
+
+// tryBatch is the body of Batch, and must be called with m.mtx held.  On
+// success, the caller has to follow up with acquired and released for each
+// step once it has unlocked m.mtx.
+func (m *Mutex) tryBatch(ops []LockOp) error {
+	for i, op := range ops {
+		if !op.Acquire {
+			continue
+		}
+		switch {
+		case m.isShutdown():
+			return &BatchError{Index: i, Op: op, Err: ErrShutdown}
+		case !m.admits(op.Mode):
+			return &BatchError{Index: i, Op: op, Err: ErrAdmissionRefused}
+		}
+	}
+
+	var state, next uint64
+	for {
+		state = m.load()
+		next = state
+		var xTaken uint64 // X holds taken by the batch so far
+		for i, op := range ops {
+			curr := extractMode(op.Mode, next)
+			if !op.Acquire {
+				if curr == 0 || (op.Mode == ModeX && curr == xTaken) {
+					return &BatchError{Index: i, Op: op, Err: &LockUnderflowError{Mode: op.Mode}}
+				}
+				next = setMode(op.Mode, next, curr-1)
+				continue
+			}
+			if !m.compatible(op.Mode, next) {
+				return &BatchError{Index: i, Op: op, Err: ErrIncompatibleUpgrade}
+			}
+			if !m.underLimit(op.Mode, next) {
+				return &BatchError{Index: i, Op: op, Err: ErrHolderLimitExceeded}
+			}
+			if op.Mode == ModeX {
+				xTaken++
+			}
+			next = setMode(op.Mode, next, curr+1)
+		}
+		if m.cas(state, next) {
+			break
+		}
+	}
+
+	// Only the net change is visible to anyone else, so that's all that
+	// the transition hooks hear about.
+	for _, mode := range modes {
+		if extractMode(mode, state) > 0 && extractMode(mode, next) == 0 {
+			m.zeroed(mode)
+		}
+	}
+	for _, mode := range modes {
+		if extractMode(mode, state) == 0 && extractMode(mode, next) > 0 {
+			m.activated(mode, next)
+		}
+	}
+
+	before := state
+	for _, op := range ops {
+		after := setMode(op.Mode, before, extractMode(op.Mode, before)+1)
+		if !op.Acquire {
+			after = setMode(op.Mode, before, extractMode(op.Mode, before)-1)
+		}
+		m.observe(op.Mode, op.Acquire, before, after)
+		before = after
+
+		switch {
+		case op.Acquire && op.Mode == ModeS:
+			m.sGrants++
+		case !op.Acquire && op.Mode == ModeX:
+			// As in unlock, this has to be done before anyone else can
+			// take X; the X holds the batch takes are begun by acquired.
+			m.xTrace.clear()
+			m.xBudget.stop()
+			m.endWrite()
+		}
+	}
+
+	m.broadcast()
+	return nil
+}
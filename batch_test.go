@@ -0,0 +1,118 @@
+package ilock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	m := New()
+	assert.NoError(t, m.Batch([]LockOp{
+		{Mode: ModeIS, Acquire: true},
+		{Mode: ModeIX, Acquire: true},
+		{Mode: ModeIS, Acquire: false},
+	}))
+	assert.Equal(t, setIX(0, 1), m.load())
+
+	// Later steps are checked against the state the earlier ones left, so
+	// our own IX hold can be traded for X in one go.
+	assert.NoError(t, m.Batch([]LockOp{
+		{Mode: ModeIX, Acquire: false},
+		{Mode: ModeX, Acquire: true},
+	}))
+	assert.Equal(t, setX(0, 1), m.load())
+	assert.Equal(t, uint64(1), m.SeqRead()&1, "X taken in a batch should begin a write")
+
+	assert.NoError(t, m.Batch([]LockOp{{Mode: ModeX, Acquire: false}}))
+	assert.Equal(t, uint64(0), m.load())
+	assert.Equal(t, uint64(0), m.SeqRead()&1, "X released in a batch should end the write")
+
+	assert.NoError(t, m.Batch(nil))
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestBatchRollback(t *testing.T) {
+	m := New()
+	m.SLock()
+
+	ops := []LockOp{
+		{Mode: ModeIS, Acquire: true},
+		{Mode: ModeIX, Acquire: true},
+	}
+	err := m.Batch(ops)
+	var be *BatchError
+	if assert.True(t, errors.As(err, &be)) {
+		assert.Equal(t, 1, be.Index)
+		assert.Equal(t, ops[1], be.Op)
+	}
+	assert.True(t, errors.Is(err, ErrIncompatibleUpgrade))
+	assert.Equal(t, "ilock: batch step 1 (IXLock): ilock: mode switch incompatible with current lock state", err.Error())
+	assert.Equal(t, setS(0, 1), m.load(), "Failed batch modified the lock state")
+
+	err = m.Batch([]LockOp{
+		{Mode: ModeS, Acquire: false},
+		{Mode: ModeS, Acquire: false},
+	})
+	var ue *LockUnderflowError
+	assert.True(t, errors.As(err, &ue))
+	assert.Equal(t, setS(0, 1), m.load(), "Failed batch modified the lock state")
+
+	assert.True(t, errors.Is(m.Batch([]LockOp{{Mode: LockMode(42)}}), ErrInvalidMode))
+
+	m = New(WithMaxHolders(0, 0, 0, 1))
+	err = m.Batch([]LockOp{
+		{Mode: ModeIS, Acquire: true},
+		{Mode: ModeIS, Acquire: true},
+	})
+	assert.True(t, errors.Is(err, ErrHolderLimitExceeded))
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestBatchHistory(t *testing.T) {
+	m := New(WithHistory(8))
+	m.ISLock()
+	assert.NoError(t, m.Batch([]LockOp{
+		{Mode: ModeIS, Acquire: false},
+		{Mode: ModeIX, Acquire: true},
+	}))
+	assert.Equal(t, []event{
+		{ModeIS, EventAcquired},
+		{ModeIS, EventReleased},
+		{ModeIX, EventAcquired},
+	}, historyOf(m))
+}
+
+func TestBatchAdmission(t *testing.T) {
+	m := New()
+	m.ISLock()
+	m.IXLock()
+	done := m.RequestUpgrade(ModeIS, ModeS)
+
+	// The pending upgrade to S holds back new IX holders, even in a batch.
+	err := m.Batch([]LockOp{{Mode: ModeIX, Acquire: true}})
+	assert.True(t, errors.Is(err, ErrAdmissionRefused))
+	assert.Equal(t, setIS(setIX(0, 1), 1), m.load())
+
+	m.IXUnlockMust()
+	assert.NoError(t, <-done)
+	assert.NoError(t, m.SUnlock())
+
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+	err = m.Batch([]LockOp{{Mode: ModeIS, Acquire: true}})
+	assert.True(t, errors.Is(err, ErrShutdown))
+}
+
+func TestBatchXReleaseOwnHold(t *testing.T) {
+	m := New()
+	err := m.Batch([]LockOp{
+		{Mode: ModeX, Acquire: true},
+		{Mode: ModeX, Acquire: false},
+	})
+	var ue *LockUnderflowError
+	assert.True(t, errors.As(err, &ue))
+	assert.Equal(t, uint64(0), m.load())
+	assert.Equal(t, uint64(0), m.SeqRead())
+}
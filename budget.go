@@ -0,0 +1,110 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// xHoldBudget times X holds for WithXHoldBudget.
+type xHoldBudget struct {
+	budget  time.Duration
+	handler func(m *Mutex, held time.Duration)
+
+	mtx   sync.Mutex
+	timer *time.Timer // For the current X hold, if any
+}
+
+// WithXHoldBudget calls handler if the Mutex is held in X for longer than
+// budget, to catch leaked or runaway write locks in production.  The
+// handler is called at most once per X hold, on its own goroutine, while
+// the lock is still held, with how long it has been held so far; it must
+// not take or release the Mutex itself.  Releasing X, whether by unlocking,
+// switching mode or ForceUnlock, cancels the timer.
+func WithXHoldBudget(budget time.Duration, handler func(m *Mutex, held time.Duration)) Option {
+	return func(m *Mutex) {
+		m.xBudget = &xHoldBudget{budget: budget, handler: handler}
+	}
+}
+
+// start starts timing an X hold on m that began at the given time.
+func (b *xHoldBudget) start(m *Mutex, at time.Time) {
+	if b == nil {
+		return
+	}
+	// A timer only ever fires once, and stop can't undo a firing that's
+	// already begun, so the handler is called at most once.
+	t := time.AfterFunc(b.budget, func() {
+		b.handler(m, time.Since(at))
+	})
+
+	b.mtx.Lock()
+	b.timer = t
+	b.mtx.Unlock()
+}
+
+// stop stops timing the current X hold.
+func (b *xHoldBudget) stop() {
+	if b == nil {
+		return
+	}
+	b.mtx.Lock()
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mtx.Unlock()
+}
+
+// WithBudget runs f with the Mutex held in the given mode, giving it a
+// context that expires holdBudget after the lock was taken, and releases
+// the lock afterwards.  f should give up once the context is done, to keep
+// the critical section within budget.  If it overruns anyway, a warning is
+// logged, but the lock is released as usual.  Returns ctx.Err() without
+// running f if ctx is done before the lock could be taken, or the error
+// from releasing it.
+func (m *Mutex) WithBudget(ctx context.Context, mode LockMode, holdBudget time.Duration, f func(context.Context)) (err error) {
+	if !mode.valid() {
+		return ErrInvalidMode
+	}
+	if err := m.acquire(ctx, mode); err != nil {
+		return err
+	}
+	start := time.Now()
+	defer func() {
+		if held := time.Since(start); held > holdBudget {
+			m.logOverBudget(mode, held, holdBudget)
+		}
+		err = m.unlock(mode)
+	}()
+
+	bctx, cancel := context.WithTimeout(ctx, holdBudget)
+	defer cancel()
+	f(bctx)
+	return nil
+}
+
+func (m *Mutex) logOverBudget(mode LockMode, held, budget time.Duration) {
+	log.Printf("ilock: WARNING: Mutex %s held in %s for %v, over its budget of %v", m.logName(), mode, held, budget)
+}
@@ -0,0 +1,75 @@
+package ilock
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXHoldBudget(t *testing.T) {
+	overruns := make(chan time.Duration, 2)
+	m := New(WithXHoldBudget(10*time.Millisecond, func(fired *Mutex, held time.Duration) {
+		assert.NotNil(t, fired)
+		overruns <- held
+	}))
+
+	m.XLock()
+	select {
+	case held := <-overruns:
+		assert.True(t, held >= 10*time.Millisecond, "Handler called after only %v", held)
+	case <-time.After(time.Second):
+		t.Fatal("Handler not called for an X hold over budget")
+	}
+	assert.NoError(t, m.XUnlock())
+
+	// Holds within budget don't trip it, whichever way they end.
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+	m.XLock()
+	m.ForceUnlock(ModeX)
+	m.XLock()
+	assert.NoError(t, m.SwitchMode(ModeX, ModeS))
+	select {
+	case held := <-overruns:
+		t.Fatalf("Handler called for a hold that ended in time (%v)", held)
+	case <-time.After(30 * time.Millisecond):
+	}
+	assert.Len(t, overruns, 0, "Handler called more than once for a single hold")
+}
+
+func TestWithBudget(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	m := New(WithName("with-budget-test"))
+	defer DefaultRegistry().Unregister(m)
+
+	assert.NoError(t, m.WithBudget(context.Background(), ModeS, time.Minute, func(ctx context.Context) {
+		assert.Equal(t, setS(0, 1), m.load())
+		_, ok := ctx.Deadline()
+		assert.True(t, ok, "f's context has no deadline")
+	}))
+	assert.Equal(t, uint64(0), m.load())
+	assert.Empty(t, logged.String())
+
+	// f overruns, ignoring its context; the lock is released regardless.
+	assert.NoError(t, m.WithBudget(context.Background(), ModeX, time.Millisecond, func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(time.Millisecond)
+	}))
+	assert.Equal(t, uint64(0), m.load())
+	assert.Contains(t, logged.String(), "Mutex with-budget-test held in X for")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.XLock()
+	assert.Equal(t, context.Canceled, m.WithBudget(ctx, ModeS, time.Minute, func(context.Context) {
+		t.Error("f run without the lock")
+	}))
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// eventBusBuffer is the channel buffer size for each EventBus subscriber.
+const eventBusBuffer = 64
+
+// EventBus fans LockEvents out from any number of Mutexes, created with
+// WithEventBus, to any number of subscribers, e.g. for a process-wide lock
+// monitor.  An EventBus is safe for concurrent use.
+//
+// Publishing never blocks: a subscriber that doesn't keep up with its
+// channel misses events.  With no subscribers, publishing costs a single
+// atomic load.
+type EventBus struct {
+	mtx         sync.RWMutex
+	subscribers map[<-chan LockEvent]*subscriber
+	count       int32 // len(subscribers), for publishers to check atomically
+}
+
+type subscriber struct {
+	c      chan LockEvent
+	filter func(LockEvent) bool
+}
+
+var defaultBus = NewEventBus()
+
+// NewEventBus returns an EventBus with no subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: make(map[<-chan LockEvent]*subscriber)}
+}
+
+// DefaultBus returns a process-wide EventBus.
+func DefaultBus() *EventBus {
+	return defaultBus
+}
+
+// WithEventBus has the Mutex publish every LockEvent to bus.
+func WithEventBus(bus *EventBus) Option {
+	return func(m *Mutex) {
+		m.bus = bus
+	}
+}
+
+// Subscribe returns a channel that receives every event published to the
+// bus for which filter returns true, or every event if filter is nil.
+// filter is called on the publishing goroutine, so it should be quick, and
+// must not call any methods on a Mutex.
+func (b *EventBus) Subscribe(filter func(LockEvent) bool) <-chan LockEvent {
+	s := &subscriber{c: make(chan LockEvent, eventBusBuffer), filter: filter}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	b.subscribers[s.c] = s
+	atomic.AddInt32(&b.count, 1)
+	return s.c
+}
+
+// Unsubscribe stops sending events to a channel returned by Subscribe, and
+// closes it.
+func (b *EventBus) Unsubscribe(c <-chan LockEvent) {
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+	if s, ok := b.subscribers[c]; ok {
+		delete(b.subscribers, c)
+		atomic.AddInt32(&b.count, -1)
+		close(s.c)
+	}
+}
+
+func (b *EventBus) publish(e LockEvent) {
+	if atomic.LoadInt32(&b.count) == 0 {
+		return
+	}
+	b.mtx.RLock()
+	defer b.mtx.RUnlock()
+	for _, s := range b.subscribers {
+		if s.filter != nil && !s.filter(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+		}
+	}
+}
+
+// publish sends e to the Mutex's event bus, if it has one.
+func (m *Mutex) publish(e LockEvent) {
+	if m.bus != nil {
+		m.bus.publish(e)
+	}
+}
@@ -0,0 +1,68 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	a := New(WithEventBus(bus))
+	b := New(WithEventBus(bus))
+
+	all := bus.Subscribe(nil)
+	onlyB := bus.Subscribe(func(e LockEvent) bool { return e.Mutex == b })
+
+	a.XLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Error(t, a.SLockCtx(ctx))
+	assert.NoError(t, a.XUnlock())
+	b.ISLock()
+
+	expected := []struct {
+		m    *Mutex
+		mode LockMode
+		kind EventKind
+	}{
+		{a, ModeX, EventAcquired},
+		{a, ModeS, EventBlocked},
+		{a, ModeS, EventTimedOut},
+		{a, ModeX, EventReleased},
+		{b, ModeIS, EventAcquired},
+	}
+	for _, want := range expected {
+		e := <-all
+		assert.Equal(t, want.m, e.Mutex)
+		assert.Equal(t, want.mode, e.Mode)
+		assert.Equal(t, want.kind, e.Kind)
+		if e.Kind == EventTimedOut {
+			assert.True(t, e.Duration >= 5*time.Millisecond)
+		}
+	}
+
+	e := <-onlyB
+	assert.Equal(t, b, e.Mutex)
+	assert.Equal(t, EventAcquired, e.Kind)
+
+	bus.Unsubscribe(all)
+	bus.Unsubscribe(onlyB)
+	_, open := <-all
+	assert.False(t, open, "Unsubscribed channel not closed")
+	b.ISLock()
+	_, open = <-onlyB
+	assert.False(t, open)
+}
+
+func TestEventBusDropsWhenFull(t *testing.T) {
+	bus := NewEventBus()
+	m := New(WithEventBus(bus))
+	c := bus.Subscribe(nil)
+	for i := 0; i < 2*eventBusBuffer; i++ {
+		m.ISLock()
+	}
+	assert.Equal(t, eventBusBuffer, len(c))
+}
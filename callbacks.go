@@ -0,0 +1,119 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "sync/atomic"
+
+// unlockCallback is a callback registered by OnSUnlock et al., or a
+// deferred policy hook queued by LockChan.grant.  It's referred to by
+// pointer so that it can be deregistered.
+type unlockCallback struct {
+	f func()
+}
+
+// OnSUnlock registers cb to be called, once, the next time the number of
+// goroutines holding the Mutex in S drops to zero, e.g. to hear when the
+// last reader of a node that is being restructured has finished.  If the
+// Mutex isn't held in S when OnSUnlock is called, that will be at the end
+// of the next S hold.  The returned function deregisters cb, if it hasn't
+// been called already.
+//
+// Callbacks are called in the order they were registered, by a goroutine
+// releasing the Mutex (normally the one whose release brought the count to
+// zero), after the Mutex's internal lock has been released.  They hold up
+// that goroutine, so mustn't block for long, but may take and release the
+// Mutex.
+func (m *Mutex) OnSUnlock(cb func()) func() {
+	return m.onUnlock(ModeS, cb)
+}
+
+// OnXUnlock is like OnSUnlock, for X.
+func (m *Mutex) OnXUnlock(cb func()) func() {
+	return m.onUnlock(ModeX, cb)
+}
+
+// OnISUnlock is like OnSUnlock, for IS.
+func (m *Mutex) OnISUnlock(cb func()) func() {
+	return m.onUnlock(ModeIS, cb)
+}
+
+// OnIXUnlock is like OnSUnlock, for IX.
+func (m *Mutex) OnIXUnlock(cb func()) func() {
+	return m.onUnlock(ModeIX, cb)
+}
+
+func (m *Mutex) onUnlock(mode LockMode, cb func()) func() {
+	c := &unlockCallback{f: cb}
+	m.mtx.Lock()
+	m.onUnlocks[mode] = append(m.onUnlocks[mode], c)
+	m.mtx.Unlock()
+
+	return func() {
+		m.mtx.Lock()
+		m.onUnlocks[mode] = removeCallback(m.onUnlocks[mode], c)
+		m.dueCallbacks = removeCallback(m.dueCallbacks, c)
+		m.mtx.Unlock()
+	}
+}
+
+func removeCallback(cbs []*unlockCallback, c *unlockCallback) []*unlockCallback {
+	for i, cb := range cbs {
+		if cb == c {
+			return append(cbs[:i], cbs[i+1:]...)
+		}
+	}
+	return cbs
+}
+
+// zeroed is called, with m.mtx held, whenever the number of holders in the
+// given mode drops to zero.  As well as noting that for OnTransition and
+// WithGracePeriod, it makes the callbacks waiting for it due, to be called
+// by runDueCallbacks once m.mtx has been released.
+func (m *Mutex) zeroed(mode LockMode) {
+	m.transitions.drained(mode)
+	if mode == ModeS {
+		m.startGracePeriod()
+	}
+	if len(m.onUnlocks[mode]) == 0 {
+		return
+	}
+	m.dueCallbacks = append(m.dueCallbacks, m.onUnlocks[mode]...)
+	m.onUnlocks[mode] = nil
+	atomic.StoreInt32(&m.callbacksDue, 1)
+}
+
+// runDueCallbacks calls any callbacks made due by zeroed or LockChan.grant.
+// It must be called without m.mtx held after every release, and costs an
+// atomic load if there are none.
+func (m *Mutex) runDueCallbacks() {
+	if atomic.LoadInt32(&m.callbacksDue) == 0 {
+		return
+	}
+	m.mtx.Lock()
+	due := m.dueCallbacks
+	m.dueCallbacks = nil
+	atomic.StoreInt32(&m.callbacksDue, 0)
+	m.mtx.Unlock()
+
+	for _, c := range due {
+		c.f()
+	}
+}
@@ -0,0 +1,67 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnUnlock(t *testing.T) {
+	m := New()
+	var calls []string
+	m.SLock()
+	m.SLock()
+	m.OnSUnlock(func() { calls = append(calls, "first") })
+	m.OnSUnlock(func() { calls = append(calls, "second") })
+	m.OnXUnlock(func() { calls = append(calls, "x") })
+
+	assert.NoError(t, m.SUnlock())
+	assert.Empty(t, calls, "Callback called with an S holder left")
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	// Callbacks are one-shot.
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, []string{"first", "second"}, calls)
+
+	// The X callback was waiting for the next X hold to end.
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+	assert.Equal(t, []string{"first", "second", "x"}, calls)
+}
+
+func TestOnUnlockDeregister(t *testing.T) {
+	m := New()
+	called := false
+	m.IXLock()
+	deregister := m.OnIXUnlock(func() { called = true })
+	deregister()
+	assert.NoError(t, m.IXUnlock())
+	assert.False(t, called)
+
+	// Deregistering after the callback has been called is harmless.
+	m.ISLock()
+	deregister = m.OnISUnlock(func() { called = true })
+	assert.NoError(t, m.ISUnlock())
+	assert.True(t, called)
+	deregister()
+}
+
+func TestOnUnlockOtherReleases(t *testing.T) {
+	m := New()
+	calls := 0
+	m.OnSUnlock(func() { calls++ })
+	m.OnXUnlock(func() {
+		// Callbacks may use the Mutex.
+		m.ISLock()
+		m.ISUnlockMust()
+		calls++
+	})
+
+	m.SLock()
+	assert.NoError(t, m.SwitchMode(ModeS, ModeX))
+	assert.Equal(t, 1, calls, "Switching out of S didn't count as S being released")
+	m.ForceUnlock(ModeX)
+	assert.Equal(t, 2, calls, "ForceUnlock didn't count as X being released")
+}
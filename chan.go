@@ -0,0 +1,176 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "sync/atomic"
+
+// LockChan is a pending acquisition of a Mutex that can be waited for in a
+// select statement, e.g.
+//
+//	lc := m.SLockChan()
+//	select {
+//	case <-lc.C:
+//		doRead()
+//		m.SUnlock()
+//	case <-ctx.Done():
+//		lc.Cancel()
+//		return ctx.Err()
+//	}
+//
+// Unlike the blocking lock methods, no goroutine sits waiting for the lock:
+// whoever releases the Mutex grants it to the LockChan directly.
+type LockChan struct {
+	// C is closed once the lock has been taken on the caller's behalf, or
+	// once the acquisition has been refused, in which case Err says why.
+	C <-chan struct{}
+
+	m       *Mutex
+	mode    LockMode
+	c       chan struct{}
+	granted bool  // Protected by m.mtx
+	err     error // Set before C is closed, if the acquisition was refused
+}
+
+// XLockChan starts taking the Mutex in X.
+func (m *Mutex) XLockChan() *LockChan {
+	return m.lockChan(ModeX)
+}
+
+// SLockChan starts taking the Mutex in S.
+func (m *Mutex) SLockChan() *LockChan {
+	return m.lockChan(ModeS)
+}
+
+// IXLockChan starts taking the Mutex in IX.
+func (m *Mutex) IXLockChan() *LockChan {
+	return m.lockChan(ModeIX)
+}
+
+// ISLockChan starts taking the Mutex in IS.
+func (m *Mutex) ISLockChan() *LockChan {
+	return m.lockChan(ModeIS)
+}
+
+func (m *Mutex) lockChan(mode LockMode) *LockChan {
+	c := make(chan struct{})
+	lc := &LockChan{C: c, m: m, mode: mode, c: c}
+	if err := m.beforeAcquire(mode); err != nil {
+		lc.err = err
+		close(c)
+		return lc
+	}
+
+	m.mtx.Lock()
+	if m.tryLock(mode) {
+		lc.grant()
+	} else {
+		m.chanWaiters = append(m.chanWaiters, lc)
+	}
+	m.mtx.Unlock()
+	m.runDueCallbacks()
+	return lc
+}
+
+// Err returns nil while the acquisition is pending and once the lock has
+// been granted, or the error that refused it, e.g. ErrShutdown or one from
+// the Mutex's LockPolicy.  It's only meaningful once C has been closed, and
+// must be checked before going on as though the lock were held if the
+// Mutex may refuse acquisitions.
+func (lc *LockChan) Err() error {
+	select {
+	case <-lc.c:
+		return lc.err
+	default:
+		return nil
+	}
+}
+
+// Cancel gives up on a pending acquisition.  If the lock had already been
+// granted, it is released again, and Cancel returns true.  Cancel must not
+// be called once the caller has received from C and so holds the lock.
+func (lc *LockChan) Cancel() bool {
+	m := lc.m
+	m.mtx.Lock()
+	if !lc.granted {
+		for i, w := range m.chanWaiters {
+			if w == lc {
+				m.chanWaiters = append(m.chanWaiters[:i], m.chanWaiters[i+1:]...)
+				break
+			}
+		}
+		m.mtx.Unlock()
+		return false
+	}
+	m.mtx.Unlock()
+
+	m.unlock(lc.mode)
+	return true
+}
+
+// grant marks the lock as taken on lc's behalf.  Called with m.mtx held,
+// usually by whoever released the Mutex, so the hold is left for the
+// goroutine that receives from C to claim, and the policy's AfterAcquire is
+// left to runDueCallbacks, as the policy mustn't be called with m.mtx held.
+func (lc *LockChan) grant() {
+	m := lc.m
+	lc.granted = true
+	m.granted(lc.mode, 0)
+	m.owners.transfer(lc.mode)
+	if p := m.policy; p != nil {
+		mode := lc.mode
+		m.dueCallbacks = append(m.dueCallbacks, &unlockCallback{f: func() {
+			p.AfterAcquire(m, mode, 0)
+		}})
+		atomic.StoreInt32(&m.callbacksDue, 1)
+	}
+	close(lc.c)
+}
+
+// broadcast is called, with m.mtx held, after a change to the lock state
+// that may let waiters proceed.  Channel waiters are granted the lock then
+// and there, in the order they arrived; everyone else is woken up to try for
+// themselves.
+func (m *Mutex) broadcast() {
+	m.checkQuiesced()
+	m.grantChanWaiters()
+	m.c.Broadcast()
+	m.wakeWaiters(allModes)
+}
+
+// grantChanWaiters grants the lock, with m.mtx held, to every channel waiter
+// that can now take it, in the order they arrived.
+func (m *Mutex) grantChanWaiters() {
+	if len(m.chanWaiters) == 0 {
+		return
+	}
+	waiting := m.chanWaiters[:0]
+	for _, lc := range m.chanWaiters {
+		if m.tryLock(lc.mode) {
+			lc.grant()
+		} else {
+			waiting = append(waiting, lc)
+		}
+	}
+	for i := len(waiting); i < len(m.chanWaiters); i++ {
+		m.chanWaiters[i] = nil
+	}
+	m.chanWaiters = waiting
+}
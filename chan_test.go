@@ -0,0 +1,81 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockChan(t *testing.T) {
+	m := New()
+
+	lc := m.XLockChan()
+	select {
+	case <-lc.C:
+	default:
+		t.Fatal("Uncontended LockChan wasn't granted immediately")
+	}
+	assert.NoError(t, lc.Err())
+
+	s1 := m.SLockChan()
+	s2 := m.SLockChan()
+	x := m.XLockChan()
+	select {
+	case <-s1.C:
+		t.Fatal("S granted while X held")
+	case <-x.C:
+		t.Fatal("X granted while X held")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	// Releasing X grants both S waiters at once; the X waiter has to wait
+	// for them.
+	assert.NoError(t, m.XUnlock())
+	<-s1.C
+	<-s2.C
+	assert.Equal(t, setS(0, 2), m.load())
+
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.SUnlock())
+	select {
+	case <-x.C:
+	case <-time.After(time.Second):
+		t.Fatal("X waiter never granted")
+	}
+	assert.NoError(t, m.XUnlock())
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestLockChanCancel(t *testing.T) {
+	m := New()
+	m.XLock()
+
+	// Cancelled before being granted, the waiter is forgotten...
+	lc := m.SLockChan()
+	assert.False(t, lc.Cancel())
+	assert.NoError(t, m.XUnlock())
+	assert.Equal(t, uint64(0), m.load())
+	assert.Empty(t, m.chanWaiters)
+
+	// ...and after, the lock is given back.
+	m.XLock()
+	lc = m.SLockChan()
+	assert.NoError(t, m.XUnlock())
+	assert.True(t, lc.Cancel())
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestLockChanShutdown(t *testing.T) {
+	m := New()
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+	lc := m.SLockChan()
+	select {
+	case <-lc.C:
+	default:
+		t.Fatal("Refused LockChan wasn't closed")
+	}
+	assert.Equal(t, ErrShutdown, lc.Err())
+	assert.Empty(t, m.chanWaiters)
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// Clone returns a new, unheld Mutex configured like m, e.g. for running
+// each test case against a fresh copy of a Mutex set up with production
+// options.  The clone is built from the options m was created with, along
+// with any holder limits set since, so it shares m's policies, hooks and
+// event bus, but gets statistics and history of its own.  If m has a name,
+// the clone is named after it with a "#clone" suffix, and registered with
+// the default registry under that name.
+//
+// Nothing about m's current holders or waiters carries over, and nor does a
+// StateStore set by WithStateStore, which would share them: the clone keeps
+// its state itself.
+func (m *Mutex) Clone() *Mutex {
+	name := m.Name()
+	opts := append(m.opts[:len(m.opts):len(m.opts)], func(c *Mutex) {
+		c.limits = m.limits
+		c.maxX = m.maxX
+		c.store = nil
+		c.name = ""
+		if name != "" {
+			c.name = name + "#clone"
+		}
+	})
+	return New(opts...)
+}
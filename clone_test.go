@@ -0,0 +1,43 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	m := New(WithName("clone-test"), WithStats(), WithHistory(4), WithMaxHolders(0, 2, 0, 0))
+	m.SetMaxXHolders(3)
+	m.SLock()
+	m.SLock()
+
+	c := m.Clone()
+	assert.NotEqual(t, m.ID(), c.ID())
+	assert.Equal(t, "clone-test#clone", c.Name())
+	reg := DefaultRegistry()
+	reg.mtx.Lock()
+	assert.Equal(t, "clone-test#clone", reg.mutexes[c])
+	assert.Equal(t, "clone-test", reg.mutexes[m])
+	reg.mtx.Unlock()
+	reg.Unregister(m)
+	reg.Unregister(c)
+
+	// Configuration carries over...
+	assert.Equal(t, m.limits, c.limits)
+	assert.Equal(t, uint16(3), c.maxX)
+	assert.NotNil(t, c.stats)
+	assert.NotNil(t, c.history)
+
+	// ...but state doesn't.
+	assert.Equal(t, uint64(0), c.load())
+	assert.Equal(t, uint64(0), c.Stats().Acquisitions[ModeS])
+	assert.Empty(t, c.History())
+	c.SLock()
+	c.SLock()
+	assert.False(t, c.TrySLock(), "Clone ignored the S holder limit")
+	assert.Equal(t, setS(0, 2), m.load(), "Clone shares state with the original")
+
+	// Clones of unnamed Mutexes stay unnamed.
+	assert.Equal(t, "", New().Clone().Name())
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+)
+
+// Finding is a single problem reported by Check.
+type Finding struct {
+	Pos     token.Position
+	Message string
+}
+
+func (f Finding) String() string {
+	return fmt.Sprintf("%v: %s", f.Pos, f.Message)
+}
+
+// lockCall is a call to one of the Mutex methods that Check looks at.
+type lockCall struct {
+	pos      token.Pos
+	method   string
+	mutex    string // The expression the method is called on
+	deferred bool
+}
+
+// lockMethods are the Mutex methods that Check looks at.
+var lockMethods = map[string]bool{
+	"XLock":   true,
+	"XUnlock": true,
+	"SLock":   true,
+	"SUnlock": true,
+	"ISLock":  true,
+}
+
+// Check reports the misuses of ilock.Mutex in the given file, in source
+// order.
+func Check(fset *token.FileSet, f *ast.File) []Finding {
+	var findings []Finding
+	ast.Inspect(f, func(n ast.Node) bool {
+		var body *ast.BlockStmt
+		switch fn := n.(type) {
+		case *ast.FuncDecl:
+			body = fn.Body
+		case *ast.FuncLit:
+			body = fn.Body
+		}
+		if body != nil {
+			for _, c := range checkFunc(lockCalls(body)) {
+				findings = append(findings, Finding{Pos: fset.Position(c.pos), Message: c.message})
+			}
+		}
+		return true
+	})
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Pos.Offset < findings[j].Pos.Offset
+	})
+	return findings
+}
+
+type problem struct {
+	pos     token.Pos
+	message string
+}
+
+// lockCalls returns the calls to lockMethods in body, in source order,
+// leaving out those in nested function literals, which are checked
+// separately.
+func lockCalls(body *ast.BlockStmt) []lockCall {
+	var calls []lockCall
+	deferred := map[*ast.CallExpr]bool{}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			deferred[n.Call] = true
+		case *ast.CallExpr:
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok || len(n.Args) != 0 || !lockMethods[sel.Sel.Name] {
+				return true
+			}
+			calls = append(calls, lockCall{
+				pos:      n.Pos(),
+				method:   sel.Sel.Name,
+				mutex:    types.ExprString(sel.X),
+				deferred: deferred[n],
+			})
+		}
+		return true
+	})
+	return calls
+}
+
+// checkFunc checks the calls made by a single function.
+func checkFunc(calls []lockCall) []problem {
+	var problems []problem
+	for i, c := range calls {
+		switch c.method {
+		case "XLock":
+			if !callsAfter(calls, i, c.mutex, "XUnlock", true) {
+				problems = append(problems, problem{c.pos,
+					fmt.Sprintf("%s.XLock() has no matching %s.XUnlock() in the same function; missing defer?", c.mutex, c.mutex)})
+			}
+		case "SUnlock":
+			// A deferred SUnlock runs at the end of the function, so it's
+			// fine for it to appear before the SLock.
+			if !c.deferred && !callsBefore(calls, i, c.mutex, "SLock") {
+				problems = append(problems, problem{c.pos,
+					fmt.Sprintf("%s.SUnlock() called before %s.SLock(); the lock may underflow", c.mutex, c.mutex)})
+			}
+		case "ISLock":
+			if !callsAfter(calls, i, "", "SLock", false) && !callsAfter(calls, i, "", "XLock", false) {
+				problems = append(problems, problem{c.pos,
+					fmt.Sprintf("%s.ISLock() is not followed by an SLock() or XLock(); intention lock without a terminal lock", c.mutex)})
+			}
+		}
+	}
+	return problems
+}
+
+// callsAfter reports whether calls[i] is followed by a call to method, on
+// the given Mutex unless that's empty.  If anyDeferred is set, deferred
+// calls count wherever they are in the function.
+func callsAfter(calls []lockCall, i int, mutex, method string, anyDeferred bool) bool {
+	for j, c := range calls {
+		if (j > i || (anyDeferred && c.deferred)) && c.method == method && (mutex == "" || c.mutex == mutex) {
+			return true
+		}
+	}
+	return false
+}
+
+// callsBefore reports whether calls[i] is preceded by a call to method on
+// the given Mutex.
+func callsBefore(calls []lockCall, i int, mutex, method string) bool {
+	for _, c := range calls[:i] {
+		if c.method == method && c.mutex == mutex {
+			return true
+		}
+	}
+	return false
+}
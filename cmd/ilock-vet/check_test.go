@@ -0,0 +1,93 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func check(t *testing.T, src string) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "src.go", src, 0)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	var ret []string
+	for _, f := range Check(fset, f) {
+		ret = append(ret, f.String())
+	}
+	return ret
+}
+
+func TestCheckClean(t *testing.T) {
+	assert.Empty(t, check(t, `package p
+
+func deferred(m *ilock.Mutex) {
+	m.XLock()
+	defer m.XUnlock()
+}
+
+func explicit(m *ilock.Mutex) {
+	m.XLock()
+	m.XUnlock()
+	m.SLock()
+	m.SUnlock()
+}
+
+func path(parent, child *ilock.Mutex) {
+	parent.ISLock()
+	defer parent.ISUnlock()
+	child.SLock()
+	defer child.SUnlock()
+}
+
+func deferredFirst(m *ilock.Mutex) {
+	defer m.SUnlock()
+	m.SLock()
+}
+`))
+}
+
+func TestCheckMissingXUnlock(t *testing.T) {
+	assert.Equal(t, []string{
+		"src.go:4:2: m.XLock() has no matching m.XUnlock() in the same function; missing defer?",
+		"src.go:9:14: a.b.XLock() has no matching a.b.XUnlock() in the same function; missing defer?",
+	}, check(t, `package p
+
+func f(m, n *ilock.Mutex) {
+	m.XLock()
+	n.XUnlock()
+}
+
+func g() {
+	go func() { a.b.XLock() }()
+	a.b.XUnlock()
+}
+`))
+}
+
+func TestCheckSUnlockBeforeSLock(t *testing.T) {
+	assert.Equal(t, []string{
+		"src.go:4:2: m.SUnlock() called before m.SLock(); the lock may underflow",
+	}, check(t, `package p
+
+func f(m *ilock.Mutex) {
+	m.SUnlock()
+	m.SLock()
+}
+`))
+}
+
+func TestCheckISLockWithoutTerminal(t *testing.T) {
+	assert.Equal(t, []string{
+		"src.go:4:2: m.ISLock() is not followed by an SLock() or XLock(); intention lock without a terminal lock",
+	}, check(t, `package p
+
+func f(m *ilock.Mutex) {
+	m.ISLock()
+	m.ISUnlock()
+}
+`))
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Command ilock-vet reports likely misuses of ilock.Mutex in Go source,
+// catching at development time some of the bugs that the runtime checks
+// would otherwise only catch under test:
+//
+//   - XLock calls with no XUnlock, deferred or otherwise, on the same Mutex
+//     later in the same function;
+//   - SUnlock calls with no SLock on the same Mutex before them in the same
+//     function, which will underflow unless the caller took the lock;
+//   - ISLock calls with no SLock or XLock after them in the same function,
+//     i.e. intentions with no terminal lock further down the path.
+//
+// Usage:
+//
+//	ilock-vet [path ...]
+//
+// Each path is a Go source file or a directory; a directory ending in /...
+// is searched recursively.  The current directory is checked if no paths
+// are given.  Findings are printed one per line as file:line:col: message,
+// and the exit status is 1 if there were any.
+//
+// The analysis is purely syntactic: Mutexes are told apart by the text of
+// the expression the methods are called on, and every function literal is
+// checked on its own, so lock helpers that are meant to return with the
+// lock held will be reported too.
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	paths := os.Args[1:]
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	var files []string
+	for _, p := range paths {
+		found, err := sourceFiles(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ilock-vet: %v\n", err)
+			os.Exit(2)
+		}
+		files = append(files, found...)
+	}
+
+	fset := token.NewFileSet()
+	var findings []Finding
+	for _, name := range files {
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ilock-vet: %v\n", err)
+			os.Exit(2)
+		}
+		findings = append(findings, Check(fset, f)...)
+	}
+
+	for _, f := range findings {
+		fmt.Println(f)
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+}
+
+// sourceFiles returns the Go source files named by path, in lexical order.
+func sourceFiles(path string) ([]string, error) {
+	recursive := false
+	if strings.HasSuffix(path, "/...") {
+		path, recursive = strings.TrimSuffix(path, "/..."), true
+		if path == "" {
+			path = "/"
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.Walk(path, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != path && (!recursive || skipDir(info.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(p, ".go") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// skipDir reports whether a recursive search should leave out the directory
+// with the given name, following the go tool's rules.
+func skipDir(name string) bool {
+	return name == "testdata" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")
+}
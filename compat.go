@@ -0,0 +1,96 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "strings"
+
+// CompatibilityMatrix records which lock modes may be held at the same time:
+// cm[requested][held] is true if a Mutex held in mode held can also be taken
+// in mode requested.  Both indices are LockMode values.
+type CompatibilityMatrix [4][4]bool
+
+// Compatibility returns the transition matrix described in the package
+// documentation, as derived from the rules the Mutex actually enforces.
+func Compatibility() CompatibilityMatrix {
+	var cm CompatibilityMatrix
+	for _, requested := range modes {
+		for _, held := range modes {
+			cm[requested][held] = Compatible(requested, held)
+		}
+	}
+	return cm
+}
+
+// Compatible reports whether a Mutex held in mode held can also be taken in
+// mode requested without blocking.
+func Compatible(requested, held LockMode) bool {
+	return compatableWithMode(requested, setMode(held, 0, 1))
+}
+
+// The columns of the rendered matrix, and how each cell in them is padded.
+var compatColumns = [...]struct {
+	header, yes, no string
+}{
+	{"Unlocked", "   Yes    ", "   No     "},
+	{"Holding X", "    Yes    ", "    No     "},
+	{"Holding S", "    Yes    ", "    No     "},
+	{"Holding IX", "     Yes    ", "     No     "},
+	{"Holding IS", "     Yes    ", "     No     "},
+}
+
+// String renders cm as the ASCII table in the package documentation.
+func (cm CompatibilityMatrix) String() string {
+	var sb strings.Builder
+
+	rule := func() {
+		sb.WriteString("+---------------")
+		for _, col := range compatColumns {
+			sb.WriteString("+" + strings.Repeat("-", len(col.yes)))
+		}
+		sb.WriteString("+\n")
+	}
+	cell := func(col int, ok bool) {
+		if ok {
+			sb.WriteString(compatColumns[col].yes + "|")
+		} else {
+			sb.WriteString(compatColumns[col].no + "|")
+		}
+	}
+
+	rule()
+	sb.WriteString("|Request/Holding|")
+	for _, col := range compatColumns {
+		sb.WriteString(" " + col.header + strings.Repeat(" ", len(col.yes)-len(col.header)-1) + "|")
+	}
+	sb.WriteString("\n")
+	rule()
+	for _, requested := range modes {
+		sb.WriteString("|Request " + requested.String())
+		sb.WriteString(strings.Repeat(" ", 15-len("Request ")-len(requested.String())) + "|")
+		cell(0, true)
+		for i, held := range modes {
+			cell(i+1, cm[requested][held])
+		}
+		sb.WriteString("\n")
+	}
+	rule()
+	return sb.String()
+}
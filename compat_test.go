@@ -0,0 +1,38 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompatibilityMatrix(t *testing.T) {
+	cm := Compatibility()
+	assert.Equal(t, CompatibilityMatrix{
+		ModeX:  {ModeX: false, ModeS: false, ModeIX: false, ModeIS: false},
+		ModeS:  {ModeX: false, ModeS: true, ModeIX: false, ModeIS: true},
+		ModeIX: {ModeX: false, ModeS: false, ModeIX: true, ModeIS: true},
+		ModeIS: {ModeX: false, ModeS: true, ModeIX: true, ModeIS: true},
+	}, cm)
+
+	// Compatibility is symmetric.
+	for _, a := range modes {
+		for _, b := range modes {
+			assert.Equal(t, cm[a][b], cm[b][a], "%v/%v", a, b)
+		}
+	}
+}
+
+func TestCompatibilityMatrixString(t *testing.T) {
+	// This is the table from the package documentation.
+	expected := "" +
+		"+---------------+----------+-----------+-----------+------------+------------+\n" +
+		"|Request/Holding| Unlocked | Holding X | Holding S | Holding IX | Holding IS |\n" +
+		"+---------------+----------+-----------+-----------+------------+------------+\n" +
+		"|Request X      |   Yes    |    No     |    No     |     No     |     No     |\n" +
+		"|Request S      |   Yes    |    No     |    Yes    |     No     |     Yes    |\n" +
+		"|Request IX     |   Yes    |    No     |    No     |     Yes    |     Yes    |\n" +
+		"|Request IS     |   Yes    |    No     |    Yes    |     Yes    |     Yes    |\n" +
+		"+---------------+----------+-----------+-----------+------------+------------+\n"
+	assert.Equal(t, expected, Compatibility().String())
+}
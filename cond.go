@@ -0,0 +1,103 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "sync"
+
+// Goroutines blocked in lock wait on a condvar per mode, so that a release
+// only has to wake the modes it may have let in: the last S holder leaving
+// needn't wake S or IS waiters, say, which were never blocked on it, only
+// for them to go straight back to sleep.  Everyone else, i.e. watchers and
+// upgrades, waits on m.c, which is woken by every broadcast.
+
+// condFor returns the condvar that goroutines waiting to take the lock in
+// the given mode wait on.
+func (m *Mutex) condFor(mode LockMode) *sync.Cond {
+	return m.conds[mode]
+}
+
+// releaseWakesMode[released][blocked] is whether the release of a hold in
+// mode released can let in a waiter in mode blocked, i.e. whether the two
+// are incompatible.
+var releaseWakesMode = func() (t [4][4]bool) {
+	for _, released := range modes {
+		for _, blocked := range modes {
+			t[released][blocked] = !Compatible(blocked, released)
+		}
+	}
+	return t
+}()
+
+// allModes wakes lock waiters in every mode; see wakeWaiters.
+var allModes = [4]bool{true, true, true, true}
+
+// broadcastReleased is broadcast, for after a release in the given mode:
+// the only lock waiters it wakes are those whose mode the release may have
+// made compatible.
+func (m *Mutex) broadcastReleased(mode LockMode) {
+	m.checkQuiesced()
+	m.grantChanWaiters()
+	m.c.Broadcast()
+
+	wake := releaseWakesMode[mode]
+	// Under a holder limit, waiters in the same mode may want our slot.
+	if m.limits[mode] != 0 {
+		wake[mode] = true
+	}
+	// As are any waiters a PriorityTable passed over last time, even if
+	// they're compatible with this release's mode.
+	for _, blocked := range modes {
+		if m.passedOver[blocked] {
+			wake[blocked] = true
+		}
+	}
+	m.passedOver = [4]bool{}
+	m.wakeWaiters(wake)
+}
+
+// wakeWaiters wakes up the goroutines waiting to take the lock in each of
+// the modes set in wake, or, if the Mutex has a PriorityTable or drains
+// compatible waiters, only those of them that that picks.  Must be called
+// with m.mtx held.
+func (m *Mutex) wakeWaiters(wake [4]bool) {
+	if !m.isShutdown() {
+		switch {
+		case m.drainCompatible:
+			wake = m.coalesce(wake)
+		case m.priorities != nil:
+			wake = m.prioritize(wake)
+		}
+	}
+	for _, mode := range modes {
+		if wake[mode] {
+			m.conds[mode].Broadcast()
+		}
+	}
+}
+
+// wakeAll wakes up every goroutine waiting on any of the Mutex's condvars,
+// regardless of priority.
+func (m *Mutex) wakeAll() {
+	m.c.Broadcast()
+	for _, c := range m.conds {
+		c.Broadcast()
+	}
+}
@@ -0,0 +1,38 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseWakesMode(t *testing.T) {
+	assert.Equal(t, [4][4]bool{
+		ModeX:  {ModeX: true, ModeS: true, ModeIX: true, ModeIS: true},
+		ModeS:  {ModeX: true, ModeIX: true},
+		ModeIX: {ModeX: true, ModeS: true},
+		ModeIS: {ModeX: true},
+	}, releaseWakesMode)
+}
+
+func TestReleaseWakesLimitedMode(t *testing.T) {
+	// S releases don't usually wake S waiters, but with a limit on S, an S
+	// waiter may be waiting for the slot.
+	m := New(WithMaxHolders(0, 2, 0, 0))
+	m.SLock()
+	m.SLock()
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.NoError(t, m.SUnlock())
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("S waiter not woken when an S slot became free")
+	}
+}
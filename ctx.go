@@ -0,0 +1,126 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ISLockCtx is like ISLock, but gives up and returns ctx.Err() if ctx is
+// done before the lock could be taken.
+func (m *Mutex) ISLockCtx(ctx context.Context) error {
+	return m.acquire(ctx, ModeIS)
+}
+
+// IXLockCtx is like IXLock, but gives up and returns ctx.Err() if ctx is
+// done before the lock could be taken.
+func (m *Mutex) IXLockCtx(ctx context.Context) error {
+	return m.acquire(ctx, ModeIX)
+}
+
+// SLockCtx is like SLock, but gives up and returns ctx.Err() if ctx is done
+// before the lock could be taken.
+func (m *Mutex) SLockCtx(ctx context.Context) error {
+	return m.acquire(ctx, ModeS)
+}
+
+// XLockCtx is like XLock, but gives up and returns ctx.Err() if ctx is done
+// before the lock could be taken.
+func (m *Mutex) XLockCtx(ctx context.Context) error {
+	return m.acquire(ctx, ModeX)
+}
+
+// XLockWithBudget takes the Mutex in X, but only for at most budget.  It
+// returns a context, derived from ctx, whose deadline is budget from now, and
+// a function that releases the lock.  If the caller hasn't released the lock
+// by the time the context is done, it is released on the caller's behalf;
+// the caller can detect that through the returned context's Err().
+//
+// This stops runaway transactions from holding X indefinitely.  The release
+// function may be called any number of times, before or after the budget
+// runs out.
+func (m *Mutex) XLockWithBudget(ctx context.Context, budget time.Duration) (context.Context, func(), error) {
+	if err := m.XLockCtx(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	bctx, cancel := context.WithTimeout(ctx, budget)
+
+	// Whichever of the caller and the timer gets here first unlocks.
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			m.XUnlock()
+		})
+	}
+	// The timer may release the hold on our behalf.
+	m.owners.transfer(ModeX)
+	go func() {
+		<-bctx.Done()
+		release()
+	}()
+
+	return bctx, func() {
+		release()
+		cancel()
+	}, nil
+}
+
+// XLockWithFallback tries to take the Mutex in X until ctx's deadline, and
+// if that passes first, settles for taking it in fallback (e.g. IX, for a
+// write that can make do with a finer-grained lock further down a tree)
+// instead, allowing that the same amount of time again.  Returns the mode
+// that was taken, so that the caller knows which unlock method to call, or
+// an error if not even fallback could be taken.  If ctx is cancelled rather
+// than timing out, there is no fallback.  The fallback is taken under a
+// context that carries ctx's values, but as ctx is done by then, it only
+// has its own timeout to go on.
+func (m *Mutex) XLockWithFallback(ctx context.Context, fallback LockMode) (LockMode, error) {
+	if !fallback.valid() {
+		return fallback, ErrInvalidMode
+	}
+	start := time.Now()
+	err := m.acquire(ctx, ModeX)
+	if err != context.DeadlineExceeded || ctx.Err() == context.Canceled {
+		return ModeX, err
+	}
+
+	// ctx is done by now, so the fallback keeps its values but not its
+	// deadline.
+	deadline, _ := ctx.Deadline()
+	fctx, cancel := context.WithTimeout(valuesOnly{ctx}, deadline.Sub(start))
+	defer cancel()
+	return fallback, m.acquire(fctx, fallback)
+}
+
+// valuesOnly is a context carrying the values of its parent, but which is
+// never done, for starting a new timeout once the parent has expired.
+type valuesOnly struct {
+	context.Context
+}
+
+func (valuesOnly) Deadline() (time.Time, bool) { return time.Time{}, false }
+
+func (valuesOnly) Done() <-chan struct{} { return nil }
+
+func (valuesOnly) Err() error { return nil }
@@ -0,0 +1,150 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockCtxCancelled(t *testing.T) {
+	m := New()
+	m.XLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.SLockCtx(ctx))
+	assert.Equal(t, context.DeadlineExceeded, m.ISLockCtx(ctx))
+	assert.Equal(t, context.DeadlineExceeded, m.IXLockCtx(ctx))
+	assert.Equal(t, context.DeadlineExceeded, m.XLockCtx(ctx))
+
+	// None of the failed attempts should have left anything behind.
+	assert.Equal(t, setX(0, 1), m.load())
+	m.XUnlock()
+}
+
+func TestLockCtxWakesUp(t *testing.T) {
+	m := New()
+	m.XLock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		errs <- m.IXLockCtx(ctx)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-errs:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(time.Second):
+		t.Fatal("Cancelled waiter never woke up")
+	}
+	m.XUnlock()
+}
+
+func TestLockCtxAcquires(t *testing.T) {
+	m := New()
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlock()
+	}()
+
+	assert.NoError(t, m.SLockCtx(context.Background()))
+	assert.NoError(t, m.SUnlock())
+}
+
+func TestXLockWithBudgetExpires(t *testing.T) {
+	m := New()
+	ctx, release, err := m.XLockWithBudget(context.Background(), 10*time.Millisecond)
+	assert.NoError(t, err)
+	defer release()
+
+	// The lock should be taken away from us once the budget runs out.
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.Err())
+	assert.NoError(t, m.SLockCtx(context.Background()))
+	assert.NoError(t, m.SUnlock())
+}
+
+func TestXLockWithBudgetReleased(t *testing.T) {
+	m := New()
+	ctx, release, err := m.XLockWithBudget(context.Background(), time.Hour)
+	assert.NoError(t, err)
+
+	release()
+	release()
+	assert.Equal(t, context.Canceled, ctx.Err())
+	assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+}
+
+func TestXLockWithFallback(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	mode, err := m.XLockWithFallback(ctx, ModeIX)
+	assert.NoError(t, err)
+	assert.Equal(t, ModeX, mode)
+	assert.NoError(t, m.XUnlock())
+
+	// An IX holder stops us from taking X, but not from falling back.
+	m.IXLock()
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	mode, err = m.XLockWithFallback(ctx, ModeIX)
+	assert.NoError(t, err)
+	assert.Equal(t, ModeIX, mode)
+	assert.Equal(t, setIX(0, 2), m.load())
+
+	// Whereas the fallback to S times out too.
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = m.XLockWithFallback(ctx, ModeS)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Equal(t, setIX(0, 2), m.load())
+
+	// Cancellation doesn't fall back.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = m.XLockWithFallback(ctx, ModeIX)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, setIX(0, 2), m.load())
+
+	_, err = m.XLockWithFallback(context.Background(), LockMode(42))
+	assert.Equal(t, ErrInvalidMode, err)
+}
+
+func TestXLockWithFallbackParentCancelled(t *testing.T) {
+	m := New()
+	m.IXLock()
+
+	// The parent is cancelled while we're trying for X: we mustn't go on
+	// to wait for the fallback, even though it's available.
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := context.WithTimeout(parent, time.Second)
+	defer cancel()
+	time.AfterFunc(5*time.Millisecond, cancelParent)
+
+	start := time.Now()
+	_, err := m.XLockWithFallback(ctx, ModeIX)
+	assert.Equal(t, context.Canceled, err)
+	assert.True(t, time.Since(start) < time.Second, "Waited out the timeout despite cancellation")
+	assert.Equal(t, setIX(0, 1), m.load())
+}
+
+func TestValuesOnly(t *testing.T) {
+	type key struct{}
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "v"), 0)
+	defer cancel()
+	<-parent.Done()
+
+	ctx := valuesOnly{parent}
+	assert.Equal(t, "v", ctx.Value(key{}))
+	assert.NoError(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+}
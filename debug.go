@@ -0,0 +1,117 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// debugDump is everything DebugDump and DebugDumpJSON report.
+type debugDump struct {
+	Time         time.Time         `json:"time"`
+	ID           uint64            `json:"id"`
+	Name         string            `json:"name,omitempty"`
+	State        string            `json:"state"` // The packed state word, in hex
+	Counts       LockState         `json:"counts"`
+	Waiters      map[string]int    `json:"waiters"`
+	Shutdown     bool              `json:"shutdown"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	XHolderStack string            `json:"x_holder_stack,omitempty"`
+}
+
+// debugDump snapshots the Mutex for DebugDump and DebugDumpJSON, holding
+// m.mtx only for as long as it takes to copy everything out.
+func (m *Mutex) debugDump() debugDump {
+	m.mtx.Lock()
+	state := m.load()
+	d := debugDump{
+		ID:       m.id,
+		Name:     m.name,
+		Waiters:  make(map[string]int, len(modes)),
+		Shutdown: m.isShutdown(),
+	}
+	for _, mode := range modes {
+		d.Waiters[mode.String()] = int(atomic.LoadInt32(&m.modeWaiters[mode]))
+	}
+	if len(m.annotations) > 0 {
+		d.Annotations = make(map[string]string, len(m.annotations))
+		for k, v := range m.annotations {
+			d.Annotations[k] = v
+		}
+	}
+	m.mtx.Unlock()
+
+	d.Time = time.Now()
+	d.State = fmt.Sprintf("%#016x", state)
+	d.Counts = lockState(state)
+	d.XHolderStack = m.XHolderStack()
+	return d
+}
+
+// DebugDump writes a human-readable description of everything the Mutex
+// knows about itself to w: its lock state, both packed and decoded, the
+// number of goroutines waiting in each mode, its name and annotations, and,
+// if it was created WithXTracing in an ilock_debug build, the X holder's
+// stack trace.  It's a break-glass tool for incident response; the Mutex's
+// internal lock is only held while the state is copied, not while writing
+// to w.  Write errors are ignored.
+func (m *Mutex) DebugDump(w io.Writer) {
+	d := m.debugDump()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "ilock: mutex %d", d.ID)
+	if d.Name != "" {
+		fmt.Fprintf(&b, " %q", d.Name)
+	}
+	fmt.Fprintf(&b, " at %v\n", d.Time.Format(time.RFC3339Nano))
+	fmt.Fprintf(&b, "state: %s (%v)\n", d.State, d.Counts)
+	b.WriteString("waiters:")
+	for _, mode := range modes {
+		fmt.Fprintf(&b, " %v=%d", mode, d.Waiters[mode.String()])
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "shutdown: %v\n", d.Shutdown)
+
+	keys := make([]string, 0, len(d.Annotations))
+	for k := range d.Annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "annotation: %s=%s\n", k, d.Annotations[k])
+	}
+	if d.XHolderStack != "" {
+		fmt.Fprintf(&b, "X holder stack:\n%s\n", strings.TrimRight(d.XHolderStack, "\n"))
+	}
+	io.WriteString(w, b.String())
+}
+
+// DebugDumpJSON is DebugDump for structured log ingestion: it writes the
+// same information to w as a single JSON object, followed by a newline.
+func (m *Mutex) DebugDumpJSON(w io.Writer) {
+	json.NewEncoder(w).Encode(m.debugDump())
+}
@@ -0,0 +1,47 @@
+package ilock
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugDump(t *testing.T) {
+	m := New(WithName("debug-dump-test"))
+	defer DefaultRegistry().Unregister(m)
+	m.Annotate("table", "users")
+	m.ISLock()
+	m.ISLock()
+	m.IXLock()
+
+	var b bytes.Buffer
+	m.DebugDump(&b)
+	lines := strings.Split(b.String(), "\n")
+	assert.True(t, strings.HasPrefix(lines[0], `ilock: mutex `), lines[0])
+	assert.Contains(t, lines[0], `"debug-dump-test"`)
+	assert.Equal(t, []string{
+		"state: 0x0001000200000000 (X=0 S=0 IX=1 IS=2)",
+		"waiters: X=0 S=0 IX=0 IS=0",
+		"shutdown: false",
+		"annotation: table=users",
+		"",
+	}, lines[1:])
+}
+
+func TestDebugDumpJSON(t *testing.T) {
+	m := New()
+	m.SLock()
+
+	var b bytes.Buffer
+	m.DebugDumpJSON(&b)
+	var got map[string]interface{}
+	assert.NoError(t, json.Unmarshal(b.Bytes(), &got))
+	assert.Equal(t, "0x0000000000010000", got["state"])
+	assert.Equal(t, map[string]interface{}{"X": 0.0, "S": 1.0, "IX": 0.0, "IS": 0.0}, got["counts"])
+	assert.Equal(t, float64(m.ID()), got["id"])
+	assert.NotContains(t, got, "name")
+	assert.NotContains(t, got, "x_holder_stack")
+}
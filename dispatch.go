@@ -0,0 +1,125 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"sync"
+)
+
+// Lock takes the Mutex in the given mode, as the corresponding ISLock,
+// IXLock, SLock or XLock method would, for code that is written in terms of
+// a LockMode.  It panics with ErrInvalidMode if mode isn't a lock mode.
+func (m *Mutex) Lock(mode LockMode) {
+	if !mode.valid() {
+		panic(ErrInvalidMode)
+	}
+	m.mustAcquire(mode)
+}
+
+// Unlock releases the Mutex from the given mode, as the corresponding
+// ISUnlock, IXUnlock, SUnlock or XUnlock method would.
+func (m *Mutex) Unlock(mode LockMode) error {
+	if !mode.valid() {
+		return ErrInvalidMode
+	}
+	return m.unlock(mode)
+}
+
+// TryLock takes the Mutex in the given mode if it can do so without
+// blocking, and reports whether it did.  It returns false if mode isn't a
+// lock mode.
+func (m *Mutex) TryLock(mode LockMode) bool {
+	return m.tryLockMode(mode)
+}
+
+// LockCtx takes the Mutex in the given mode, as the corresponding *LockCtx
+// method would.
+func (m *Mutex) LockCtx(ctx context.Context, mode LockMode) error {
+	if !mode.valid() {
+		return ErrInvalidMode
+	}
+	return m.acquire(ctx, mode)
+}
+
+// WithMode runs f with the Mutex held in the given mode, releasing it
+// afterwards.  If f panics, the panic is recovered and returned as a
+// *LockPanicError once the lock has been released.
+func (m *Mutex) WithMode(mode LockMode, f func()) error {
+	return m.WithModeCtx(context.Background(), mode, f)
+}
+
+// WithModeCtx is like WithMode, but gives up and returns ctx.Err() without
+// running f if ctx is done before the lock could be taken.
+func (m *Mutex) WithModeCtx(ctx context.Context, mode LockMode, f func()) (err error) {
+	if !mode.valid() {
+		return ErrInvalidMode
+	}
+	if err := m.acquire(ctx, mode); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &LockPanicError{Mode: mode, Value: r}
+		}
+		if uerr := m.unlock(mode); err == nil {
+			err = uerr
+		}
+	}()
+	f()
+	return nil
+}
+
+// WithDeferredUnlock takes the Mutex in the given mode, as Lock would, and
+// returns a function that releases it, for deferring in a single expression:
+//
+//	defer m.WithDeferredUnlock(ModeX)()
+//
+// The returned function only releases the hold the first time it is called,
+// so it's safe to call it early as well as deferring it.  It panics like
+// XUnlockMust and friends if the hold has already been released by other
+// means.
+func (m *Mutex) WithDeferredUnlock(mode LockMode) func() {
+	m.Lock(mode)
+	return m.deferredUnlock(mode)
+}
+
+// WithDeferredUnlockCtx is like WithDeferredUnlock, but gives up and returns
+// ctx.Err() if ctx is done before the lock could be taken, in which case the
+// returned function is nil.  Returns ErrInvalidMode if mode isn't a lock
+// mode.
+func (m *Mutex) WithDeferredUnlockCtx(ctx context.Context, mode LockMode) (func(), error) {
+	if err := m.LockCtx(ctx, mode); err != nil {
+		return nil, err
+	}
+	return m.deferredUnlock(mode), nil
+}
+
+func (m *Mutex) deferredUnlock(mode LockMode) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := m.unlock(mode); err != nil {
+				panic(err)
+			}
+		})
+	}
+}
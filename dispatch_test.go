@@ -0,0 +1,121 @@
+package ilock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDispatch(t *testing.T) {
+	m := New()
+	for _, mode := range modes {
+		m.Lock(mode)
+		assert.Equal(t, setMode(mode, 0, 1), m.load(), "Lock(%v)", mode)
+		assert.False(t, m.TryLock(ModeX), "TryLock(X) succeeded while held in %v", mode)
+		assert.NoError(t, m.Unlock(mode))
+
+		assert.True(t, m.TryLock(mode), "TryLock(%v)", mode)
+		assert.Equal(t, setMode(mode, 0, 1), m.load(), "TryLock(%v)", mode)
+		assert.NoError(t, m.Unlock(mode))
+
+		assert.NoError(t, m.LockCtx(context.Background(), mode))
+		assert.Equal(t, setMode(mode, 0, 1), m.load(), "LockCtx(%v)", mode)
+		assert.NoError(t, m.Unlock(mode))
+
+		assert.Equal(t, &LockUnderflowError{Mode: mode}, m.Unlock(mode))
+	}
+
+	m.XLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.LockCtx(ctx, ModeIS))
+	assert.NoError(t, m.XUnlock())
+
+	invalid := LockMode(42)
+	assert.PanicsWithValue(t, ErrInvalidMode, func() { m.Lock(invalid) })
+	assert.Equal(t, ErrInvalidMode, m.Unlock(invalid))
+	assert.False(t, m.TryLock(invalid))
+	assert.Equal(t, ErrInvalidMode, m.LockCtx(context.Background(), invalid))
+}
+
+func TestWithMode(t *testing.T) {
+	m := New()
+	for _, mode := range modes {
+		ran := false
+		assert.NoError(t, m.WithMode(mode, func() {
+			ran = true
+			assert.Equal(t, setMode(mode, 0, 1), m.load(), "WithMode(%v)", mode)
+		}))
+		assert.True(t, ran)
+		assert.Equal(t, uint64(0), m.load(), "WithMode(%v) didn't release the lock", mode)
+	}
+
+	boom := errors.New("boom")
+	err := m.WithMode(ModeX, func() { panic(boom) })
+	assert.Equal(t, &LockPanicError{Mode: ModeX, Value: boom}, err)
+	assert.True(t, errors.Is(err, boom))
+	assert.Equal(t, uint64(0), m.load(), "Panic in WithMode leaked the lock")
+
+	assert.Equal(t, ErrInvalidMode, m.WithMode(LockMode(42), func() { t.Fatal("Ran with an invalid mode") }))
+}
+
+func TestWithModeCtx(t *testing.T) {
+	m := New()
+	m.XLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.WithModeCtx(ctx, ModeS, func() {
+		t.Fatal("Ran without the lock")
+	}))
+	assert.NoError(t, m.XUnlock())
+
+	assert.NoError(t, m.WithModeCtx(context.Background(), ModeS, func() {
+		assert.Equal(t, setS(0, 1), m.load())
+	}))
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestWithDeferredUnlock(t *testing.T) {
+	m := New()
+	func() {
+		defer m.WithDeferredUnlock(ModeX)()
+		assert.Equal(t, setX(0, 1), m.load())
+	}()
+	assert.Equal(t, uint64(0), m.load())
+
+	unlock := m.WithDeferredUnlock(ModeIS)
+	m.ISLock()
+	unlock()
+	unlock()
+	assert.Equal(t, setIS(0, 1), m.load(), "Deferred unlock released more than once")
+	assert.NoError(t, m.ISUnlock())
+
+	unlock = m.WithDeferredUnlock(ModeS)
+	assert.NoError(t, m.SUnlock())
+	assert.Panics(t, unlock)
+
+	assert.PanicsWithValue(t, ErrInvalidMode, func() { m.WithDeferredUnlock(LockMode(42)) })
+}
+
+func TestWithDeferredUnlockCtx(t *testing.T) {
+	m := New()
+	m.XLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	unlock, err := m.WithDeferredUnlockCtx(ctx, ModeS)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, unlock)
+	assert.NoError(t, m.XUnlock())
+
+	unlock, err = m.WithDeferredUnlockCtx(context.Background(), ModeS)
+	assert.NoError(t, err)
+	assert.Equal(t, setS(0, 1), m.load())
+	unlock()
+	assert.Equal(t, uint64(0), m.load())
+
+	_, err = m.WithDeferredUnlockCtx(context.Background(), LockMode(42))
+	assert.Equal(t, ErrInvalidMode, err)
+}
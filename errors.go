@@ -0,0 +1,77 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidMode is returned when a LockMode argument isn't one of the four
+// lock modes.
+var ErrInvalidMode = errors.New("ilock: invalid lock mode")
+
+// LockUnderflowError is returned when unlocking a Mutex in a mode that it
+// isn't held in.
+type LockUnderflowError struct {
+	Mode LockMode
+}
+
+func (e *LockUnderflowError) Error() string {
+	return fmt.Sprintf("ilock: %sUnlock: unlock attempt, but not held", e.Mode)
+}
+
+// LockPanicError is returned by WithMode and WithModeCtx when the function
+// they ran with the lock held panicked.  The lock has been released by the
+// time the caller sees it.
+type LockPanicError struct {
+	Mode  LockMode
+	Value interface{} // The value the function panicked with
+}
+
+func (e *LockPanicError) Error() string {
+	return fmt.Sprintf("ilock: panic while holding %s: %v", e.Mode, e.Value)
+}
+
+// Unwrap returns the value the function panicked with, if it was an error.
+func (e *LockPanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// LockCompatibilityError is returned by the TryLockErr methods when the
+// Mutex couldn't be taken in Mode.  BlockedBy counts the holders in modes
+// incompatible with it, as of just after the attempt failed; it's all zero
+// if the attempt was refused for some other reason, such as a holder limit
+// or a pending upgrade, or if the blockers had left in the meantime.
+type LockCompatibilityError struct {
+	Mode      LockMode
+	BlockedBy LockState
+}
+
+func (e *LockCompatibilityError) Error() string {
+	blockers := heldModes(e.BlockedBy.packed())
+	if len(blockers) == 0 {
+		return fmt.Sprintf("ilock: %v blocked, but not by any incompatible holders", e.Mode)
+	}
+	return fmt.Sprintf("ilock: %v blocked by %s holders", e.Mode, strings.Join(blockers, " "))
+}
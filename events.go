@@ -0,0 +1,64 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "time"
+
+// EventKind says what happened in a LockEvent.
+type EventKind int
+
+// The kinds of LockEvent.
+const (
+	EventAcquired EventKind = iota
+	EventReleased
+	EventBlocked  // A goroutine had to wait to take the Mutex
+	EventTimedOut // A goroutine gave up waiting because its context was done
+)
+
+var eventKindNames = [...]string{
+	EventAcquired: "Acquired",
+	EventReleased: "Released",
+	EventBlocked:  "Blocked",
+	EventTimedOut: "TimedOut",
+}
+
+func (k EventKind) String() string {
+	if k < 0 || int(k) >= len(eventKindNames) {
+		return "EventKind(invalid)"
+	}
+	return eventKindNames[k]
+}
+
+// LockEvent records a single operation on a Mutex.
+type LockEvent struct {
+	Mutex *Mutex
+	Mode  LockMode
+	Kind  EventKind
+	Time  time.Time
+
+	// Duration is how long the goroutine waited, for Acquired and TimedOut
+	// events.
+	Duration time.Duration
+
+	// AcquireID identifies the acquisition, for Acquired events; see
+	// LastAcquireID.
+	AcquireID uint64
+}
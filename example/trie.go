@@ -0,0 +1,180 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package example implements a concurrent trie on top of ilock.Mutex, as a
+// reference for how the intention lock protocol is meant to be used.
+package example
+
+import (
+	"sort"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+// ConcurrentTrie is a map from strings to ints, stored as a trie with an
+// ilock.Mutex on every node.  It is safe for concurrent use.
+//
+// A node's Mutex protects its value, its set of children, and, when held in
+// S or X, the whole subtree below it.  Lookups take every ancestor of the
+// node they're after in IS, and the node itself in S; updates take
+// ancestors in IX and the node itself in X.  Adding a child changes the
+// parent's set of children, so it needs the parent in X.
+type ConcurrentTrie struct {
+	root *node
+}
+
+type node struct {
+	mtx      *ilock.Mutex
+	children map[byte]*node
+	val      int
+	ok       bool // Whether val is set, i.e. whether this node's key is present
+}
+
+func newNode() *node {
+	return &node{mtx: ilock.New(), children: make(map[byte]*node)}
+}
+
+// NewConcurrentTrie returns an empty trie.
+func NewConcurrentTrie() *ConcurrentTrie {
+	return &ConcurrentTrie{root: newNode()}
+}
+
+// find walks down from the root towards key, taking each node it passes
+// through in intention, until either it reaches key's node or the next node
+// doesn't exist.  It returns the nodes it walked through, key's node last if
+// it was found, and whether it was.  The last node returned isn't locked.
+func (t *ConcurrentTrie) find(key string, intention ilock.LockMode, g *ilock.LockReleaseGroup) ([]*node, bool) {
+	path := []*node{t.root}
+	for i := 0; i < len(key); i++ {
+		n := path[len(path)-1]
+		n.mtx.Lock(intention)
+		g.Add(n.mtx, intention)
+		child := n.children[key[i]]
+		if child == nil {
+			return path, false
+		}
+		path = append(path, child)
+	}
+	return path, true
+}
+
+// Get returns the value stored under key, and whether there was one.
+func (t *ConcurrentTrie) Get(key string) (int, bool) {
+	var g ilock.LockReleaseGroup
+	defer g.ReleaseAll()
+
+	path, found := t.find(key, ilock.ModeIS, &g)
+	if !found {
+		return 0, false
+	}
+	n := path[len(path)-1]
+	n.mtx.SLock()
+	g.Add(n.mtx, ilock.ModeS)
+	return n.val, n.ok
+}
+
+// Set stores val under key.
+func (t *ConcurrentTrie) Set(key string, val int) {
+	var g ilock.LockReleaseGroup
+	defer g.ReleaseAll()
+
+	path, found := t.find(key, ilock.ModeIX, &g)
+	n := path[len(path)-1]
+	if !found {
+		// We need to add children to the deepest node that exists, so start
+		// over, taking it in X rather than IX.  Nodes are never removed, so
+		// the path down to it is still good, but someone may have added the
+		// children we need in the meantime.
+		g.ReleaseAll()
+		mutexes := make([]*ilock.Mutex, len(path))
+		for i, p := range path {
+			mutexes[i] = p.mtx
+		}
+		ilock.LockPath(mutexes).XLock()
+		for _, m := range mutexes[:len(mutexes)-1] {
+			g.Add(m, ilock.ModeIX)
+		}
+		g.Add(n.mtx, ilock.ModeX)
+
+		for _, c := range []byte(key[len(path)-1:]) {
+			child := n.children[c]
+			if child == nil {
+				child = newNode()
+				n.children[c] = child
+			}
+			n = child
+		}
+	} else {
+		n.mtx.XLock()
+		g.Add(n.mtx, ilock.ModeX)
+	}
+	n.val, n.ok = val, true
+}
+
+// Delete removes key from the trie, and reports whether it was present.
+// The nodes on the way to it are left in place.
+func (t *ConcurrentTrie) Delete(key string) bool {
+	var g ilock.LockReleaseGroup
+	defer g.ReleaseAll()
+
+	path, found := t.find(key, ilock.ModeIX, &g)
+	if !found {
+		return false
+	}
+	n := path[len(path)-1]
+	n.mtx.XLock()
+	g.Add(n.mtx, ilock.ModeX)
+	wasSet := n.ok
+	n.val, n.ok = 0, false
+	return wasSet
+}
+
+// PrefixScan calls fn for every key in the trie that starts with prefix, in
+// lexicographic order.  The whole subtree is held in S for the duration, so
+// fn sees a consistent view of it, and must not modify the trie.
+func (t *ConcurrentTrie) PrefixScan(prefix string, fn func(k string, v int)) {
+	var g ilock.LockReleaseGroup
+	defer g.ReleaseAll()
+
+	path, found := t.find(prefix, ilock.ModeIS, &g)
+	if !found {
+		return
+	}
+	n := path[len(path)-1]
+	n.mtx.SLock()
+	g.Add(n.mtx, ilock.ModeS)
+	n.walk([]byte(prefix), fn)
+}
+
+// walk calls fn for every key in the subtree below n, which must be held in
+// S or X.
+func (n *node) walk(key []byte, fn func(k string, v int)) {
+	if n.ok {
+		fn(string(key), n.val)
+	}
+	cs := make([]byte, 0, len(n.children))
+	for c := range n.children {
+		cs = append(cs, c)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i] < cs[j] })
+	for _, c := range cs {
+		n.children[c].walk(append(key, c), fn)
+	}
+}
@@ -0,0 +1,55 @@
+//go:build go1.18
+// +build go1.18
+
+package example
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fuzzKey turns a byte into one of a small set of keys, so that operations
+// often hit the same keys and prefixes: up to three letters from "ab".
+func fuzzKey(b byte) string {
+	key := make([]byte, b%4)
+	for i := range key {
+		key[i] = 'a' + (b>>uint(2+i))&1
+	}
+	return string(key)
+}
+
+// FuzzConcurrentTrie checks the trie against a map, for sequences of
+// operations encoded as (op, key) pairs of bytes.
+func FuzzConcurrentTrie(f *testing.F) {
+	f.Add([]byte("\x00a\x00b\x01a\x02b"))
+	f.Add([]byte("\x00\x00\x00\x01\x02\x00"))
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		trie := NewConcurrentTrie()
+		model := make(map[string]int)
+		for i := 0; i+1 < len(ops); i += 2 {
+			key := fuzzKey(ops[i+1])
+			switch ops[i] % 3 {
+			case 0:
+				trie.Set(key, i)
+				model[key] = i
+			case 1:
+				_, had := model[key]
+				assert.Equal(t, had, trie.Delete(key))
+				delete(model, key)
+			case 2:
+				v, ok := trie.Get(key)
+				want, had := model[key]
+				assert.Equal(t, had, ok)
+				assert.Equal(t, want, v)
+			}
+		}
+
+		n := 0
+		trie.PrefixScan("", func(k string, v int) {
+			assert.Equal(t, model[k], v)
+			n++
+		})
+		assert.Equal(t, len(model), n)
+	})
+}
@@ -0,0 +1,91 @@
+package example
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentTrie(t *testing.T) {
+	trie := NewConcurrentTrie()
+
+	_, ok := trie.Get("a")
+	assert.False(t, ok)
+
+	trie.Set("abc", 1)
+	trie.Set("abd", 2)
+	trie.Set("a", 3)
+	trie.Set("b", 4)
+	trie.Set("", 5)
+
+	v, ok := trie.Get("abc")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	_, ok = trie.Get("ab")
+	assert.False(t, ok, "Interior node has a value")
+
+	trie.Set("abc", 6)
+	v, _ = trie.Get("abc")
+	assert.Equal(t, 6, v)
+
+	var scanned []string
+	trie.PrefixScan("a", func(k string, v int) {
+		scanned = append(scanned, fmt.Sprintf("%s=%d", k, v))
+	})
+	assert.Equal(t, []string{"a=3", "abc=6", "abd=2"}, scanned)
+
+	assert.True(t, trie.Delete("abc"))
+	assert.False(t, trie.Delete("abc"))
+	assert.False(t, trie.Delete("ab"))
+	assert.False(t, trie.Delete("xyz"))
+	_, ok = trie.Get("abc")
+	assert.False(t, ok)
+
+	scanned = nil
+	trie.PrefixScan("", func(k string, v int) {
+		scanned = append(scanned, fmt.Sprintf("%s=%d", k, v))
+	})
+	assert.Equal(t, []string{"=5", "a=3", "abd=2", "b=4"}, scanned)
+}
+
+// TestConcurrentTrieStress has each goroutine own a set of keys, so that it
+// knows what it should read back, while sharing prefixes with everyone else.
+func TestConcurrentTrieStress(t *testing.T) {
+	trie := NewConcurrentTrie()
+	const goroutines = 8
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			mine := make(map[string]int)
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprintf("k%d/%d", r.Intn(4), g)
+				switch r.Intn(4) {
+				case 0:
+					trie.Set(key, i)
+					mine[key] = i
+				case 1:
+					_, had := mine[key]
+					assert.Equal(t, had, trie.Delete(key))
+					delete(mine, key)
+				case 2:
+					v, ok := trie.Get(key)
+					want, had := mine[key]
+					assert.Equal(t, had, ok)
+					assert.Equal(t, want, v)
+				case 3:
+					n := 0
+					trie.PrefixScan(key[:2], func(k string, v int) { n++ })
+					assert.True(t, n <= goroutines)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"fmt"
+	"strings"
+)
+
+func (s LockState) String() string {
+	return fmt.Sprintf("X=%d S=%d IX=%d IS=%d", s.X, s.S, s.IX, s.IS)
+}
+
+// Explain describes whether taking the Mutex in the given mode right now
+// would block, and if so, why, e.g. "mode X is blocked because S=2 holders
+// are present".  It's meant for debugging contention; by the time the
+// caller reads the explanation, the state may well have moved on.
+func (m *Mutex) Explain(mode LockMode) string {
+	if !mode.valid() {
+		return fmt.Sprintf("%v is not a lock mode", mode)
+	}
+
+	state := m.load()
+	switch blockers := m.blockers(mode, state); {
+	case blockers != 0:
+		return fmt.Sprintf("mode %v is blocked because %s holders are present",
+			mode, strings.Join(heldModes(blockers), ", "))
+	case !m.underLimit(mode, state):
+		return fmt.Sprintf("mode %v is blocked because its limit of %d holders has been reached",
+			mode, m.limits[mode])
+	}
+	return fmt.Sprintf("mode %v is compatible with current state %v", mode, lockState(state))
+}
+
+// blockers returns the part of the state word that keeps the Mutex from
+// being taken in the given mode: the holders in modes incompatible with it.
+func (m *Mutex) blockers(mode LockMode, state uint64) uint64 {
+	var ret uint64
+	for _, held := range modes {
+		n := extractMode(held, state)
+		if n > 0 && !m.compatible(mode, setMode(held, 0, n)) {
+			ret = setMode(held, ret, n)
+		}
+	}
+	return ret
+}
+
+// heldModes describes each mode that state has holders in, e.g. "S=2".
+func heldModes(state uint64) []string {
+	var ret []string
+	for _, mode := range modes {
+		if n := extractMode(mode, state); n > 0 {
+			ret = append(ret, fmt.Sprintf("%v=%d", mode, n))
+		}
+	}
+	return ret
+}
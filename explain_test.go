@@ -0,0 +1,39 @@
+package ilock
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	cm := Compatibility()
+	for _, requested := range modes {
+		for _, held := range modes {
+			// Set up the holders directly, as X can't be taken twice.
+			m := New()
+			m.CAS(0, setMode(held, 0, 2))
+			if cm[requested][held] {
+				assert.Equal(t,
+					fmt.Sprintf("mode %v is compatible with current state %v", requested, lockState(setMode(held, 0, 2))),
+					m.Explain(requested))
+			} else {
+				assert.Equal(t,
+					fmt.Sprintf("mode %v is blocked because %v=2 holders are present", requested, held),
+					m.Explain(requested))
+			}
+		}
+	}
+}
+
+func TestExplainSeveral(t *testing.T) {
+	m := New(WithMaxHolders(0, 1, 0, 0))
+	assert.Equal(t, "mode X is compatible with current state X=0 S=0 IX=0 IS=0", m.Explain(ModeX))
+
+	m.SLock()
+	m.ISLock()
+	assert.Equal(t, "mode X is blocked because S=1, IS=1 holders are present", m.Explain(ModeX))
+	assert.Equal(t, "mode S is blocked because its limit of 1 holders has been reached", m.Explain(ModeS))
+	assert.Equal(t, "LockMode(invalid) is not a lock mode", m.Explain(LockMode(42)))
+}
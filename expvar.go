@@ -0,0 +1,96 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "expvar"
+
+// mutexVars are the expvar variables that ExpvarMap exports.
+type mutexVars struct {
+	m *expvar.Map
+
+	holders              [4]expvar.Int // Indexed by LockMode
+	waiters, contentions expvar.Int
+}
+
+// expvarKeys are the keys ExpvarMap uses for the holder counts, indexed by
+// LockMode.
+var expvarKeys = [...]string{ModeX: "x", ModeS: "s", ModeIX: "ix", ModeIS: "is"}
+
+// ExpvarMap returns an expvar.Map exporting the Mutex's state: the number of
+// holders in each mode under the keys "x", "s", "ix" and "is", the number
+// of goroutines blocked waiting for it under "waiters", and the number of
+// acquisitions that have had to block under "contentions".
+//
+// The map is created on the first call, and from then on is kept up to date
+// by every acquisition and release, which costs a little bookkeeping.
+func (m *Mutex) ExpvarMap() *expvar.Map {
+	if v := m.expvars(); v != nil {
+		return v.m
+	}
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if v := m.expvars(); v != nil {
+		return v.m
+	}
+	v := &mutexVars{m: new(expvar.Map).Init()}
+	for _, mode := range modes {
+		v.m.Set(expvarKeys[mode], &v.holders[mode])
+	}
+	v.m.Set("waiters", &v.waiters)
+	v.m.Set("contentions", &v.contentions)
+
+	v.update(m.load())
+	for _, n := range m.modeWaiters {
+		v.waiters.Add(int64(n))
+	}
+	m.vars.Store(v)
+	return v.m
+}
+
+// PublishExpvar publishes the Mutex's ExpvarMap under the given name, so that
+// it appears in the output of expvar's /debug/vars handler.  Like
+// expvar.Publish, it panics if the name is already in use.
+func (m *Mutex) PublishExpvar(name string) {
+	expvar.Publish(name, m.ExpvarMap())
+}
+
+// expvars returns the Mutex's expvar variables, or nil if ExpvarMap hasn't
+// been called.
+func (m *Mutex) expvars() *mutexVars {
+	v, _ := m.vars.Load().(*mutexVars)
+	return v
+}
+
+// update sets the holder counts from the given lock state.
+func (v *mutexVars) update(state uint64) {
+	for _, mode := range modes {
+		v.holders[mode].Set(int64(extractMode(mode, state)))
+	}
+}
+
+// updateExpvars brings the holder counts up to date after an acquisition or
+// release.
+func (m *Mutex) updateExpvars() {
+	if v := m.expvars(); v != nil {
+		v.update(m.load())
+	}
+}
@@ -0,0 +1,54 @@
+package ilock
+
+import (
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func expvarInt(m *expvar.Map, key string) int64 {
+	return m.Get(key).(*expvar.Int).Value()
+}
+
+func TestExpvarMap(t *testing.T) {
+	m := New()
+	m.IXLock()
+	vars := m.ExpvarMap()
+	assert.Same(t, vars, m.ExpvarMap())
+	assert.Equal(t, int64(1), expvarInt(vars, "ix"), "Holders before the map was created weren't counted")
+
+	m.IXLock()
+	m.ISLock()
+	assert.Equal(t, int64(0), expvarInt(vars, "x"))
+	assert.Equal(t, int64(0), expvarInt(vars, "s"))
+	assert.Equal(t, int64(2), expvarInt(vars, "ix"))
+	assert.Equal(t, int64(1), expvarInt(vars, "is"))
+
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, int64(1), expvarInt(vars, "waiters"))
+	assert.Equal(t, int64(1), expvarInt(vars, "contentions"))
+
+	assert.NoError(t, m.IXUnlock())
+	assert.NoError(t, m.IXUnlock())
+	<-acquired
+	assert.Equal(t, int64(0), expvarInt(vars, "ix"))
+	assert.Equal(t, int64(1), expvarInt(vars, "s"))
+	assert.Equal(t, int64(0), expvarInt(vars, "waiters"))
+	assert.Equal(t, int64(1), expvarInt(vars, "contentions"))
+}
+
+func TestPublishExpvar(t *testing.T) {
+	m := New()
+	m.PublishExpvar("ilock_test_publish")
+	assert.Same(t, m.ExpvarMap(), expvar.Get("ilock_test_publish"))
+
+	m.XLock()
+	assert.Contains(t, expvar.Get("ilock_test_publish").String(), `"x": 1`)
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "log"
+
+// ForceUnlock forcibly releases every holder of the Mutex in the given mode,
+// and returns how many there were.
+//
+// This is unsafe, and is only intended for emergency recovery, e.g. after
+// detecting locks orphaned by goroutines that have crashed.  The goroutines
+// that were holding the lock aren't told that it has been released: if any
+// of them are still running they will go on as though they held it, and
+// their eventual unlock will fail with a LockUnderflowError.
+//
+// ForceUnlock panics with ErrInvalidMode if mode isn't a lock mode.
+func (m *Mutex) ForceUnlock(mode LockMode) int {
+	if !mode.valid() {
+		panic(ErrInvalidMode)
+	}
+	m.mtx.Lock()
+	if mode == ModeX {
+		m.xTrace.clear()
+		m.xBudget.stop()
+		m.endWrite()
+	}
+	cleared := m.clear(mode)
+	if cleared > 0 {
+		m.zeroed(mode)
+	}
+	m.broadcast()
+	m.mtx.Unlock()
+	m.runDueCallbacks()
+
+	m.logForced(mode, cleared)
+	return int(cleared)
+}
+
+// ForceUnlockAll forcibly releases every holder of the Mutex in every mode,
+// and returns how many holders there were in each.  It carries all the same
+// caveats as ForceUnlock.
+func (m *Mutex) ForceUnlockAll() map[LockMode]int {
+	cleared := make(map[LockMode]int, len(modes))
+
+	m.mtx.Lock()
+	m.xTrace.clear()
+	m.xBudget.stop()
+	m.endWrite()
+	for _, mode := range modes {
+		cleared[mode] = int(m.clear(mode))
+		if cleared[mode] > 0 {
+			m.zeroed(mode)
+		}
+	}
+	m.broadcast()
+	m.mtx.Unlock()
+	m.runDueCallbacks()
+
+	for _, mode := range modes {
+		m.logForced(mode, uint64(cleared[mode]))
+	}
+	return cleared
+}
+
+// clear sets the number of holders in mode to zero, and returns how many
+// there were.  As the holders won't be released in the usual way, it also
+// forgets the bookkeeping kept for them.
+func (m *Mutex) clear(mode LockMode) uint64 {
+	m.owners.clear(mode)
+	if m.stats != nil {
+		m.stats.forgetHolds(mode)
+	}
+	for {
+		state := m.load()
+		if m.cas(state, setMode(mode, state, 0)) {
+			return extractMode(mode, state)
+		}
+	}
+}
+
+func (m *Mutex) logForced(mode LockMode, cleared uint64) {
+	if cleared == 0 {
+		return
+	}
+	log.Printf("ilock: WARNING: forcibly released %d %s holder(s) of Mutex %s", cleared, mode, m.logName())
+}
@@ -0,0 +1,75 @@
+package ilock
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func quietLog(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+	})
+}
+
+func TestForceUnlock(t *testing.T) {
+	quietLog(t)
+
+	m := New()
+	m.IXLock()
+	m.IXLock()
+	m.ISLock()
+
+	assert.Equal(t, 2, m.ForceUnlock(ModeIX))
+	assert.Equal(t, 0, m.ForceUnlock(ModeIX))
+	assert.Equal(t, setIS(0, 1), m.load(), "ForceUnlock touched another mode")
+
+	assert.NoError(t, m.ISUnlock())
+	assert.IsType(t, &LockUnderflowError{}, m.IXUnlock())
+}
+
+func TestForceUnlockInvalidMode(t *testing.T) {
+	m := New()
+	assert.PanicsWithValue(t, ErrInvalidMode, func() { m.ForceUnlock(LockMode(42)) })
+}
+
+func TestForceUnlockAll(t *testing.T) {
+	quietLog(t)
+
+	m := New()
+	m.IXLock()
+	m.ISLock()
+	m.ISLock()
+
+	// Wedge a writer behind the orphaned locks.
+	acquired := make(chan bool)
+	go func() {
+		m.XLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, map[LockMode]int{ModeX: 0, ModeS: 0, ModeIX: 1, ModeIS: 2}, m.ForceUnlockAll())
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Writer never woke up after ForceUnlockAll")
+	}
+	assert.Equal(t, map[LockMode]int{ModeX: 1, ModeS: 0, ModeIX: 0, ModeIS: 0}, m.ForceUnlockAll())
+
+	// Every mode should be immediately available again.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, m.XLockCtx(ctx))
+	assert.NoError(t, m.XUnlock())
+	assert.NoError(t, m.SLockCtx(ctx))
+	assert.NoError(t, m.ISLockCtx(ctx))
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.IXLockCtx(ctx))
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithGracePeriod holds writers back for d after the last reader leaves, as
+// in RCU: once the number of S holders drops to zero, X acquisitions are
+// deferred until d has passed, giving readers that are about to arrive a
+// chance to get in first.  New S holders are let in freely during the grace
+// period.  Once it's over, X waiters proceed if there are still no S
+// holders; otherwise the next grace period starts when those leave.
+//
+// X acquisitions on such a Mutex can't skip the admission checks made under
+// its internal lock.  Upgrades to X with SwitchMode aren't held back.
+func WithGracePeriod(d time.Duration) Option {
+	return func(m *Mutex) {
+		m.gracePeriod = d
+	}
+}
+
+// inGracePeriod reports, with m.mtx held, whether a new acquisition in the
+// given mode has to wait for the grace period to end.
+func (m *Mutex) inGracePeriod(mode LockMode) bool {
+	if mode != ModeX || m.gracePeriod == 0 {
+		return false
+	}
+	return time.Now().UnixNano() < atomic.LoadInt64(&m.graceEnds)
+}
+
+// startGracePeriod is called, with m.mtx held, when the last S holder has
+// left.  It holds X back for the grace period, and arranges for the X
+// waiters to be woken once it's over.
+func (m *Mutex) startGracePeriod() {
+	if m.gracePeriod == 0 {
+		return
+	}
+	atomic.StoreInt64(&m.graceEnds, time.Now().Add(m.gracePeriod).UnixNano())
+	if m.graceTimer != nil {
+		m.graceTimer.Stop()
+	}
+	m.graceTimer = time.AfterFunc(m.gracePeriod, func() {
+		m.mtx.Lock()
+		m.broadcast()
+		m.mtx.Unlock()
+		m.runDueCallbacks()
+	})
+}
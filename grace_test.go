@@ -0,0 +1,52 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracePeriod(t *testing.T) {
+	m := New(WithGracePeriod(20 * time.Millisecond))
+	assert.True(t, m.TryXLock(), "X held back before any reader has come and gone")
+	assert.NoError(t, m.XUnlock())
+
+	m.SLock()
+	acquired := make(chan time.Time)
+	go func() {
+		m.XLock()
+		acquired <- time.Now()
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	released := time.Now()
+	assert.NoError(t, m.SUnlock())
+	assert.False(t, m.TryXLock(), "X let in during the grace period")
+	assert.True(t, m.TrySLock(), "S held back during the grace period")
+	assert.NoError(t, m.SUnlock())
+
+	select {
+	case at := <-acquired:
+		// The second SUnlock started a fresh grace period.
+		assert.True(t, at.Sub(released) >= 20*time.Millisecond, "X waiter got in after %v", at.Sub(released))
+	case <-time.After(time.Second):
+		t.Fatal("X waiter not let in after the grace period")
+	}
+	assert.NoError(t, m.XUnlock())
+}
+
+func TestGracePeriodReadersReturn(t *testing.T) {
+	m := New(WithGracePeriod(5 * time.Millisecond))
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+
+	// A reader arriving during the grace period keeps X out past its end.
+	m.SLock()
+	time.Sleep(10 * time.Millisecond)
+	assert.False(t, m.TryXLock())
+	assert.NoError(t, m.SUnlock())
+	assert.False(t, m.TryXLock())
+	time.Sleep(10 * time.Millisecond)
+	assert.True(t, m.TryXLock())
+}
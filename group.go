@@ -0,0 +1,154 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+var nextID uint64
+
+// ID returns a number identifying the Mutex, assigned by New, that is unique
+// within the process.  IDs increase in order of construction.
+func (m *Mutex) ID() uint64 {
+	return m.id
+}
+
+// MutexGroup takes a set of unrelated Mutexes together.  To avoid deadlock,
+// any two goroutines taking overlapping groups have to take them in the same
+// order; by default, that's the order they were given to NewMutexGroup, but
+// SortByAddress or SortByID can impose an order instead.
+type MutexGroup struct {
+	mutexes     []*Mutex
+	sortedOrder []int // Indexes into mutexes, in the order they're taken
+}
+
+// NewMutexGroup returns a group of the given Mutexes, to be taken in the
+// order given.
+func NewMutexGroup(mutexes ...*Mutex) *MutexGroup {
+	g := &MutexGroup{
+		mutexes:     mutexes,
+		sortedOrder: make([]int, len(mutexes)),
+	}
+	for i := range g.sortedOrder {
+		g.sortedOrder[i] = i
+	}
+	return g
+}
+
+// SortByAddress has the group take its Mutexes in order of their address in
+// memory.  This is consistent between all groups within a process, without
+// the caller having to come up with an order of their own, but changes from
+// one run of the process to the next.
+func (g *MutexGroup) SortByAddress() {
+	g.sortBy(mutexAddress)
+}
+
+// mutexAddress is the key for sorting Mutexes by address.
+func mutexAddress(m *Mutex) uint64 {
+	return uint64(uintptr(unsafe.Pointer(m)))
+}
+
+// SortByID has the group take its Mutexes in order of their IDs, which is
+// the order they were created in.
+func (g *MutexGroup) SortByID() {
+	g.sortBy((*Mutex).ID)
+}
+
+func (g *MutexGroup) sortBy(key func(*Mutex) uint64) {
+	sort.SliceStable(g.sortedOrder, func(i, j int) bool {
+		return key(g.mutexes[g.sortedOrder[i]]) < key(g.mutexes[g.sortedOrder[j]])
+	})
+}
+
+// AcquireAll takes every Mutex in the group in the given mode.
+func (g *MutexGroup) AcquireAll(mode LockMode) {
+	for _, i := range g.sortedOrder {
+		g.mutexes[i].mustAcquire(mode)
+	}
+}
+
+// ReleaseAll releases every Mutex in the group from the given mode, in the
+// reverse of the order AcquireAll took them.  Returns the first error
+// encountered, but carries on releasing the rest.
+func (g *MutexGroup) ReleaseAll(mode LockMode) error {
+	return g.releaseFirst(len(g.sortedOrder), mode)
+}
+
+// acquireAll is like AcquireAll, but gives up if ctx is done first, in
+// which case it releases whatever it had already taken.
+func (g *MutexGroup) acquireAll(ctx context.Context, mode LockMode) error {
+	for n, i := range g.sortedOrder {
+		if err := g.mutexes[i].acquire(ctx, mode); err != nil {
+			g.releaseFirst(n, mode)
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseFirst releases the first n Mutexes that AcquireAll takes, in
+// reverse order.
+func (g *MutexGroup) releaseFirst(n int, mode LockMode) error {
+	var err error
+	for i := n - 1; i >= 0; i-- {
+		if e := g.mutexes[g.sortedOrder[i]].unlock(mode); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// BatchISLock takes every one of the given Mutexes in IS, e.g. for an
+// operation that spans several unrelated branches of a tree, in order of
+// ID so that concurrent batches can't deadlock.  The returned function
+// releases them all again in reverse order, and may safely be called more
+// than once.
+func BatchISLock(mutexes []*Mutex) func() {
+	unlock, err := BatchISLockCtx(context.Background(), mutexes)
+	if err != nil {
+		panic(err)
+	}
+	return unlock
+}
+
+// BatchISLockCtx is like BatchISLock, but gives up and returns ctx.Err() if
+// ctx is done before every Mutex could be taken, in which case none of them
+// are held.
+func BatchISLockCtx(ctx context.Context, mutexes []*Mutex) (func(), error) {
+	g := NewMutexGroup(mutexes...)
+	g.SortByID()
+	if err := g.acquireAll(ctx, ModeIS); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if err := g.ReleaseAll(ModeIS); err != nil {
+				panic(err)
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,95 @@
+package ilock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutexID(t *testing.T) {
+	a, b := New(), New()
+	assert.True(t, a.ID() < b.ID())
+}
+
+func TestMutexGroupOrder(t *testing.T) {
+	a, b, c := New(), New(), New()
+
+	g := NewMutexGroup(c, a, b)
+	assert.Equal(t, []int{0, 1, 2}, g.sortedOrder)
+
+	g.SortByID()
+	assert.Equal(t, []int{1, 2, 0}, g.sortedOrder)
+	assert.Equal(t, []*Mutex{c, a, b}, g.mutexes, "Sorting reordered the Mutexes themselves")
+
+	g.SortByAddress()
+	for i := 1; i < len(g.sortedOrder); i++ {
+		prev := uintptr(unsafe.Pointer(g.mutexes[g.sortedOrder[i-1]]))
+		curr := uintptr(unsafe.Pointer(g.mutexes[g.sortedOrder[i]]))
+		assert.True(t, prev < curr)
+	}
+}
+
+func TestMutexGroupAcquireAll(t *testing.T) {
+	a, b, c := New(), New(), New()
+
+	// Two groups over the same Mutexes, given in opposite orders, would
+	// deadlock if they weren't sorted.
+	g1 := NewMutexGroup(a, b, c)
+	g2 := NewMutexGroup(c, b, a)
+	g1.SortByID()
+	g2.SortByID()
+
+	var wg sync.WaitGroup
+	for _, g := range []*MutexGroup{g1, g2} {
+		wg.Add(1)
+		go func(g *MutexGroup) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				g.AcquireAll(ModeX)
+				assert.NoError(t, g.ReleaseAll(ModeX))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for _, m := range []*Mutex{a, b, c} {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Error(t, g1.ReleaseAll(ModeX))
+}
+
+func TestBatchISLock(t *testing.T) {
+	a, b, c := New(), New(), New()
+	unlock := BatchISLock([]*Mutex{c, a, b})
+	for _, m := range []*Mutex{a, b, c} {
+		assert.Equal(t, setIS(0, 1), m.load())
+	}
+
+	unlock()
+	unlock()
+	for _, m := range []*Mutex{a, b, c} {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+}
+
+func TestBatchISLockCtx(t *testing.T) {
+	a, b, c := New(), New(), New()
+	b.XLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	unlock, err := BatchISLockCtx(ctx, []*Mutex{c, b, a})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Nil(t, unlock)
+	assert.Equal(t, uint64(0), a.load(), "Failed batch left a held")
+	assert.Equal(t, uint64(0), c.load(), "Batch didn't go in order of ID")
+
+	assert.NoError(t, b.XUnlock())
+	unlock, err = BatchISLockCtx(context.Background(), []*Mutex{c, b, a})
+	assert.NoError(t, err)
+	unlock()
+}
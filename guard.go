@@ -0,0 +1,104 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "context"
+
+// Guards hold a Mutex in one mode until they're closed, for use with defer:
+//
+//	defer ilock.NewXGuard(m).Close()
+//
+// Each guard embeds the Mutex it holds and implements io.Closer.  Closing a
+// guard releases one hold in its mode, so it mustn't be closed twice.
+
+// ISGuard holds a Mutex in IS.
+type ISGuard struct {
+	*Mutex
+}
+
+// NewISGuard takes m in IS and returns a guard that releases it.
+func NewISGuard(m *Mutex) ISGuard {
+	m.ISLock()
+	return ISGuard{m}
+}
+
+// Close releases the Mutex from IS.
+func (g ISGuard) Close() error {
+	return g.ISUnlock()
+}
+
+// IXGuard holds a Mutex in IX.
+type IXGuard struct {
+	*Mutex
+}
+
+// NewIXGuard takes m in IX and returns a guard that releases it.
+func NewIXGuard(m *Mutex) IXGuard {
+	m.IXLock()
+	return IXGuard{m}
+}
+
+// Close releases the Mutex from IX.
+func (g IXGuard) Close() error {
+	return g.IXUnlock()
+}
+
+// SGuard holds a Mutex in S.
+type SGuard struct {
+	*Mutex
+}
+
+// NewSGuard takes m in S and returns a guard that releases it.
+func NewSGuard(m *Mutex) SGuard {
+	m.SLock()
+	return SGuard{m}
+}
+
+// Close releases the Mutex from S.
+func (g SGuard) Close() error {
+	return g.SUnlock()
+}
+
+// XGuard holds a Mutex in X.
+type XGuard struct {
+	*Mutex
+}
+
+// NewXGuard takes m in X and returns a guard that releases it.
+func NewXGuard(m *Mutex) XGuard {
+	m.XLock()
+	return XGuard{m}
+}
+
+// NewXGuardCtx is like NewXGuard, but gives up and returns the error from
+// XLockCtx if m couldn't be taken, e.g. because ctx was done first.  The
+// returned guard is only usable if the error is nil.
+func NewXGuardCtx(ctx context.Context, m *Mutex) (XGuard, error) {
+	if err := m.XLockCtx(ctx); err != nil {
+		return XGuard{}, err
+	}
+	return XGuard{m}, nil
+}
+
+// Close releases the Mutex from X.
+func (g XGuard) Close() error {
+	return g.XUnlock()
+}
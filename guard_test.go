@@ -0,0 +1,46 @@
+package ilock
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGuards(t *testing.T) {
+	m := New()
+	func() {
+		defer NewIXGuard(m).Close()
+		defer NewISGuard(m).Close()
+		assert.Equal(t, setIS(setIX(0, 1), 1), m.load())
+	}()
+	assert.Equal(t, uint64(0), m.load())
+
+	func() {
+		defer NewSGuard(m).Close()
+		assert.Equal(t, setS(0, 1), m.load())
+	}()
+	assert.Equal(t, uint64(0), m.load())
+
+	var c io.Closer = NewXGuard(m)
+	assert.Equal(t, setX(0, 1), m.load())
+	assert.NoError(t, c.Close())
+	assert.Equal(t, &LockUnderflowError{Mode: ModeX}, c.Close())
+}
+
+func TestNewXGuardCtx(t *testing.T) {
+	m := New()
+	g, err := NewXGuardCtx(context.Background(), m)
+	assert.NoError(t, err)
+	assert.Equal(t, m, g.Mutex)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	_, err = NewXGuardCtx(ctx, m)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.NoError(t, g.Close())
+	assert.Equal(t, uint64(0), m.load())
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "time"
+
+// HistogramBuckets is the number of bounded buckets in a Histogram.  Bucket
+// i counts durations of at most BucketBound(i), which doubles from 1µs up to
+// about 8s; one last bucket counts everything longer.
+const HistogramBuckets = 24
+
+// BucketBound returns the upper bound of bucket i of a Histogram.
+func BucketBound(i int) time.Duration {
+	return time.Microsecond << uint(i)
+}
+
+// Histogram is a distribution of durations, in exponentially-spaced buckets.
+// The zero value is an empty Histogram.
+type Histogram struct {
+	Counts [HistogramBuckets + 1]uint64
+	Sum    time.Duration
+	Max    time.Duration
+}
+
+// observe adds d to the histogram.
+func (h *Histogram) observe(d time.Duration) {
+	i := 0
+	for i < HistogramBuckets && d > BucketBound(i) {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += d
+	if d > h.Max {
+		h.Max = d
+	}
+}
+
+// Count returns the number of durations in the histogram.
+func (h Histogram) Count() uint64 {
+	var n uint64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Percentile returns an upper bound on the p-th percentile (0 to 100) of the
+// durations in the histogram: the upper bound of the bucket the percentile
+// falls in, or the longest duration seen if that's shorter.  Returns 0 for
+// an empty histogram.
+func (h Histogram) Percentile(p float64) time.Duration {
+	total := h.Count()
+	if total == 0 {
+		return 0
+	}
+	rank := uint64(p / 100 * float64(total))
+	if rank == 0 {
+		rank = 1
+	}
+
+	var seen uint64
+	for i, c := range h.Counts {
+		seen += c
+		if seen >= rank {
+			if i < HistogramBuckets && BucketBound(i) < h.Max {
+				return BucketBound(i)
+			}
+			return h.Max
+		}
+	}
+	return h.Max
+}
@@ -0,0 +1,33 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	var h Histogram
+	assert.Equal(t, time.Duration(0), h.Percentile(50))
+
+	for i := 0; i < 90; i++ {
+		h.observe(3 * time.Microsecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(time.Millisecond)
+	}
+	assert.Equal(t, uint64(100), h.Count())
+	assert.Equal(t, 90*3*time.Microsecond+10*time.Millisecond, h.Sum)
+	assert.Equal(t, uint64(90), h.Counts[2], "3µs should fall in the (2µs, 4µs] bucket")
+
+	assert.Equal(t, 4*time.Microsecond, h.Percentile(50))
+	assert.Equal(t, 4*time.Microsecond, h.Percentile(90))
+	// The (512µs, 1024µs] bucket, clamped to the longest wait seen.
+	assert.Equal(t, time.Millisecond, h.Percentile(99))
+	assert.Equal(t, time.Millisecond, h.Percentile(100))
+
+	h.observe(time.Minute)
+	assert.Equal(t, uint64(1), h.Counts[HistogramBuckets])
+	assert.Equal(t, time.Minute, h.Percentile(100))
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "sync"
+
+// LockHistory is a fixed-size ring buffer of the most recent events on a
+// Mutex, for post-mortem debugging of deadlocks and liveness problems.  It
+// is protected by its own mutex rather than m.mtx, so that recording an
+// event never holds up the lock itself (or requires the fast paths to take
+// m.mtx).
+type LockHistory struct {
+	mtx         sync.Mutex
+	buf         []LockEvent
+	head, count int // buf[head] is the oldest event
+}
+
+// WithHistory records the last size acquisitions and releases of the Mutex,
+// which can be retrieved with History.
+func WithHistory(size int) Option {
+	return func(m *Mutex) {
+		if size > 0 {
+			m.history = &LockHistory{buf: make([]LockEvent, size)}
+		}
+	}
+}
+
+func (h *LockHistory) append(e LockEvent) {
+	h.mtx.Lock()
+	if h.count < len(h.buf) {
+		h.buf[(h.head+h.count)%len(h.buf)] = e
+		h.count++
+	} else {
+		h.buf[h.head] = e
+		h.head = (h.head + 1) % len(h.buf)
+	}
+	h.mtx.Unlock()
+}
+
+func (h *LockHistory) events() []LockEvent {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	events := make([]LockEvent, h.count)
+	for i := range events {
+		events[i] = h.buf[(h.head+i)%len(h.buf)]
+	}
+	return events
+}
+
+// History returns a copy of the events recorded by WithHistory, oldest
+// first, or nil if the Mutex wasn't created with it.
+func (m *Mutex) History() []LockEvent {
+	if m.history == nil {
+		return nil
+	}
+	return m.history.events()
+}
@@ -0,0 +1,56 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type event struct {
+	mode LockMode
+	kind EventKind
+}
+
+func historyOf(m *Mutex) []event {
+	var ret []event
+	for _, e := range m.History() {
+		ret = append(ret, event{e.Mode, e.Kind})
+	}
+	return ret
+}
+
+func TestHistory(t *testing.T) {
+	m := New(WithHistory(4))
+	assert.Empty(t, m.History())
+
+	m.IXLock()
+	m.ISLock()
+	assert.Equal(t, []event{
+		{ModeIX, EventAcquired},
+		{ModeIS, EventAcquired},
+	}, historyOf(m))
+
+	// Overflow the ring buffer; only the most recent events should remain.
+	m.ISUnlock()
+	m.IXUnlock()
+	m.XLock()
+	m.XUnlock()
+	assert.Equal(t, []event{
+		{ModeIS, EventReleased},
+		{ModeIX, EventReleased},
+		{ModeX, EventAcquired},
+		{ModeX, EventReleased},
+	}, historyOf(m))
+
+	events := m.History()
+	for i := 1; i < len(events); i++ {
+		assert.False(t, events[i].Time.Before(events[i-1].Time), "Events out of order")
+	}
+}
+
+func TestNoHistory(t *testing.T) {
+	m := New()
+	m.XLock()
+	m.XUnlock()
+	assert.Nil(t, m.History())
+}
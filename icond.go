@@ -0,0 +1,130 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync"
+	"time"
+)
+
+// ICond is a condition variable for goroutines holding a Mutex, in any mode:
+// Wait releases the caller's hold in the mode it names and takes it again
+// once woken, as sync.Cond.Wait does for a sync.Locker.  As with sync.Cond,
+// waiters must re-check their condition in a loop once Wait returns.
+type ICond struct {
+	m *Mutex
+
+	mtx     sync.Mutex
+	waiters []chan struct{} // In arrival order; closed to wake them
+}
+
+// NewICond returns a condition variable for goroutines holding m.
+func NewICond(m *Mutex) *ICond {
+	return &ICond{m: m}
+}
+
+// Wait releases the caller's hold on the Mutex in the given mode, blocks
+// until woken by Signal or Broadcast, and takes the Mutex in mode again
+// before returning.  It panics if the caller doesn't hold the Mutex in mode.
+func (c *ICond) Wait(mode LockMode) {
+	ch := c.enqueue()
+	c.release(ch, mode)
+	<-ch
+	c.m.Lock(mode)
+}
+
+// WaitTimeout is Wait, giving up on being woken after d.  Either way, it
+// takes the Mutex in mode again before returning.  Returns true if the
+// caller was woken by Signal or Broadcast, and false if it timed out.  A
+// Signal that races with the timeout is never lost: if it picked the caller,
+// WaitTimeout reports that it was woken.
+func (c *ICond) WaitTimeout(d time.Duration, mode LockMode) bool {
+	ch := c.enqueue()
+	c.release(ch, mode)
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	woken := true
+	select {
+	case <-ch:
+	case <-t.C:
+		// Signal may have picked us since the timer fired, in which case
+		// we're no longer in the queue, and count as woken.
+		woken = !c.dequeue(ch)
+	}
+	c.m.Lock(mode)
+	return woken
+}
+
+// Signal wakes the longest-waiting goroutine blocked in Wait or
+// WaitTimeout, if there is one.
+func (c *ICond) Signal() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if len(c.waiters) > 0 {
+		close(c.waiters[0])
+		c.waiters = c.waiters[1:]
+	}
+}
+
+// Broadcast wakes every goroutine blocked in Wait or WaitTimeout.
+func (c *ICond) Broadcast() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, ch := range c.waiters {
+		close(ch)
+	}
+	c.waiters = nil
+}
+
+// enqueue adds a waiter to the queue.  Waiters join before releasing the
+// Mutex, so that a Signal sent as soon as the Mutex is free can't be missed.
+func (c *ICond) enqueue() chan struct{} {
+	ch := make(chan struct{})
+	c.mtx.Lock()
+	c.waiters = append(c.waiters, ch)
+	c.mtx.Unlock()
+	return ch
+}
+
+// dequeue removes a waiter that timed out from the queue, and reports
+// whether it was still there.
+func (c *ICond) dequeue(ch chan struct{}) bool {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for i, w := range c.waiters {
+		if w == ch {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// release gives up the caller's hold on the Mutex for Wait.  If there was
+// no such hold, it takes the caller's waiter, ch, back out of the queue and
+// panics.
+func (c *ICond) release(ch chan struct{}, mode LockMode) {
+	if err := c.m.Unlock(mode); err != nil {
+		c.dequeue(ch)
+		panic(err)
+	}
+}
@@ -0,0 +1,67 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestICondWait(t *testing.T) {
+	m := New()
+	c := NewICond(m)
+	ready := false
+
+	done := make(chan bool)
+	go func() {
+		m.SLock()
+		for !ready {
+			c.Wait(ModeS)
+		}
+		assert.Equal(t, setS(0, 1), m.load(), "Wait didn't take S back")
+		assert.NoError(t, m.SUnlock())
+		done <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	m.XLock()
+	ready = true
+	c.Signal()
+	assert.NoError(t, m.XUnlock())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Waiter not woken by Signal")
+	}
+}
+
+func TestICondWaitTimeout(t *testing.T) {
+	m := New()
+	c := NewICond(m)
+
+	m.IXLock()
+	assert.False(t, c.WaitTimeout(5*time.Millisecond, ModeIX), "WaitTimeout should have timed out")
+	assert.Equal(t, setIX(0, 1), m.load(), "WaitTimeout didn't take IX back after timing out")
+	assert.Empty(t, c.waiters, "Timed out waiter left in the queue")
+
+	woken := make(chan bool)
+	go func() {
+		m.IXLock()
+		woken <- c.WaitTimeout(time.Minute, ModeIX)
+	}()
+	time.Sleep(5 * time.Millisecond)
+	c.Broadcast()
+	select {
+	case ok := <-woken:
+		assert.True(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Waiter not woken by Broadcast")
+	}
+	assert.Equal(t, setIX(0, 2), m.load(), "WaitTimeout didn't take IX back after being woken")
+}
+
+func TestICondWaitUnderflow(t *testing.T) {
+	c := NewICond(New())
+	assert.Panics(t, func() { c.Wait(ModeX) })
+	assert.Empty(t, c.waiters)
+}
@@ -104,7 +104,9 @@
 package ilock
 
 import (
+	"context"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -118,7 +120,8 @@ import (
 // incompatible with the current state context set, and then the state
 // representing how many threads have entered the lock as each of its
 // states. In order to check the Mutex state in a lock-free manner, the four
-// fields are packed into a single uint64:
+// fields are packed into a single uint64, which is only ever accessed
+// atomically:
 //
 //     |63      48|47      32|31     16|15      0|
 //      \   IX   / \   IS   / \   S   / \   X   /
@@ -126,10 +129,104 @@ import (
 //
 type Mutex struct {
 	mtx   sync.Mutex
-	c     *sync.Cond // The condvar that mutator threads will wait on
+	c     *sync.Cond // The condvar that watchers and upgrades wait on
 	state uint64
+	store StateStore // Replaces state, if set by WithStateStore
+	id    uint64     // See ID
+
+	name string // Set by WithName or SetName; protected by m.mtx
+
+	starvationThreshold time.Duration
+	starvationHandler   func(mode LockMode, waitDuration time.Duration)
+
+	watermark        uint64 // Set by WithHighWatermark
+	watermarkHandler func(m *Mutex, mode LockMode, count uint16)
+	watermarkCrossed [4]int32 // Whether each mode is over the watermark; accessed atomically
+
+	retryPolicy RetryPolicy // Set by WithRetryPolicy; consulted by LockRetry
+
+	limits [4]uint16 // Per-mode holder limits set by WithMaxHolders; 0 is unlimited
+	maxX   uint16    // Set by SetMaxXHolders; 0 is the usual exclusive X
+
+	history *LockHistory // Set by WithHistory
+	stats   *lockStats   // Set by WithStats
+	bus     *EventBus    // Set by WithEventBus
+	policy  LockPolicy   // Set by WithPolicy
+	xTrace  xTracer      // Set by WithXTracing
+	owners  ownerTracker // Only tracks anything in ilock_goroutineid builds
+
+	watchers int32 // Goroutines waiting on the lock state; see waitUntil
+
+	// Set by WithAntiStarvationThreshold, and protected by m.mtx.
+	antiStarvation int
+	sGrants        uint64   // S acquisitions so far
+	xWaiters       []uint64 // The value of sGrants when each X waiter arrived
+
+	modeWaiters   [4]int32          // Goroutines blocked in lock, per mode; written under m.mtx, accessed atomically
+	annotations   map[string]string // Set by Annotate; protected by m.mtx
+	lastXAcquired int64             // UnixNano of the last X acquisition; accessed atomically
+	lastAcquireID uint64            // Bumped by every acquisition; accessed atomically
+
+	chanWaiters []*LockChan // See SLockChan et al; protected by m.mtx
+
+	// Pending upgrades per target mode, protected by m.mtx, and their total,
+	// accessed atomically; see RequestUpgrade.
+	upgrades  [4]int
+	upgrading int32
+
+	promotionTimeout time.Duration // Set by WithPromotionTimeout
+
+	vars atomic.Value // The *mutexVars created by ExpvarMap
+
+	shutdown int32 // Set by GracefulShutdown; accessed atomically
+
+	// Created by QuiesceChan, and closed once the Mutex has been shut down
+	// and drained; protected by m.mtx.
+	quiesced      chan struct{}
+	quiesceClosed bool
+
+	xBudget *xHoldBudget // Set by WithXHoldBudget
+
+	opts []Option // As passed to New; see Clone
+
+	// The condvars that goroutines blocked in lock wait on, per mode; see
+	// condFor.
+	conds [4]*sync.Cond
+
+	// Set by WithGracePeriod.  graceEnds is the UnixNano at which the
+	// current grace period ends, accessed atomically; graceTimer wakes X
+	// waiters then, and is protected by m.mtx.
+	gracePeriod time.Duration
+	graceEnds   int64
+	graceTimer  *time.Timer
+
+	priorities      *PriorityTable // Set by WithPriorityTable
+	drainCompatible bool           // Set by WithDrainCompatibleWaiters
+
+	// The modes whose waiters prioritize last left asleep, to be woken by
+	// the next release, whatever its mode; protected by m.mtx.
+	passedOver [4]bool
+
+	// Registered by OnSUnlock et al, and protected by m.mtx, along with
+	// those whose mode's count has since dropped to zero; callbacksDue is
+	// set, atomically, while there are any of the latter.
+	onUnlocks    [4][]*unlockCallback
+	dueCallbacks []*unlockCallback
+	callbacksDue int32
+
+	transitions transitions // See OnTransition
+	observers   observers   // See Observe
+
+	// Snapshot's seqlock: changing counts the changes to state in flight,
+	// and version those completed.  Both are accessed atomically.
+	changing int32
+	version  uint64
+	seq     uint64 // Odd while the Mutex is held in X; see SeqBegin
 }
 
+// Option configures a Mutex at construction time.
+type Option func(*Mutex)
+
 const xOffset uint64 = 0
 const xMask uint64 = (1 << 16) - 1
 
@@ -144,10 +241,6 @@ const ixMask uint64 = 0xffffffffffffffff & ^((1 << 48) - 1)
 
 const maxHolders = (1 << 16) - 1
 
-const startingBackoff = 50 * time.Microsecond
-const maxBackoff = 500 * time.Millisecond
-const backoffFactor = 2
-
 func extractX(state uint64) uint64 {
 	return (state & xMask) >> xOffset
 }
@@ -197,197 +290,636 @@ func compatableWithIS(state uint64) bool {
 	return extractX(state) == 0
 }
 
-// New returns a new Mutex.
-func New() *Mutex {
+// New returns a new Mutex, configured by the supplied options.
+func New(opts ...Option) *Mutex {
 	var m Mutex
 	m.c = sync.NewCond(&m.mtx)
+	for i := range m.conds {
+		m.conds[i] = sync.NewCond(&m.mtx)
+	}
+	m.id = atomic.AddUint64(&nextID, 1)
+	m.opts = opts
+	for _, opt := range opts {
+		opt(&m)
+	}
+	if m.name != "" {
+		DefaultRegistry().Register(&m, m.name)
+	}
 	return &m
 }
 
+// load returns the current lock state.  The IS and S fast paths modify the
+// state without holding m.mtx, so every access to it has to be atomic.
+func (m *Mutex) load() uint64 {
+	if m.store != nil {
+		return m.store.Load()
+	}
+	return atomic.LoadUint64(&m.state)
+}
+
+// cas replaces the lock state with new if, and only if, it is still old.
+func (m *Mutex) cas(old, new uint64) bool {
+	m.beginChange()
+	var ok bool
+	if m.store != nil {
+		ok = m.store.CAS(old, new)
+	} else {
+		ok = atomic.CompareAndSwapUint64(&m.state, old, new)
+	}
+	m.endChange(ok)
+	return ok
+}
+
+// beginChange and endChange bracket every attempt to change the lock state,
+// for the benefit of Snapshot; endChange is told whether the attempt made a
+// change.  As the fast paths don't take m.mtx, changes may be made
+// concurrently, so rather than the parity of version, Snapshot goes by the
+// count of changes in flight.
+func (m *Mutex) beginChange() {
+	atomic.AddInt32(&m.changing, 1)
+}
+
+func (m *Mutex) endChange(changed bool) {
+	if changed {
+		atomic.AddUint64(&m.version, 1)
+	}
+	atomic.AddInt32(&m.changing, -1)
+}
+
+// tryRegister registers the calling thread as a holder in the given mode,
+// provided that the current lock state is compatible with it.  Returns
+// whether the thread was registered.
+//
+// The compatibility check and the registration are made atomic by the CAS:
+// it only succeeds if the state that was checked is still the current one.
+// That is exactly the guarantee m.mtx gives the slow paths, which is why
+// this is safe to call without holding it.
+func (m *Mutex) tryRegister(mode LockMode) bool {
+	for {
+		state := m.load()
+		if !m.compatible(mode, state) || !m.underLimit(mode, state) {
+			return false
+		}
+		curr := extractMode(mode, state)
+		if next := setMode(mode, state, curr+1); m.cas(state, next) {
+			if curr == 0 {
+				m.activated(mode, next)
+			}
+			m.observe(mode, true, state, next)
+			return true
+		}
+	}
+}
+
+// unregister removes one holder in the given mode.  Returns the number of
+// holders remaining, and false if there were none to begin with.
+func (m *Mutex) unregister(mode LockMode) (uint64, bool) {
+	for {
+		state := m.load()
+		curr := extractMode(mode, state)
+		if curr == 0 {
+			return 0, false
+		}
+		if next := setMode(mode, state, curr-1); m.cas(state, next) {
+			m.observe(mode, false, state, next)
+			return curr - 1, true
+		}
+	}
+}
+
+// lock is the slow path shared by all the *Lock methods: it blocks on the
+// condvar until the Mutex can be taken in the given mode.  If ctx is done
+// first, it gives up and returns ctx.Err(), and if the Mutex is shut down
+// first, ErrShutdown.
+func (m *Mutex) lock(ctx context.Context, mode LockMode) (time.Duration, error) {
+	var blockedAt time.Time
+	var ticket uint64
+	var err error
+
+	// Are the current states held compatable with this state?
+	cond := m.condFor(mode)
+	m.mtx.Lock()
+	for !m.tryLock(mode) {
+		if m.isShutdown() {
+			err = ErrShutdown
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		if blockedAt.IsZero() {
+			blockedAt = time.Now()
+			ticket = m.blocked(mode)
+
+			// The condvar can't select on ctx, so have someone wake us up
+			// when it's done.
+			if done := ctx.Done(); done != nil {
+				stop := make(chan struct{})
+				defer close(stop)
+				go m.broadcastOnDone(done, stop)
+			}
+		}
+		cond.Wait() // No! Wait;
+	}
+	if !blockedAt.IsZero() {
+		m.unblocked(mode, ticket)
+	}
+	// If we were woken in preference to waiters in other modes, they'd
+	// otherwise sleep until the next release.
+	if err != nil && m.selectiveWakeups() {
+		m.broadcast()
+	}
+	m.mtx.Unlock()
+	m.runDueCallbacks()
+
+	var d time.Duration
+	if !blockedAt.IsZero() {
+		d = time.Since(blockedAt)
+	}
+	if err == ErrShutdown {
+		return d, err
+	}
+	if err != nil {
+		m.publish(LockEvent{Mutex: m, Mode: mode, Kind: EventTimedOut, Time: time.Now(), Duration: d})
+		return d, err
+	}
+	if d > 0 {
+		m.waited(mode, d)
+	}
+	return d, nil
+}
+
+// tryLock attempts to take the Mutex in the given mode without blocking.
+// Unlike tryRegister, it also applies any admission policies that the Mutex
+// has been configured with, so callers must hold m.mtx.
+func (m *Mutex) tryLock(mode LockMode) bool {
+	if !m.admits(mode) || !m.tryRegister(mode) {
+		return false
+	}
+	if mode == ModeS {
+		m.sGrants++
+	}
+	return true
+}
+
+// admits reports, with m.mtx held, whether the Mutex's admission policies
+// let a new acquisition in the given mode go ahead, whatever the lock state:
+// the Mutex mustn't be shut down, or holding the mode back for the sake of
+// waiting writers, a grace period or a pending upgrade.
+func (m *Mutex) admits(mode LockMode) bool {
+	return !m.isShutdown() && !m.starving(mode) && !m.inGracePeriod(mode) && !m.upgradePending(mode)
+}
+
+// tryAcquire attempts to take the Mutex in the given mode without blocking,
+// without touching m.mtx unless the mode is gated.
+func (m *Mutex) tryAcquire(mode LockMode) bool {
+	if !m.gated(mode) {
+		return m.tryRegister(mode) && m.validate(mode)
+	}
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.tryLock(mode)
+}
+
+// gated reports whether acquisitions in the given mode are subject to an
+// admission policy, and so have to go through tryLock with m.mtx held
+// rather than taking the lock-free fast path.
+//
+// A fast path acquisition that raced with an upgrade being requested may
+// still get in ahead of it, but that only delays the upgrade until the
+// straggler releases.
+func (m *Mutex) gated(mode LockMode) bool {
+	return (mode == ModeS && m.antiStarvation > 0) || (mode == ModeX && m.gracePeriod > 0) ||
+		atomic.LoadInt32(&m.upgrading) > 0
+}
+
+// blocked is called, with m.mtx held, when a goroutine first has to wait to
+// take the lock in the given mode.  The returned ticket must be handed back
+// to unblocked when it stops waiting.
+func (m *Mutex) blocked(mode LockMode) uint64 {
+	atomic.AddInt32(&m.modeWaiters[mode], 1)
+	if v := m.expvars(); v != nil {
+		v.waiters.Add(1)
+		v.contentions.Add(1)
+	}
+	m.publish(LockEvent{Mutex: m, Mode: mode, Kind: EventBlocked, Time: time.Now()})
+	if mode == ModeX && m.antiStarvation > 0 {
+		m.xWaiters = append(m.xWaiters, m.sGrants)
+		return m.sGrants
+	}
+	return 0
+}
+
+// unblocked is called, with m.mtx held, when a goroutine that had been
+// waiting to take the lock in the given mode stops, whether or not it got
+// the lock.
+func (m *Mutex) unblocked(mode LockMode, ticket uint64) {
+	atomic.AddInt32(&m.modeWaiters[mode], -1)
+	if v := m.expvars(); v != nil {
+		v.waiters.Add(-1)
+	}
+	if mode == ModeX && m.antiStarvation > 0 {
+		for i, arrival := range m.xWaiters {
+			if arrival == ticket {
+				m.xWaiters = append(m.xWaiters[:i], m.xWaiters[i+1:]...)
+				break
+			}
+		}
+		// If we gave up, S waiters we were holding back may now proceed.
+		m.broadcast()
+	}
+}
+
+// broadcastOnDone wakes up all waiters once done is closed, so that those
+// whose context has been cancelled can notice.  Returns early if stop is
+// closed first.
+func (m *Mutex) broadcastOnDone(done <-chan struct{}, stop <-chan struct{}) {
+	select {
+	case <-done:
+		m.mtx.Lock()
+		m.wakeAll()
+		m.mtx.Unlock()
+	case <-stop:
+	}
+}
+
+// unlock is shared by all the *Unlock methods: it removes a holder in the
+// given mode and schedules blocked goroutines to run if that could have made
+// their state compatible.
+func (m *Mutex) unlock(mode LockMode) error {
+	if m.policy != nil {
+		m.policy.BeforeRelease(m, mode)
+	}
+	m.mtx.Lock()
+
+	// Forget the X holder's stack while it still holds the lock, so that we
+	// can't clobber the next holder's.
+	if mode == ModeX {
+		m.xTrace.clear()
+		m.xBudget.stop()
+		m.endWrite()
+	}
+	remaining, ok := m.unregister(mode)
+	if !ok {
+		m.mtx.Unlock()
+		return &LockUnderflowError{Mode: mode}
+	}
+
+	if remaining == 0 {
+		m.zeroed(mode)
+	}
+	if m.releaseWakes(mode, remaining) {
+		m.broadcastReleased(mode)
+	}
+	m.mtx.Unlock()
+
+	m.released(mode)
+	return nil
+}
+
+// releaseWakes reports whether releasing a hold in the given mode, leaving
+// remaining holders in it, may have let a waiter in, so that unlock has to
+// broadcast.
+//
+// Compatibility only depends on whether each mode has any holders at all,
+// so if the number of holders of this context has gone to zero, we should
+// see if anyone else can take the lock, but a release that leaves other
+// holders in the same mode can't unblock anyone on its own.  The exceptions
+// are X, where we wake all waiters up unconditionally in order for readers
+// and writers to race on the lock (and which may be k-exclusive, see
+// SetMaxXHolders), and dropping back under a holder limit, where someone in
+// this context may be waiting for our slot.  Anyone watching the lock state
+// needs to hear about every change, as do pending upgrades, which may be
+// waiting for their own hold to be the last one left (see RequestUpgrade).
+func (m *Mutex) releaseWakes(mode LockMode, remaining uint64) bool {
+	return remaining == 0 || mode == ModeX || remaining+1 == uint64(m.limits[mode]) ||
+		atomic.LoadInt32(&m.watchers) > 0 || atomic.LoadInt32(&m.upgrading) > 0
+}
+
+// underLimit reports whether another holder can be registered in the given
+// mode without exceeding the limit set by WithMaxHolders.
+func (m *Mutex) underLimit(mode LockMode, state uint64) bool {
+	limit := m.limits[mode]
+	return limit == 0 || extractMode(mode, state) < uint64(limit)
+}
+
+// acquired is called, without m.mtx held, whenever the Mutex has been taken
+// in the given mode, after having waited for it for the given time.
+func (m *Mutex) acquired(mode LockMode, waited time.Duration) {
+	if m.policy != nil {
+		m.policy.AfterAcquire(m, mode, waited)
+	}
+	// Acquisitions don't otherwise broadcast, but anyone watching the lock
+	// state needs to hear about every change.
+	if atomic.LoadInt32(&m.watchers) > 0 {
+		m.mtx.Lock()
+		m.c.Broadcast()
+		m.mtx.Unlock()
+	}
+	m.granted(mode, waited)
+}
+
+// granted does the bookkeeping for an acquisition in the given mode.  Unlike
+// acquired, it may be called with or without m.mtx held.
+func (m *Mutex) granted(mode LockMode, waited time.Duration) {
+	id := atomic.AddUint64(&m.lastAcquireID, 1)
+	if mode == ModeX {
+		now := time.Now()
+		atomic.StoreInt64(&m.lastXAcquired, now.UnixNano())
+		m.beginWrite()
+		m.xTrace.record()
+		m.xBudget.start(m, now)
+	}
+	m.owners.acquired(mode)
+	m.updateExpvars()
+	if m.watermarkHandler != nil {
+		m.checkWatermark(mode)
+	}
+	if m.stats != nil {
+		m.stats.acquired(mode)
+	}
+	if m.history != nil || m.bus != nil {
+		e := LockEvent{Mutex: m, Mode: mode, Kind: EventAcquired, Time: time.Now(), Duration: waited, AcquireID: id}
+		if m.history != nil {
+			m.history.append(e)
+		}
+		m.publish(e)
+	}
+}
+
+// released is called, without m.mtx held, whenever a holder in the given
+// mode has released the Mutex.
+func (m *Mutex) released(mode LockMode) {
+	m.runDueCallbacks()
+	if m.policy != nil {
+		m.policy.AfterRelease(m, mode)
+	}
+	m.owners.released(mode)
+	m.updateExpvars()
+	if m.watermarkHandler != nil {
+		m.checkWatermark(mode)
+	}
+	if m.stats != nil {
+		m.stats.released(mode)
+	}
+	if m.history != nil || m.bus != nil {
+		e := LockEvent{Mutex: m, Mode: mode, Kind: EventReleased, Time: time.Now()}
+		if m.history != nil {
+			m.history.append(e)
+		}
+		m.publish(e)
+	}
+}
+
+// waited is called after a goroutine had to block for d before taking the
+// lock in the given mode.
+func (m *Mutex) waited(mode LockMode, d time.Duration) {
+	if m.stats != nil {
+		m.stats.waited(mode, d)
+	}
+	if m.starvationHandler != nil && d > m.starvationThreshold {
+		go m.starvationHandler(mode, d)
+	}
+}
+
 // Registers the calling thread as a holder in the IS state.
 // Returns whether this operation is compatible with the
 // previous lock state.
 func (m *Mutex) registerIS() bool {
-	state := m.state
-	m.state = setIS(state, extractIS(state)+1)
-	return compatableWithIS(state)
+	for {
+		state := m.load()
+		if m.cas(state, setIS(state, extractIS(state)+1)) {
+			return compatableWithIS(state) && m.underLimit(ModeIS, state)
+		}
+	}
 }
 
 // Registers the calling thread as a holder in the IX state.
 // Returns whether this operation is compatible with the
 // previous lock state.
 func (m *Mutex) registerIX() bool {
-	state := m.state
-	m.state = setIX(state, extractIX(state)+1)
-	return compatableWithIX(state)
+	for {
+		state := m.load()
+		if m.cas(state, setIX(state, extractIX(state)+1)) {
+			return compatableWithIX(state) && m.underLimit(ModeIX, state)
+		}
+	}
 }
 
 // Registers the calling thread as a holder in the S state.
 // Returns whether this operation is compatible with the
 // previous lock state.
 func (m *Mutex) registerS() bool {
-	state := m.state
-	m.state = setS(state, extractS(state)+1)
-	return compatableWithS(state)
+	for {
+		state := m.load()
+		if m.cas(state, setS(state, extractS(state)+1)) {
+			return compatableWithS(state) && m.underLimit(ModeS, state)
+		}
+	}
 }
 
 // Registers the calling thread as a holder in the X state.
 // Returns whether this operation is compatible with the
 // previous lock state.
 func (m *Mutex) registerX() bool {
-	state := m.state
-	m.state = setX(state, extractX(state)+1)
-	return compatableWithX(state)
+	for {
+		state := m.load()
+		if m.cas(state, setX(state, extractX(state)+1)) {
+			return m.compatible(ModeX, state) && m.underLimit(ModeX, state)
+		}
+	}
 }
 
-// ISLock takes the Mutex for shared read access. Blocks if the lock is
-// currently held in any of the following states:
-// X, IX
-func (m *Mutex) ISLock() {
-	// Are the current states held compatable with this state?
-	m.mtx.Lock()
-	for !compatableWithIS(m.state) {
-		//fmt.Printf("NBT: ISLock has to wait!\n")
-		m.c.Wait() // No! Wait;
-		//fmt.Printf("NBT: ISLock woke up!\n")
+// fastPathISLock attempts to take the Mutex in the IS state without touching
+// m.mtx.  Returns false if the lock is currently held in X, in which case
+// the caller has to fall back to waiting on the condvar.
+//
+// As IS is compatible with everything but X, there's no need for a CAS loop:
+// we optimistically add ourselves to the IS count, and back out again if it
+// turns out that someone holds X.  While we're in the IS count, an X
+// acquisition can't succeed, and a waiter checking the state may decide to
+// go back to sleep on our account, so backing out has to broadcast.  Having
+// got the lock, though, skipping m.mtx can't lose a wakeup: taking a lock
+// never makes another state context compatible, so successful acquisitions
+// never need to broadcast.
+//
+// Nor can a failed attempt be told apart from a real holder while it's in
+// the count, so a successful attempt that sees one can't tell whether it
+// took IS from zero holders, and OnTransition would miss the activation, as
+// well as the drain if the last real holder releases before the failed
+// attempt backs out.  While there are transition callbacks, then, we go by
+// the CAS, which never adds to the count unless it succeeds.
+func (m *Mutex) fastPathISLock() bool {
+	// With a limit, or a count large enough that enough concurrent adds
+	// could overflow into the IX bits, we have to check before adding.  A
+	// StateStore only offers CAS, so we can't add blindly to it at all.
+	if m.store != nil || m.limits[ModeIS] != 0 || extractIS(m.load()) >= isFastPathMax ||
+		atomic.LoadInt32(&m.transitions.n) > 0 {
+		return m.tryRegister(ModeIS)
 	}
-	m.registerIS()
+
+	m.beginChange()
+	state := atomic.AddUint64(&m.state, 1<<isOffset)
+	m.endChange(true)
+	if extractX(state) == 0 {
+		if extractIS(state) == 1 {
+			m.activated(ModeIS, state)
+		}
+		m.observe(ModeIS, true, state-1<<isOffset, state)
+		return true
+	}
+
+	m.beginChange()
+	atomic.AddUint64(&m.state, ^uint64(1<<isOffset-1))
+	m.endChange(true)
+	m.mtx.Lock()
+	m.broadcastReleased(ModeIS)
 	m.mtx.Unlock()
+	return false
 }
 
-// ISUnlock removes the single writer's IS state value and schedule all
-// blocked goroutines to run.
-func (m *Mutex) ISUnlock() {
-	m.mtx.Lock()
+// isFastPathMax is the IS count above which fastPathISLock no longer adds to
+// the count blindly.
+const isFastPathMax = 1 << 15
 
-	currIS := extractIS(m.state)
-	if currIS == 0 {
-		panic("ISUnlock: unlock attempt, but not held!")
-	}
+// fastPathSLock attempts to take the Mutex in the S state without touching
+// m.mtx.  Returns false if the lock is currently held in X or IX.
+func (m *Mutex) fastPathSLock() bool {
+	return m.tryRegister(ModeS)
+}
 
-	currIS--
+// acquire takes the Mutex in the given mode, trying the lock-free fast path
+// first for the modes that have one.
+func (m *Mutex) acquire(ctx context.Context, mode LockMode) error {
+	_, err := m.acquireWaited(ctx, mode)
+	return err
+}
 
-	m.state = setIS(m.state, currIS)
-	// If the number of holders of this context has gone to zero, we should
-	// see if anyone else can take the lock.
-	if currIS == 0 {
-		m.c.Broadcast()
+// acquireWaited is acquire, also reporting whether the caller had to block.
+func (m *Mutex) acquireWaited(ctx context.Context, mode LockMode) (bool, error) {
+	if err := m.beforeAcquire(mode); err != nil {
+		return false, err
 	}
-	m.mtx.Unlock()
+
+	fast := false
+	switch {
+	case m.gated(mode):
+	case mode == ModeIS:
+		fast = m.fastPathISLock()
+	case mode == ModeS:
+		fast = m.fastPathSLock()
+	}
+	if fast && !m.validate(mode) {
+		return false, ErrShutdown
+	}
+	var waited time.Duration
+	if !fast {
+		var err error
+		if waited, err = m.lock(ctx, mode); err != nil {
+			return waited > 0, err
+		}
+	}
+	m.acquired(mode, waited)
+	return waited > 0, nil
 }
 
-// IXLock takes the Mutex for shared read access. Blocks if the lock is
-// currently held in any of the following states:
-// X, S
-func (m *Mutex) IXLock() {
-	// Are the current states held compatable with this state?
-	m.mtx.Lock()
+// mustAcquire takes the Mutex in the given mode, for the lock methods that
+// block indefinitely and so have no way to report failure.  That leaves the
+// Mutex's LockPolicy refusing the acquisition, which is a panic.
+func (m *Mutex) mustAcquire(mode LockMode) {
+	m.mustAcquireWaited(mode)
+}
 
-	for !compatableWithIX(m.state) {
-		//fmt.Printf("NBT: IXLock has to wait!\n")
-		m.c.Wait() // No! Wait;
-		//fmt.Printf("NBT: IXLock woke up!\n")
+// mustAcquireWaited is mustAcquire, also reporting whether the caller had to
+// block.
+func (m *Mutex) mustAcquireWaited(mode LockMode) bool {
+	waited, err := m.acquireWaited(context.Background(), mode)
+	if err != nil {
+		panic(err)
 	}
-	m.registerIX()
+	return waited
+}
 
-	m.mtx.Unlock()
+// ISLock takes the Mutex for shared read access. Blocks if the lock is
+// currently held in any of the following states:
+// X
+func (m *Mutex) ISLock() {
+	m.mustAcquire(ModeIS)
 }
 
-// IXUnlock removes the single writer's IX state value and schedule all
-// blocked goroutines to run.
-func (m *Mutex) IXUnlock() {
-	m.mtx.Lock()
+// ISUnlock removes the single writer's IS state value and schedule all
+// blocked goroutines to run. Returns a *LockUnderflowError if the
+// lock is not held in IS.
+func (m *Mutex) ISUnlock() error {
+	return m.unlock(ModeIS)
+}
 
-	currIX := extractIX(m.state)
-	if currIX == 0 {
-		panic("IXUnlock: unlock attempt, but not held!")
+// ISUnlockMust is like ISUnlock, but panics if the lock is not held in IS.
+func (m *Mutex) ISUnlockMust() {
+	if err := m.ISUnlock(); err != nil {
+		panic(err)
 	}
+}
+
+// IXLock takes the Mutex for shared read access. Blocks if the lock is
+// currently held in any of the following states:
+// X, S
+func (m *Mutex) IXLock() {
+	m.mustAcquire(ModeIX)
+}
 
-	currIX--
+// IXUnlock removes the single writer's IX state value and schedule all
+// blocked goroutines to run. Returns a *LockUnderflowError if the
+// lock is not held in IX.
+func (m *Mutex) IXUnlock() error {
+	return m.unlock(ModeIX)
+}
 
-	m.state = setIX(m.state, currIX)
-	// If the number of holders of this context has gone to zero, we should
-	// see if anyone else can take the lock.
-	if currIX == 0 {
-		m.c.Broadcast()
+// IXUnlockMust is like IXUnlock, but panics if the lock is not held in IX.
+func (m *Mutex) IXUnlockMust() {
+	if err := m.IXUnlock(); err != nil {
+		panic(err)
 	}
-	m.mtx.Unlock()
 }
 
 // SLock takes the Mutex for shared read access. Blocks if the lock is
 // currently held in any of the following states:
 // X, IX
 func (m *Mutex) SLock() {
-	// Are the current states held compatable with this state?
-	m.mtx.Lock()
-
-	//fmt.Fprintf(os.Stderr, "Locking S: X: %x, S: %x -> %x, IS: %x, IX: %x\n", extractX(m.state), extractS(m.state), extractS(m.state)+1, extractIS(m.state), extractIX(m.state))
-
-	for !compatableWithS(m.state) {
-		//fmt.Printf("NBT: SLock has to wait!\n")
-		m.c.Wait() // No! Wait;
-		//fmt.Printf("NBT: SLock woke up!\n")
-	}
-	m.registerS()
-
-	m.mtx.Unlock()
+	m.mustAcquire(ModeS)
 }
 
 // SUnlock decrements the lock's S state value and schedules all
-// blocked goroutines to run.
-func (m *Mutex) SUnlock() {
-	m.mtx.Lock()
-
-	if extractS(m.state) == 0 {
-		panic("SUnlock: unlock attempt, but not held!")
-	}
-
-	val := extractS(m.state) - 1
-	//fmt.Fprintf(os.Stderr, "Unlocking S: X: %x, S: %x -> %x\n", extractX(m.state), extractS(m.state), val)
-	m.state = setS(m.state, val)
+// blocked goroutines to run. Returns a *LockUnderflowError if the
+// lock is not held in S.
+func (m *Mutex) SUnlock() error {
+	return m.unlock(ModeS)
+}
 
-	// If the number of holders of this context has gone to zero, we should
-	// see if anyone else can take the lock.
-	if val == 0 {
-		m.c.Broadcast()
+// SUnlockMust is like SUnlock, but panics if the lock is not held in S.
+func (m *Mutex) SUnlockMust() {
+	if err := m.SUnlock(); err != nil {
+		panic(err)
 	}
-	m.mtx.Unlock()
 }
 
 // XLock takes the Mutex for exclusive write access. Blocks if the lock is
 // currently held in any of the following states:
 // X, S, IS, IX
 func (m *Mutex) XLock() {
-	// Are the current states held compatable with this state?
-	m.mtx.Lock()
-
-	//fmt.Fprintf(os.Stderr, "Locking X: X: %x -> %x, S: %x\n", extractX(m.state), extractX(m.state)+1, extractS(m.state))
-
-	for !compatableWithX(m.state) {
-		//fmt.Printf("NBT: XLock has to wait!\n")
-		m.c.Wait() // No! Wait;
-		//fmt.Printf("NBT: XLock woke up!\n")
-	}
-	m.registerX()
-
-	m.mtx.Unlock()
+	m.mustAcquire(ModeX)
 }
 
 // XUnlock removes the single writer's X state value and schedule all
-// blocked goroutines to run.
-func (m *Mutex) XUnlock() {
-	m.mtx.Lock()
+// blocked goroutines to run. Returns a *LockUnderflowError if the
+// lock is not held in X.
+func (m *Mutex) XUnlock() error {
+	return m.unlock(ModeX)
+}
 
-	if extractX(m.state) == 0 {
-		panic("XUnlock: unlock attempt, but not held!")
+// XUnlockMust is like XUnlock, but panics if the lock is not held in X.
+func (m *Mutex) XUnlockMust() {
+	if err := m.XUnlock(); err != nil {
+		panic(err)
 	}
-
-	val := extractX(m.state) - 1
-	//fmt.Fprintf(os.Stderr, "Unlocking X: X: %x -> %x, S: %x\n", extractX(m.state), val, extractS(m.state))
-	m.state = setX(m.state, val)
-
-	// We need to wake all waiters up unconditionally when we X-unlock,
-	// in order for readers and writers to race on the lock.
-	m.c.Broadcast()
-	m.mtx.Unlock()
 }
@@ -6,6 +6,7 @@ import (
 	"math/rand"
 	"os"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -392,3 +393,172 @@ func TestDrainReads(t *testing.T) {
 
 	}
 }
+
+func TestFastPath(t *testing.T) {
+	m := New()
+	assert.True(t, m.fastPathISLock(), "Failure to take IS on a nascent Mutex")
+	assert.True(t, m.fastPathSLock(), "Failure to take S alongside IS")
+	m.SUnlock()
+	m.ISUnlock()
+
+	m.XLock()
+	assert.False(t, m.fastPathISLock(), "IS fast path ignored an X holder")
+	assert.False(t, m.fastPathSLock(), "S fast path ignored an X holder")
+	m.XUnlock()
+
+	m.IXLock()
+	assert.True(t, m.fastPathISLock(), "Failure to take IS alongside IX")
+	assert.False(t, m.fastPathSLock(), "S fast path ignored an IX holder")
+	m.ISUnlock()
+	m.IXUnlock()
+}
+
+// This test mixes lots of lock-free IS and S acquisitions with the
+// occasional X acquisition, and ensures that no reader ever observes a
+// writer in its critical section (and vice versa).
+func TestFastPathExclusion(t *testing.T) {
+	m := New()
+	var writing int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < mediumConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				switch {
+				case j%100 == i:
+					m.XLock()
+					assert.True(t, atomic.CompareAndSwapInt32(&writing, 0, 1), "Concurrent writers")
+					atomic.StoreInt32(&writing, 0)
+					m.XUnlock()
+				case j%2 == 0:
+					m.ISLock()
+					assert.Equal(t, int32(0), atomic.LoadInt32(&writing), "IS held alongside X")
+					m.ISUnlock()
+				default:
+					m.SLock()
+					assert.Equal(t, int32(0), atomic.LoadInt32(&writing), "S held alongside X")
+					m.SUnlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+}
+
+func TestFastPathISExclusion(t *testing.T) {
+	m := New()
+	var readers, writing int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < mediumConcurrency; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5000; j++ {
+				if i == 0 && j%50 == 0 {
+					m.XLock()
+					atomic.StoreInt32(&writing, 1)
+					assert.Equal(t, int32(0), atomic.LoadInt32(&readers), "X held alongside IS")
+					atomic.StoreInt32(&writing, 0)
+					m.XUnlock()
+					continue
+				}
+				m.ISLock()
+				atomic.AddInt32(&readers, 1)
+				assert.Equal(t, int32(0), atomic.LoadInt32(&writing), "IS held alongside X")
+				atomic.AddInt32(&readers, -1)
+				m.ISUnlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+}
+
+func TestUnlockUnderflow(t *testing.T) {
+	m := New()
+	for _, mode := range modes {
+		assert.Equal(t, &LockUnderflowError{Mode: mode}, m.unlock(mode), "Unlocked %v without holding it", mode)
+	}
+
+	assert.EqualError(t, m.ISUnlock(), "ilock: ISUnlock: unlock attempt, but not held")
+	assert.EqualError(t, m.IXUnlock(), "ilock: IXUnlock: unlock attempt, but not held")
+	assert.EqualError(t, m.SUnlock(), "ilock: SUnlock: unlock attempt, but not held")
+	assert.EqualError(t, m.XUnlock(), "ilock: XUnlock: unlock attempt, but not held")
+
+	assert.Panics(t, m.ISUnlockMust)
+	assert.Panics(t, m.IXUnlockMust)
+	assert.Panics(t, m.SUnlockMust)
+	assert.Panics(t, m.XUnlockMust)
+
+	// An underflow mustn't leave the lock wedged.
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestReleaseWakes(t *testing.T) {
+	m := New(WithMaxHolders(0, 0, 3, 0))
+	for _, tc := range []struct {
+		mode      LockMode
+		remaining uint64
+		wakes     bool
+	}{
+		{ModeX, 0, true},
+		{ModeS, 0, true},
+		{ModeS, 4, false},
+		{ModeIX, 0, true},
+		{ModeIX, 1, false},
+		{ModeIX, 2, true}, // Back under the limit of 3
+		{ModeIS, 0, true},
+		{ModeIS, 1, false},
+	} {
+		assert.Equal(t, tc.wakes, m.releaseWakes(tc.mode, tc.remaining), "%v with %d remaining", tc.mode, tc.remaining)
+	}
+
+	atomic.AddInt32(&m.watchers, 1)
+	assert.True(t, m.releaseWakes(ModeIS, 1), "Watchers not woken")
+}
+
+func TestUnlockWakesWaiters(t *testing.T) {
+	// A waiter for a mode that the held mode blocks gets in once the last
+	// holder leaves, and not before.
+	for _, tc := range []struct {
+		held, blocked LockMode
+		holders       int
+	}{
+		{ModeX, ModeIS, 1},
+		{ModeS, ModeIX, 2},
+		{ModeIX, ModeS, 2},
+		{ModeIS, ModeX, 2},
+	} {
+		m := New()
+		for i := 0; i < tc.holders; i++ {
+			m.Lock(tc.held)
+		}
+		acquired := make(chan bool)
+		go func() {
+			m.Lock(tc.blocked)
+			acquired <- true
+		}()
+		time.Sleep(5 * time.Millisecond)
+
+		for i := 1; i < tc.holders; i++ {
+			assert.NoError(t, m.Unlock(tc.held))
+			select {
+			case <-acquired:
+				t.Fatalf("%v acquired with %v still held", tc.blocked, tc.held)
+			case <-time.After(5 * time.Millisecond):
+			}
+		}
+		assert.NoError(t, m.Unlock(tc.held))
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatalf("%v waiter not woken by the last %v release", tc.blocked, tc.held)
+		}
+	}
+}
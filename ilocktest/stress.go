@@ -0,0 +1,110 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilocktest
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+// StressTest hammers m from the given number of goroutines for duration,
+// checking that the Mutex never lets incompatible modes be held at once.
+// Each goroutine repeatedly takes m in a random mode, holds it briefly and
+// releases it again; writeRatio is the fraction of acquisitions that are in
+// a write mode (X or IX) rather than a read mode (S or IS).
+//
+// Holders are counted independently of the Mutex, and every acquisition is
+// checked against those counts, with any violation reported through t.
+// Running under the race detector checks the Mutex's own bookkeeping too.
+// m must be unheld to begin with, and is left unheld.
+func StressTest(t testing.TB, m *ilock.Mutex, goroutines int, duration time.Duration, writeRatio float64) {
+	var holders [4]int32 // By LockMode
+	var failed int32
+	deadline := time.Now().Add(duration)
+
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for time.Now().Before(deadline) && atomic.LoadInt32(&failed) == 0 {
+				mode := stressMode(r, writeRatio)
+				m.Lock(mode)
+				atomic.AddInt32(&holders[mode], 1)
+
+				if held := incompatibleHeld(mode, &holders); held >= 0 {
+					if atomic.CompareAndSwapInt32(&failed, 0, 1) {
+						t.Errorf("%v granted while %v was held", mode, ilock.LockMode(held))
+					}
+				}
+				runtime.Gosched()
+
+				atomic.AddInt32(&holders[mode], -1)
+				if err := m.Unlock(mode); err != nil && atomic.CompareAndSwapInt32(&failed, 0, 1) {
+					t.Errorf("Unlock(%v): %v", mode, err)
+				}
+			}
+		}(int64(g))
+	}
+	wg.Wait()
+
+	if n := m.HolderCount(); n != 0 {
+		t.Errorf("%d holders left after the stress test", n)
+	}
+}
+
+// stressMode picks the mode for an acquisition.
+func stressMode(r *rand.Rand, writeRatio float64) ilock.LockMode {
+	write := r.Float64() < writeRatio
+	intention := r.Intn(2) == 0
+	switch {
+	case write && intention:
+		return ilock.ModeIX
+	case write:
+		return ilock.ModeX
+	case intention:
+		return ilock.ModeIS
+	}
+	return ilock.ModeS
+}
+
+// incompatibleHeld returns a mode, other than mode itself, that holders
+// counts as held and that is incompatible with mode, or -1 if there are
+// none.  (Whether a mode is compatible with itself depends on how the Mutex
+// was configured, e.g. by SetMaxXHolders, so that isn't checked.)
+func incompatibleHeld(mode ilock.LockMode, holders *[4]int32) int {
+	for held := range holders {
+		if ilock.LockMode(held) == mode {
+			continue
+		}
+		if atomic.LoadInt32(&holders[held]) > 0 && !ilock.Compatible(mode, ilock.LockMode(held)) {
+			return held
+		}
+	}
+	return -1
+}
@@ -0,0 +1,28 @@
+package ilocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStressTest(t *testing.T) {
+	for _, writeRatio := range []float64{0, 0.1, 0.5, 1} {
+		StressTest(t, ilock.New(), 8, 50*time.Millisecond, writeRatio)
+	}
+	StressTest(t, ilock.New(ilock.WithAntiStarvationThreshold(4), ilock.WithMaxHolders(0, 3, 0, 0)),
+		8, 50*time.Millisecond, 0.3)
+}
+
+func TestStressTestCatchesViolations(t *testing.T) {
+	var counts [4]int32
+	counts[ilock.ModeX] = 1
+	assert.Equal(t, int(ilock.ModeX), incompatibleHeld(ilock.ModeS, &counts))
+	assert.Equal(t, -1, incompatibleHeld(ilock.ModeX, &counts), "X against X depends on configuration")
+
+	counts = [4]int32{ilock.ModeIS: 2, ilock.ModeIX: 1}
+	assert.Equal(t, -1, incompatibleHeld(ilock.ModeIS, &counts))
+	assert.Equal(t, int(ilock.ModeIX), incompatibleHeld(ilock.ModeS, &counts))
+}
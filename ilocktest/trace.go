@@ -0,0 +1,156 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package ilocktest provides helpers for testing code built on ilock, and
+// ilock itself.
+package ilocktest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+// TraceGoroutines is the number of goroutines that GenerateLockTrace spreads
+// its operations across.
+const TraceGoroutines = 4
+
+// TraceTimeout is how long ExecuteTrace lets any one acquisition block
+// before deciding that it has deadlocked.
+var TraceTimeout = 10 * time.Second
+
+// LockOp is one step of a lock trace: goroutine GoroutineIdx either takes
+// the Mutex in Mode, or releases a hold in it.
+type LockOp struct {
+	Mode         ilock.LockMode
+	Acquire      bool
+	GoroutineIdx int
+}
+
+func (op LockOp) String() string {
+	verb := "unlock"
+	if op.Acquire {
+		verb = "lock"
+	}
+	return fmt.Sprintf("g%d %s %v", op.GoroutineIdx, verb, op.Mode)
+}
+
+var traceModes = [...]ilock.LockMode{ilock.ModeX, ilock.ModeS, ilock.ModeIX, ilock.ModeIS}
+
+// GenerateLockTrace returns a random, but reproducible for a given seed,
+// trace of up to ops lock and unlock operations spread across
+// TraceGoroutines goroutines.  Each goroutine alternates between taking the
+// Mutex in some mode and releasing it again, and releases everything it
+// takes by the end of the trace.
+//
+// As no goroutine ever waits for the Mutex while holding it, the trace
+// can't deadlock on a correct Mutex, however its goroutines interleave.
+func GenerateLockTrace(seed int64, ops int) []LockOp {
+	r := rand.New(rand.NewSource(seed))
+
+	var held [TraceGoroutines]*ilock.LockMode
+	holding := 0
+
+	trace := make([]LockOp, 0, ops)
+	for i := 0; i < ops; i++ {
+		remaining := ops - i
+
+		// Only take the lock if there's room left to release it, and
+		// everything else that's held, afterwards.
+		g := r.Intn(TraceGoroutines)
+		if held[g] == nil && remaining <= holding+1 {
+			if holding == 0 {
+				break
+			}
+			for held[g] == nil {
+				g = r.Intn(TraceGoroutines)
+			}
+		}
+
+		if mode := held[g]; mode != nil {
+			trace = append(trace, LockOp{Mode: *mode, GoroutineIdx: g})
+			held[g] = nil
+			holding--
+			continue
+		}
+		mode := traceModes[r.Intn(len(traceModes))]
+		trace = append(trace, LockOp{Mode: mode, Acquire: true, GoroutineIdx: g})
+		held[g] = &mode
+		holding++
+	}
+	return trace
+}
+
+// ExecuteTrace runs trace against m, with one goroutine for each
+// GoroutineIdx, each performing its own operations in the order they appear
+// in the trace.  Different goroutines' operations interleave however the
+// scheduler sees fit.  Returns the first error encountered, including any
+// panic, and an acquisition that blocks for longer than TraceTimeout, which
+// is taken to be a deadlock.
+func ExecuteTrace(m *ilock.Mutex, trace []LockOp) error {
+	ops := make(map[int][]int) // Indexes into trace, by goroutine
+	for i, op := range trace {
+		ops[op.GoroutineIdx] = append(ops[op.GoroutineIdx], i)
+	}
+
+	errs := make(chan error, len(ops))
+	var wg sync.WaitGroup
+	for _, indexes := range ops {
+		wg.Add(1)
+		go func(indexes []int) {
+			defer wg.Done()
+			for _, i := range indexes {
+				if err := executeOp(m, trace[i]); err != nil {
+					errs <- fmt.Errorf("op %d (%v): %w", i, trace[i], err)
+					return
+				}
+			}
+		}(indexes)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// executeOp performs a single operation of a trace.
+func executeOp(m *ilock.Mutex, op LockOp) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if !op.Acquire {
+		return m.Unlock(op.Mode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), TraceTimeout)
+	defer cancel()
+	if err := m.LockCtx(ctx, op.Mode); err != nil {
+		if err == context.DeadlineExceeded {
+			return fmt.Errorf("deadlocked after %v", TraceTimeout)
+		}
+		return err
+	}
+	return nil
+}
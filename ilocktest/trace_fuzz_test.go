@@ -0,0 +1,23 @@
+//go:build go1.18
+// +build go1.18
+
+package ilocktest
+
+import (
+	"testing"
+
+	"github.com/dijkstracula/go-ilock"
+	"github.com/stretchr/testify/assert"
+)
+
+// FuzzExecuteTrace runs generated traces against a fresh Mutex, which must
+// get through them without error and end up unheld.
+func FuzzExecuteTrace(f *testing.F) {
+	f.Add(int64(0), uint16(100))
+	f.Add(int64(1), uint16(1000))
+	f.Fuzz(func(t *testing.T, seed int64, ops uint16) {
+		m := ilock.New()
+		assert.NoError(t, ExecuteTrace(m, GenerateLockTrace(seed, int(ops))))
+		assert.Equal(t, 0, m.HolderCount())
+	})
+}
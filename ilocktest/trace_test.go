@@ -0,0 +1,58 @@
+package ilocktest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateLockTrace(t *testing.T) {
+	assert.Equal(t, GenerateLockTrace(42, 100), GenerateLockTrace(42, 100))
+	assert.NotEqual(t, GenerateLockTrace(42, 100), GenerateLockTrace(43, 100))
+	assert.Empty(t, GenerateLockTrace(42, 0))
+	assert.Empty(t, GenerateLockTrace(42, 1), "A single op can't be released")
+
+	for seed := int64(0); seed < 100; seed++ {
+		trace := GenerateLockTrace(seed, 51)
+		assert.True(t, len(trace) >= 50, "Trace for seed %d only has %d ops", seed, len(trace))
+
+		// Every goroutine alternates between taking the lock and
+		// releasing the same mode, and ends up holding nothing.
+		var held [TraceGoroutines]*LockOp
+		for i := range trace {
+			op := &trace[i]
+			assert.True(t, op.GoroutineIdx >= 0 && op.GoroutineIdx < TraceGoroutines)
+			if prev := held[op.GoroutineIdx]; prev != nil {
+				assert.False(t, op.Acquire, "seed %d, op %d: %v while holding", seed, i, op)
+				assert.Equal(t, prev.Mode, op.Mode, "seed %d, op %d: released the wrong mode", seed, i)
+				held[op.GoroutineIdx] = nil
+			} else {
+				assert.True(t, op.Acquire, "seed %d, op %d: %v while not holding", seed, i, op)
+				held[op.GoroutineIdx] = op
+			}
+		}
+		assert.Equal(t, [TraceGoroutines]*LockOp{}, held, "seed %d: trace not balanced", seed)
+	}
+}
+
+func TestExecuteTrace(t *testing.T) {
+	for seed := int64(0); seed < 20; seed++ {
+		m := ilock.New()
+		assert.NoError(t, ExecuteTrace(m, GenerateLockTrace(seed, 1000)), "seed %d", seed)
+		assert.Equal(t, 0, m.HolderCount(), "seed %d: lock still held after the trace", seed)
+	}
+}
+
+func TestExecuteTraceErrors(t *testing.T) {
+	m := ilock.New()
+	err := ExecuteTrace(m, []LockOp{{Mode: ilock.ModeS}})
+	assert.EqualError(t, err, "op 0 (g0 unlock S): ilock: SUnlock: unlock attempt, but not held")
+
+	defer func(timeout time.Duration) { TraceTimeout = timeout }(TraceTimeout)
+	TraceTimeout = 5 * time.Millisecond
+	m.XLock()
+	err = ExecuteTrace(m, []LockOp{{Mode: ilock.ModeIS, Acquire: true, GoroutineIdx: 1}})
+	assert.EqualError(t, err, "op 0 (g1 lock IS): deadlocked after 5ms")
+}
@@ -0,0 +1,289 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// LockState is the number of goroutines holding a Mutex in each mode.
+type LockState struct {
+	X, S, IX, IS uint16
+}
+
+// lockState unpacks a state word.
+func lockState(state uint64) LockState {
+	return LockState{
+		X:  uint16(extractMode(ModeX, state)),
+		S:  uint16(extractMode(ModeS, state)),
+		IX: uint16(extractMode(ModeIX, state)),
+		IS: uint16(extractMode(ModeIS, state)),
+	}
+}
+
+// packed returns the state word that s was unpacked from.
+func (s LockState) packed() uint64 {
+	state := setMode(ModeX, 0, uint64(s.X))
+	state = setMode(ModeS, state, uint64(s.S))
+	state = setMode(ModeIX, state, uint64(s.IX))
+	return setMode(ModeIS, state, uint64(s.IS))
+}
+
+func (m *Mutex) extractState() LockState {
+	return lockState(m.load())
+}
+
+// LockInspection is everything observable about a Mutex at some moment; see
+// Inspect.
+type LockInspection struct {
+	State       LockState
+	Waiters     int // Goroutines blocked waiting to take the Mutex
+	Name        string
+	Annotations map[string]string // Set with Annotate
+	Shutdown    bool              // Whether GracefulShutdown has been called
+
+	// LastAcquiredAt is when the Mutex was last taken in X, and
+	// LockedDuration how long ago that was if it's still held in X.
+	LastAcquiredAt time.Time
+	LockedDuration time.Duration
+}
+
+// Annotate attaches a key/value pair to the Mutex, to be reported by
+// Inspect, e.g. to record what the Mutex is protecting.  An empty value
+// removes the key.
+func (m *Mutex) Annotate(key, value string) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if value == "" {
+		delete(m.annotations, key)
+		return
+	}
+	if m.annotations == nil {
+		m.annotations = make(map[string]string)
+	}
+	m.annotations[key] = value
+}
+
+// Inspect gathers up the Mutex's state for diagnostics, e.g. from an admin
+// HTTP handler.  It's taken under the Mutex's internal lock, so it's
+// consistent with respect to anything that blocks, but uncontended
+// acquisitions may still come and go while it runs.
+func (m *Mutex) Inspect() LockInspection {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	li := LockInspection{
+		State:    m.extractState(),
+		Waiters:  m.waitQueueLen(),
+		Name:     m.name,
+		Shutdown: m.isShutdown(),
+	}
+	if len(m.annotations) > 0 {
+		li.Annotations = make(map[string]string, len(m.annotations))
+		for k, v := range m.annotations {
+			li.Annotations[k] = v
+		}
+	}
+	if ns := atomic.LoadInt64(&m.lastXAcquired); ns != 0 {
+		li.LastAcquiredAt = time.Unix(0, ns)
+		if li.State.X > 0 {
+			li.LockedDuration = time.Since(li.LastAcquiredAt)
+		}
+	}
+	return li
+}
+
+// NumWaiters returns the number of goroutines blocked waiting to take the
+// Mutex in the given mode.
+func (m *Mutex) NumWaiters(mode LockMode) int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return int(m.modeWaiters[mode])
+}
+
+// WaitQueueLen returns the number of goroutines blocked waiting to take the
+// Mutex in any mode.
+func (m *Mutex) WaitQueueLen() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.waitQueueLen()
+}
+
+func (m *Mutex) waitQueueLen() int {
+	n := 0
+	for _, waiters := range m.modeWaiters {
+		n += int(waiters)
+	}
+	return n
+}
+
+// HolderCount returns the total number of holders of the Mutex across all
+// modes, e.g. for choosing the least contended of several Mutexes.  The
+// total is taken from a single read of the lock state, so it is consistent
+// even while holders come and go.
+func (m *Mutex) HolderCount() int {
+	state := m.load()
+	n := 0
+	for _, mode := range modes {
+		n += int(extractMode(mode, state))
+	}
+	return n
+}
+
+// holderWeights weights each mode by how exclusive it is, for NumHolders.
+var holderWeights = [4]int{ModeX: 4, ModeS: 2, ModeIX: 2, ModeIS: 1}
+
+// NumHolders returns the number of holders of the Mutex, weighted by how
+// exclusive their modes are: each X holder counts 4, each S or IX holder 2,
+// and each IS holder 1.  It's a single "lock pressure" figure, suited to
+// alerting, where one X holder shutting everyone out is more concerning
+// than four IS holders that let almost anyone in.  For capacity questions,
+// e.g. picking the least busy of several Mutexes, the plain count returned
+// by HolderCount is the better fit.  Like HolderCount, it is taken from a
+// single read of the lock state.
+func (m *Mutex) NumHolders() int {
+	state := m.load()
+	n := 0
+	for _, mode := range modes {
+		n += holderWeights[mode] * int(extractMode(mode, state))
+	}
+	return n
+}
+
+// LastAcquireID returns the ID of the most recent acquisition of the Mutex,
+// in any mode.  IDs count up from 1 with every acquisition, wrapping around
+// on overflow, and are also recorded in Acquired LockEvents, so that logging
+// the ID alongside work done under the lock ties it to the acquisition in a
+// trace.  Called straight after taking the Mutex in X, it returns the ID of
+// the caller's own acquisition, which stays current until they release; in
+// the shared modes, another goroutine may have acquired in between.
+func (m *Mutex) LastAcquireID() uint64 {
+	return atomic.LoadUint64(&m.lastAcquireID)
+}
+
+// IsShared reports whether the Mutex is currently held in S.
+func (m *Mutex) IsShared() bool {
+	return extractS(m.load()) > 0
+}
+
+// IsExclusive reports whether the Mutex is currently held in X.
+func (m *Mutex) IsExclusive() bool {
+	return extractX(m.load()) > 0
+}
+
+// IsIntentionShared reports whether the Mutex is currently held in IS.
+func (m *Mutex) IsIntentionShared() bool {
+	return extractIS(m.load()) > 0
+}
+
+// IsIntentionExclusive reports whether the Mutex is currently held in IX.
+func (m *Mutex) IsIntentionExclusive() bool {
+	return extractIX(m.load()) > 0
+}
+
+// IsAnyIntention reports whether the Mutex is currently held in either of
+// the intention modes.
+func (m *Mutex) IsAnyIntention() bool {
+	state := m.load()
+	return extractIS(state) > 0 || extractIX(state) > 0
+}
+
+// Contended reports whether any goroutine is blocked waiting to take the
+// Mutex, e.g. for logging that a lock is hot.  It doesn't take the Mutex's
+// internal lock, so it's cheap, but only a best-effort snapshot: waiters
+// may come or go by the time it returns.
+func (m *Mutex) Contended() bool {
+	for mode := range m.modeWaiters {
+		if atomic.LoadInt32(&m.modeWaiters[mode]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ContendedFor is like Contended, but only considers goroutines waiting to
+// take the Mutex in the given mode.
+func (m *Mutex) ContendedFor(mode LockMode) bool {
+	return atomic.LoadInt32(&m.modeWaiters[mode]) > 0
+}
+
+// EqualState reports whether m and other are held in the same modes by the
+// same number of goroutines, e.g. for tests that drive two Mutexes through
+// the same operations.  Both internal locks are held, taken in order of ID,
+// while the states are read, so the comparison is consistent with respect
+// to anything that blocks; as with Inspect, uncontended acquisitions may
+// still come and go.
+func (m *Mutex) EqualState(other *Mutex) bool {
+	if m == other {
+		return true
+	}
+	s1, s2 := loadBoth(m, other)
+	return s1 == s2
+}
+
+// IsCompatibleWith reports whether the current states of m1 and m2 could be
+// merged into a single consistent lock state: that is, whether every mode
+// either is held in is compatible with every mode the other is held in, so
+// that there's no exclusive conflict between them.  It's meant for
+// validating multi-lock critical sections, e.g. that a goroutine about to
+// work across two nodes isn't doing so while one of them is held
+// exclusively.  The states are read as EqualState reads them.
+func IsCompatibleWith(m1, m2 *Mutex) bool {
+	if m1 == m2 {
+		return true
+	}
+	s1, s2 := loadBoth(m1, m2)
+	for _, a := range modes {
+		if extractMode(a, s1) == 0 {
+			continue
+		}
+		for _, b := range modes {
+			if extractMode(b, s2) != 0 && !Compatible(a, b) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// loadBoth reads the states of two distinct Mutexes with both their
+// internal locks held, taken in order of ID so that concurrent callers
+// can't deadlock.
+func loadBoth(m1, m2 *Mutex) (uint64, uint64) {
+	first, second := m1, m2
+	if second.id < first.id {
+		first, second = second, first
+	}
+	first.mtx.Lock()
+	defer first.mtx.Unlock()
+	second.mtx.Lock()
+	defer second.mtx.Unlock()
+	return m1.load(), m2.load()
+}
+
+// StateEquals reports whether the Mutex is held by exactly the given number
+// of goroutines in each mode.
+func (m *Mutex) StateEquals(x, s, ix, is uint16) bool {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.load() == LockState{X: x, S: s, IX: ix, IS: is}.packed()
+}
@@ -0,0 +1,206 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspect(t *testing.T) {
+	m := New(WithName("inspected"))
+	defer DefaultRegistry().Unregister(m)
+
+	li := m.Inspect()
+	assert.Equal(t, LockInspection{Name: "inspected"}, li)
+
+	m.Annotate("protects", "widgets")
+	m.Annotate("scratch", "x")
+	m.Annotate("scratch", "")
+	before := time.Now()
+	m.XLock()
+
+	go m.SLock()
+	time.Sleep(5 * time.Millisecond)
+
+	li = m.Inspect()
+	assert.Equal(t, LockState{X: 1}, li.State)
+	assert.Equal(t, 1, li.Waiters)
+	assert.Equal(t, map[string]string{"protects": "widgets"}, li.Annotations)
+	assert.False(t, li.LastAcquiredAt.Before(before))
+	assert.True(t, li.LockedDuration >= 5*time.Millisecond)
+
+	// The annotations are a copy.
+	li.Annotations["protects"] = "gadgets"
+	assert.Equal(t, "widgets", m.Inspect().Annotations["protects"])
+
+	assert.NoError(t, m.XUnlock())
+	time.Sleep(5 * time.Millisecond)
+	li = m.Inspect()
+	assert.Equal(t, LockState{S: 1}, li.State)
+	assert.Equal(t, 0, li.Waiters)
+	assert.Equal(t, time.Duration(0), li.LockedDuration)
+}
+
+func TestNumWaiters(t *testing.T) {
+	m := New()
+	m.XLock()
+
+	go m.SLock()
+	go m.SLock()
+	go m.ISLock()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.Equal(t, 0, m.NumWaiters(ModeX))
+	assert.Equal(t, 2, m.NumWaiters(ModeS))
+	assert.Equal(t, 0, m.NumWaiters(ModeIX))
+	assert.Equal(t, 1, m.NumWaiters(ModeIS))
+	assert.Equal(t, 3, m.WaitQueueLen())
+
+	assert.NoError(t, m.XUnlock())
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 0, m.WaitQueueLen())
+	assert.Equal(t, setIS(setS(0, 2), 1), m.load())
+}
+
+func TestContended(t *testing.T) {
+	m := New()
+	assert.False(t, m.Contended())
+	m.XLock()
+	assert.False(t, m.Contended(), "Holding isn't contention")
+
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.True(t, m.Contended())
+	assert.True(t, m.ContendedFor(ModeS))
+	assert.False(t, m.ContendedFor(ModeX))
+
+	assert.NoError(t, m.XUnlock())
+	<-acquired
+	assert.False(t, m.Contended())
+	assert.False(t, m.ContendedFor(ModeS))
+}
+
+func TestHolderCount(t *testing.T) {
+	m := New()
+	assert.Equal(t, 0, m.HolderCount())
+
+	m.IXLock()
+	m.IXLock()
+	m.ISLock()
+	assert.Equal(t, 3, m.HolderCount())
+
+	assert.NoError(t, m.IXUnlock())
+	assert.NoError(t, m.IXUnlock())
+	m.SLock()
+	assert.Equal(t, 2, m.HolderCount())
+}
+
+func TestNumHolders(t *testing.T) {
+	m := New()
+	assert.Equal(t, 0, m.NumHolders())
+
+	m.IXLock()
+	m.ISLock()
+	m.ISLock()
+	assert.Equal(t, 4, m.NumHolders())
+	assert.Equal(t, 3, m.HolderCount())
+
+	assert.NoError(t, m.IXUnlock())
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.ISUnlock())
+	m.XLock()
+	assert.Equal(t, 4, m.NumHolders())
+	assert.Equal(t, 1, m.HolderCount())
+}
+
+func TestModePredicates(t *testing.T) {
+	m := New()
+	predicates := func() []bool {
+		return []bool{m.IsExclusive(), m.IsShared(), m.IsIntentionExclusive(), m.IsIntentionShared(), m.IsAnyIntention()}
+	}
+	assert.Equal(t, []bool{false, false, false, false, false}, predicates())
+
+	m.XLock()
+	assert.Equal(t, []bool{true, false, false, false, false}, predicates())
+	assert.NoError(t, m.XUnlock())
+
+	m.SLock()
+	m.ISLock()
+	assert.Equal(t, []bool{false, true, false, true, true}, predicates())
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.ISUnlock())
+
+	m.IXLock()
+	assert.Equal(t, []bool{false, false, true, false, true}, predicates())
+}
+
+func TestEqualState(t *testing.T) {
+	a, b := New(), New()
+	assert.True(t, a.EqualState(b))
+	assert.True(t, a.EqualState(a))
+
+	a.IXLock()
+	a.ISLock()
+	assert.False(t, a.EqualState(b))
+	assert.False(t, b.EqualState(a))
+
+	b.ISLock()
+	b.IXLock()
+	assert.True(t, a.EqualState(b))
+	assert.True(t, b.EqualState(a))
+
+	assert.True(t, a.StateEquals(0, 0, 1, 1))
+	assert.False(t, a.StateEquals(0, 0, 1, 0))
+	assert.True(t, New().StateEquals(0, 0, 0, 0))
+}
+
+func TestIsCompatibleWith(t *testing.T) {
+	a, b := New(), New()
+	assert.True(t, IsCompatibleWith(a, b))
+
+	a.ISLock()
+	b.IXLock()
+	assert.True(t, IsCompatibleWith(a, b))
+	assert.True(t, IsCompatibleWith(b, a))
+
+	a.SLock()
+	assert.False(t, IsCompatibleWith(a, b), "S on one and IX on the other conflict")
+	assert.False(t, IsCompatibleWith(b, a))
+	assert.NoError(t, b.IXUnlock())
+	assert.True(t, IsCompatibleWith(a, b))
+
+	b.XLock()
+	assert.False(t, IsCompatibleWith(a, b))
+	assert.True(t, IsCompatibleWith(b, b), "A Mutex is always consistent with itself")
+}
+
+func TestLastAcquireID(t *testing.T) {
+	m := New(WithHistory(8))
+	assert.Equal(t, uint64(0), m.LastAcquireID())
+
+	m.ISLock()
+	assert.Equal(t, uint64(1), m.LastAcquireID())
+	m.IXLock()
+	assert.Equal(t, uint64(2), m.LastAcquireID())
+	assert.NoError(t, m.IXUnlock())
+	assert.NoError(t, m.ISUnlock())
+	assert.Equal(t, uint64(2), m.LastAcquireID(), "Releases shouldn't change the ID")
+
+	m.XLock()
+	assert.Equal(t, uint64(3), m.LastAcquireID())
+
+	var ids []uint64
+	for _, e := range m.History() {
+		if e.Kind == EventAcquired {
+			ids = append(ids, e.AcquireID)
+		} else {
+			assert.Zero(t, e.AcquireID)
+		}
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, ids)
+}
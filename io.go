@@ -0,0 +1,64 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "io"
+
+// LockedReader is an io.Reader that holds a Mutex in IS for the duration of
+// each Read from the underlying reader, e.g. for streaming out of a buffer
+// that belongs to a tree node.
+type LockedReader struct {
+	r io.Reader
+	m *Mutex
+}
+
+// NewLockedReader returns a LockedReader reading from r under m.
+func NewLockedReader(r io.Reader, m *Mutex) *LockedReader {
+	return &LockedReader{r: r, m: m}
+}
+
+// Read implements io.Reader.  The lock is released even if the underlying
+// Read panics.
+func (lr *LockedReader) Read(p []byte) (int, error) {
+	lr.m.ISLock()
+	defer lr.m.ISUnlockMust()
+	return lr.r.Read(p)
+}
+
+// LockedWriter is an io.Writer that holds a Mutex in IX for the duration of
+// each Write to the underlying writer.
+type LockedWriter struct {
+	w io.Writer
+	m *Mutex
+}
+
+// NewLockedWriter returns a LockedWriter writing to w under m.
+func NewLockedWriter(w io.Writer, m *Mutex) *LockedWriter {
+	return &LockedWriter{w: w, m: m}
+}
+
+// Write implements io.Writer.  The lock is released even if the underlying
+// Write panics.
+func (lw *LockedWriter) Write(p []byte) (int, error) {
+	lw.m.IXLock()
+	defer lw.m.IXUnlockMust()
+	return lw.w.Write(p)
+}
@@ -0,0 +1,67 @@
+package ilock
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockChecker is a reader and writer that records the lock state it sees.
+type lockChecker struct {
+	m     *Mutex
+	seen  uint64
+	panic bool
+}
+
+func (c *lockChecker) Read(p []byte) (int, error) {
+	c.seen = c.m.load()
+	if c.panic {
+		panic("read")
+	}
+	return 0, nil
+}
+
+func (c *lockChecker) Write(p []byte) (int, error) {
+	c.seen = c.m.load()
+	if c.panic {
+		panic("write")
+	}
+	return len(p), nil
+}
+
+func TestLockedReader(t *testing.T) {
+	m := New()
+	data, err := ioutil.ReadAll(NewLockedReader(strings.NewReader("hello"), m))
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Equal(t, uint64(0), m.load())
+
+	c := &lockChecker{m: m}
+	NewLockedReader(c, m).Read(nil)
+	assert.Equal(t, setIS(0, 1), c.seen)
+
+	c.panic = true
+	assert.Panics(t, func() { NewLockedReader(c, m).Read(nil) })
+	assert.Equal(t, uint64(0), m.load(), "Panicking Read leaked the lock")
+}
+
+func TestLockedWriter(t *testing.T) {
+	m := New()
+	var buf bytes.Buffer
+	n, err := NewLockedWriter(&buf, m).Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.Equal(t, "hello", buf.String())
+	assert.Equal(t, uint64(0), m.load())
+
+	c := &lockChecker{m: m}
+	NewLockedWriter(c, m).Write(nil)
+	assert.Equal(t, setIX(0, 1), c.seen)
+
+	c.panic = true
+	assert.Panics(t, func() { NewLockedWriter(c, m).Write(nil) })
+	assert.Equal(t, uint64(0), m.load(), "Panicking Write leaked the lock")
+}
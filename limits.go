@@ -0,0 +1,78 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "errors"
+
+// ErrHolderLimitExceeded is returned by error-returning acquisitions that
+// failed because the mode already has as many holders as WithMaxHolders
+// allows, even though it is compatible with the current lock state.
+var ErrHolderLimitExceeded = errors.New("ilock: holder limit exceeded")
+
+// WithMaxHolders limits how many goroutines may hold the Mutex in each mode
+// at once, over and above what the compatibility matrix permits.  A limit of
+// 0 leaves that mode bounded only by the 16-bit holder count.  Goroutines
+// that would exceed a limit block until a holder in that mode releases.
+//
+// This is useful for e.g. bounding the number of concurrent readers of a
+// connection pool.
+func WithMaxHolders(x, s, ix, is uint16) Option {
+	return func(m *Mutex) {
+		m.limits[ModeX] = x
+		m.limits[ModeS] = s
+		m.limits[ModeIX] = ix
+		m.limits[ModeIS] = is
+	}
+}
+
+// SetMaxHolders changes the holder limit for a single mode, as WithMaxHolders
+// would have set it.  Holder limits are read without taking any locks, so
+// SetMaxHolders must not be called while other goroutines may be using the
+// Mutex.
+func (m *Mutex) SetMaxHolders(mode LockMode, n uint16) {
+	m.limits[mode] = n
+}
+
+// SetMaxXHolders allows up to n goroutines to hold the Mutex in X at once,
+// making it a k-exclusive lock: X still excludes every other mode, but no
+// longer excludes itself.  The default, and n of 0 or 1, is the usual single
+// writer.  As with SetMaxHolders, it must not be called while other
+// goroutines may be using the Mutex.
+//
+// Some features assume that there is at most one X holder, and don't give
+// meaningful results with more: XHolderStack, TransferX, WithXHoldBudget,
+// and the sequence numbers of SeqBegin.
+func (m *Mutex) SetMaxXHolders(n uint16) {
+	if n <= 1 {
+		n = 0
+	}
+	m.maxX = n
+}
+
+// compatible reports whether the Mutex can be taken in the given mode on top
+// of state, according to the compatibility matrix, as modified by
+// SetMaxXHolders.
+func (m *Mutex) compatible(mode LockMode, state uint64) bool {
+	if mode == ModeX && m.maxX != 0 {
+		return setX(state, 0) == 0 && extractX(state) < uint64(m.maxX)
+	}
+	return compatableWithMode(mode, state)
+}
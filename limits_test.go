@@ -0,0 +1,99 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterRespectsLimits(t *testing.T) {
+	m := New(WithMaxHolders(0, 2, 0, 1))
+	assert.True(t, m.registerS(), "Failure to register S under the limit")
+	assert.True(t, m.registerS(), "Failure to register S up to the limit")
+	assert.False(t, m.registerS(), "Registered S beyond the limit")
+
+	assert.True(t, m.registerIS(), "Failure to register IS up to the limit")
+	assert.False(t, m.registerIS(), "Registered IS beyond the limit")
+}
+
+func TestMaxHoldersBlocks(t *testing.T) {
+	m := New(WithMaxHolders(0, 2, 0, 0))
+	m.SLock()
+	m.SLock()
+
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("Exceeded the S holder limit")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Dropping back under the limit has to wake the waiter, even though
+	// there are still S holders.
+	assert.NoError(t, m.SUnlock())
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Waiter never woke up after S dropped under the limit")
+	}
+
+	assert.Equal(t, uint64(2), extractS(m.load()))
+}
+
+func TestHolderLimitExceeded(t *testing.T) {
+	m := New(WithMaxHolders(0, 0, 0, 1), WithRetryPolicy(NoRetryPolicy{}))
+	assert.NoError(t, m.LockRetry(ModeIS))
+	assert.Equal(t, ErrHolderLimitExceeded, m.LockRetry(ModeIS))
+	assert.NoError(t, m.ISUnlock())
+
+	m.XLock()
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeIS))
+}
+
+func TestSetMaxHolders(t *testing.T) {
+	m := New(WithRetryPolicy(NoRetryPolicy{}))
+	m.SetMaxHolders(ModeIS, 1)
+	assert.NoError(t, m.LockRetry(ModeIS))
+	assert.Equal(t, ErrHolderLimitExceeded, m.LockRetry(ModeIS))
+	assert.NoError(t, m.LockRetry(ModeS), "Limits on other modes were changed")
+}
+
+func TestSetMaxXHolders(t *testing.T) {
+	m := New(WithRetryPolicy(NoRetryPolicy{}))
+	m.SetMaxXHolders(2)
+
+	assert.NoError(t, m.LockRetry(ModeX))
+	assert.NoError(t, m.LockRetry(ModeX))
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeX), "Took X beyond the cap")
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeIS), "X no longer excludes IS")
+	assert.Equal(t, setX(0, 2), m.load())
+
+	blocked := make(chan bool)
+	go func() {
+		m.XLock()
+		blocked <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, m.XUnlock())
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("X waiter not woken by a release below the cap")
+	}
+	assert.NoError(t, m.XUnlock())
+	assert.NoError(t, m.XUnlock())
+
+	m.SLock()
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeX), "S no longer excludes X")
+	assert.NoError(t, m.SUnlock())
+
+	m.SetMaxXHolders(1)
+	assert.NoError(t, m.LockRetry(ModeX))
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeX))
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.24
+// +build go1.24
+
+// Package lockedmap implements a concurrent map on top of ilock, as an
+// example of intention locking applied to a sharded data structure.
+//
+// The package needs hash/maphash.Comparable, and so Go 1.24 or later.
+package lockedmap
+
+import (
+	"hash/maphash"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+// numBuckets is the number of shards the map is split into.
+const numBuckets = 64
+
+// LockedMap is a map that is safe for concurrent use.  It is split into
+// buckets, each guarded by its own Mutex, under a root Mutex for the map as
+// a whole: lookups and updates take the root in an intention mode and only
+// their key's bucket outright, so they only contend with operations on the
+// same bucket, while a Scan takes the root in S and so sees a consistent
+// snapshot of every bucket at once.
+//
+// The zero LockedMap is not usable; use New.
+type LockedMap[K comparable, V any] struct {
+	root    *ilock.Mutex
+	seed    maphash.Seed
+	buckets [numBuckets]bucket[K, V]
+}
+
+type bucket[K comparable, V any] struct {
+	m     *ilock.Mutex
+	items map[K]V
+}
+
+// New returns an empty LockedMap.
+func New[K comparable, V any]() *LockedMap[K, V] {
+	lm := &LockedMap[K, V]{
+		root: ilock.New(),
+		seed: maphash.MakeSeed(),
+	}
+	for i := range lm.buckets {
+		lm.buckets[i] = bucket[K, V]{m: ilock.New(), items: make(map[K]V)}
+	}
+	return lm
+}
+
+// path returns the lock path down to key's bucket, along with the bucket.
+func (lm *LockedMap[K, V]) path(key K) (ilock.LockPath, *bucket[K, V]) {
+	b := &lm.buckets[maphash.Comparable(lm.seed, key)%numBuckets]
+	return ilock.LockPath{lm.root, b.m}, b
+}
+
+// Get returns the value stored under key, and whether there was one.
+func (lm *LockedMap[K, V]) Get(key K) (V, bool) {
+	p, b := lm.path(key)
+	p.SLock()
+	defer p.SUnlock()
+	val, ok := b.items[key]
+	return val, ok
+}
+
+// Set stores val under key.
+func (lm *LockedMap[K, V]) Set(key K, val V) {
+	p, b := lm.path(key)
+	p.XLock()
+	defer p.XUnlock()
+	b.items[key] = val
+}
+
+// Delete removes the value stored under key, if any.
+func (lm *LockedMap[K, V]) Delete(key K) {
+	p, b := lm.path(key)
+	p.XLock()
+	defer p.XUnlock()
+	delete(b.items, key)
+}
+
+// Scan calls fn for each key and value in the map, in no particular order,
+// until fn returns false.  The map can't be modified while Scan runs, so fn
+// must not call Set or Delete.
+func (lm *LockedMap[K, V]) Scan(fn func(K, V) bool) {
+	lm.root.SLock()
+	defer lm.root.SUnlock()
+	for i := range lm.buckets {
+		for k, v := range lm.buckets[i].items {
+			if !fn(k, v) {
+				return
+			}
+		}
+	}
+}
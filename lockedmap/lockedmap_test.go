@@ -0,0 +1,168 @@
+//go:build go1.24
+// +build go1.24
+
+package lockedmap
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockedMap(t *testing.T) {
+	lm := New[string, int]()
+	_, ok := lm.Get("a")
+	assert.False(t, ok)
+
+	for i := 0; i < 1000; i++ {
+		lm.Set(strconv.Itoa(i), i)
+	}
+	val, ok := lm.Get("42")
+	assert.True(t, ok)
+	assert.Equal(t, 42, val)
+
+	lm.Delete("42")
+	_, ok = lm.Get("42")
+	assert.False(t, ok)
+
+	seen := make(map[string]int)
+	lm.Scan(func(k string, v int) bool {
+		seen[k] = v
+		return true
+	})
+	assert.Len(t, seen, 999)
+	assert.Equal(t, 7, seen["7"])
+
+	n := 0
+	lm.Scan(func(string, int) bool {
+		n++
+		return n < 10
+	})
+	assert.Equal(t, 10, n, "Scan didn't stop when asked")
+}
+
+func TestLockedMapScanExcludesWriters(t *testing.T) {
+	lm := New[int, int]()
+	lm.Set(1, 1)
+
+	set := make(chan bool)
+	lm.Scan(func(int, int) bool {
+		go func() {
+			lm.Set(2, 2)
+			set <- true
+		}()
+		select {
+		case <-set:
+			t.Error("Set ran during a Scan")
+		case <-time.After(5 * time.Millisecond):
+		}
+
+		// Readers aren't held up.
+		_, ok := lm.Get(1)
+		assert.True(t, ok)
+		return true
+	})
+	<-set
+}
+
+func TestLockedMapConcurrent(t *testing.T) {
+	lm := New[int, int]()
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				lm.Set(g*1000+i, i)
+				val, ok := lm.Get(g*1000 + i)
+				assert.True(t, ok)
+				assert.Equal(t, i, val)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	n := 0
+	lm.Scan(func(int, int) bool {
+		n++
+		return true
+	})
+	assert.Equal(t, 8000, n)
+}
+
+// rwMutexMap is the obvious alternative: a map under a single RWMutex.
+type rwMutexMap struct {
+	mtx   sync.RWMutex
+	items map[int]int
+}
+
+func (m *rwMutexMap) Get(key int) (int, bool) {
+	m.mtx.RLock()
+	defer m.mtx.RUnlock()
+	val, ok := m.items[key]
+	return val, ok
+}
+
+func (m *rwMutexMap) Set(key, val int) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.items[key] = val
+}
+
+// syncMap adapts sync.Map to the same interface.
+type syncMap struct {
+	m sync.Map
+}
+
+func (m *syncMap) Get(key int) (int, bool) {
+	val, ok := m.m.Load(key)
+	if !ok {
+		return 0, false
+	}
+	return val.(int), true
+}
+
+func (m *syncMap) Set(key, val int) {
+	m.m.Store(key, val)
+}
+
+type intMap interface {
+	Get(key int) (int, bool)
+	Set(key, val int)
+}
+
+// benchmarkMap runs a mix of reads and writes, one in every writeEvery
+// operations being a write, over a fixed set of keys.
+func benchmarkMap(b *testing.B, m intMap, writeEvery int) {
+	const keys = 1024
+	for i := 0; i < keys; i++ {
+		m.Set(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%writeEvery == 0 {
+				m.Set(i%keys, i)
+			} else {
+				m.Get(i % keys)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkLockedMap(b *testing.B) {
+	benchmarkMap(b, New[int, int](), 10)
+}
+
+func BenchmarkSyncMap(b *testing.B) {
+	benchmarkMap(b, &syncMap{}, 10)
+}
+
+func BenchmarkRWMutexMap(b *testing.B) {
+	benchmarkMap(b, &rwMutexMap{items: make(map[int]int)}, 10)
+}
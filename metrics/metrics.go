@@ -0,0 +1,79 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package metrics exports ilock.Mutex statistics in the Prometheus text
+// exposition format, without depending on the Prometheus client libraries.
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+var modes = []ilock.LockMode{ilock.ModeX, ilock.ModeS, ilock.ModeIX, ilock.ModeIS}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the wait and hold time histograms of the given
+// Mutexes to w as the ilock_wait_seconds and ilock_hold_seconds metrics,
+// labelled with each Mutex's name and mode.  Mutexes need to have been
+// created with ilock.WithStats to have anything to report.
+func WritePrometheus(w io.Writer, mutexes ...*ilock.Mutex) error {
+	bw := bufio.NewWriter(w)
+	writeHistograms(bw, "ilock_wait_seconds", "Time spent waiting to acquire the lock.",
+		mutexes, (*ilock.Mutex).WaitHistogram)
+	writeHistograms(bw, "ilock_hold_seconds", "Time spent holding the lock.",
+		mutexes, (*ilock.Mutex).HoldTime)
+	return bw.Flush()
+}
+
+func writeHistograms(w *bufio.Writer, metric, help string, mutexes []*ilock.Mutex,
+	get func(*ilock.Mutex, ilock.LockMode) ilock.Histogram) {
+
+	w.WriteString("# HELP " + metric + " " + help + "\n")
+	w.WriteString("# TYPE " + metric + " histogram\n")
+	for _, m := range mutexes {
+		for _, mode := range modes {
+			h := get(m, mode)
+			labels := `lock="` + labelEscaper.Replace(m.Name()) + `",mode="` + mode.String() + `"`
+
+			var cumulative uint64
+			for i := 0; i < ilock.HistogramBuckets; i++ {
+				cumulative += h.Counts[i]
+				le := strconv.FormatFloat(ilock.BucketBound(i).Seconds(), 'g', -1, 64)
+				writeSample(w, metric+"_bucket", labels+`,le="`+le+`"`, cumulative)
+			}
+			cumulative += h.Counts[ilock.HistogramBuckets]
+			writeSample(w, metric+"_bucket", labels+`,le="+Inf"`, cumulative)
+
+			w.WriteString(metric + "_sum{" + labels + "} ")
+			w.WriteString(strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64) + "\n")
+			writeSample(w, metric+"_count", labels, cumulative)
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value uint64) {
+	w.WriteString(name + "{" + labels + "} " + strconv.FormatUint(value, 10) + "\n")
+}
@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	m := ilock.New(ilock.WithStats())
+	m.SetName(`a "quoted" lock`)
+
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlockMust()
+	}()
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+
+	var buf bytes.Buffer
+	assert.NoError(t, WritePrometheus(&buf, m))
+	out := buf.String()
+
+	assert.True(t, strings.HasPrefix(out, "# HELP ilock_wait_seconds "))
+	assert.Contains(t, out, "# TYPE ilock_wait_seconds histogram\n")
+	assert.Contains(t, out, `ilock_wait_seconds_bucket{lock="a \"quoted\" lock",mode="S",le="1e-06"} 0`+"\n")
+	assert.Contains(t, out, `ilock_wait_seconds_bucket{lock="a \"quoted\" lock",mode="S",le="+Inf"} 1`+"\n")
+	assert.Contains(t, out, `ilock_wait_seconds_count{lock="a \"quoted\" lock",mode="S"} 1`+"\n")
+	assert.Contains(t, out, `ilock_wait_seconds_count{lock="a \"quoted\" lock",mode="X"} 0`+"\n")
+
+	assert.Contains(t, out, "# TYPE ilock_hold_seconds histogram\n")
+	assert.Contains(t, out, `ilock_hold_seconds_bucket{lock="a \"quoted\" lock",mode="X",le="0.001024"} 0`+"\n")
+	assert.Contains(t, out, `ilock_hold_seconds_bucket{lock="a \"quoted\" lock",mode="X",le="+Inf"} 1`+"\n")
+	assert.Contains(t, out, `ilock_hold_seconds_count{lock="a \"quoted\" lock",mode="S"} 1`+"\n")
+
+	// For each metric, one sample per bucket, plus sum and count, for each
+	// of the four modes.
+	lines := strings.Count(out, "\n")
+	assert.Equal(t, 2*(2+4*(ilock.HistogramBuckets+3)), lines)
+}
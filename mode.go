@@ -0,0 +1,72 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// LockMode names one of the four state contexts that a Mutex can be held in.
+type LockMode int
+
+// The four lock modes.  Their order matches the rows and columns of the
+// transition matrix in the package documentation.
+const (
+	ModeX LockMode = iota
+	ModeS
+	ModeIX
+	ModeIS
+)
+
+// modes lists every LockMode, in order.
+var modes = [...]LockMode{ModeX, ModeS, ModeIX, ModeIS}
+
+var modeNames = [...]string{ModeX: "X", ModeS: "S", ModeIX: "IX", ModeIS: "IS"}
+
+var modeOffsets = [...]uint64{ModeX: xOffset, ModeS: sOffset, ModeIX: ixOffset, ModeIS: isOffset}
+
+var modeMasks = [...]uint64{ModeX: xMask, ModeS: sMask, ModeIX: ixMask, ModeIS: isMask}
+
+var modeCompatibility = [...]func(uint64) bool{
+	ModeX:  compatableWithX,
+	ModeS:  compatableWithS,
+	ModeIX: compatableWithIX,
+	ModeIS: compatableWithIS,
+}
+
+func (mode LockMode) String() string {
+	if !mode.valid() {
+		return "LockMode(invalid)"
+	}
+	return modeNames[mode]
+}
+
+func (mode LockMode) valid() bool {
+	return mode >= ModeX && mode <= ModeIS
+}
+
+func extractMode(mode LockMode, state uint64) uint64 {
+	return (state & modeMasks[mode]) >> modeOffsets[mode]
+}
+
+func setMode(mode LockMode, state, val uint64) uint64 {
+	return (state & ^modeMasks[mode]) | (val << modeOffsets[mode])
+}
+
+func compatableWithMode(mode LockMode, state uint64) bool {
+	return modeCompatibility[mode](state)
+}
@@ -0,0 +1,35 @@
+package ilock
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeAccessors(t *testing.T) {
+	seed := time.Now().UTC().UnixNano()
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < 100; i++ {
+		state := rng.Uint64()
+		assert.Equal(t, extractX(state), extractMode(ModeX, state))
+		assert.Equal(t, extractS(state), extractMode(ModeS, state))
+		assert.Equal(t, extractIX(state), extractMode(ModeIX, state))
+		assert.Equal(t, extractIS(state), extractMode(ModeIS, state))
+
+		val := rng.Uint64() & maxHolders
+		assert.Equal(t, setX(state, val), setMode(ModeX, state, val))
+		assert.Equal(t, setS(state, val), setMode(ModeS, state, val))
+		assert.Equal(t, setIX(state, val), setMode(ModeIX, state, val))
+		assert.Equal(t, setIS(state, val), setMode(ModeIS, state, val))
+	}
+}
+
+func TestModeString(t *testing.T) {
+	assert.Equal(t, "X", ModeX.String())
+	assert.Equal(t, "S", ModeS.String())
+	assert.Equal(t, "IX", ModeIX.String())
+	assert.Equal(t, "IS", ModeIS.String())
+	assert.Equal(t, "LockMode(invalid)", LockMode(4).String())
+}
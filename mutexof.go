@@ -0,0 +1,95 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build go1.19
+// +build go1.19
+
+package ilock
+
+import "sync/atomic"
+
+// MutexOf is a Mutex bundled with the value it protects, which writers
+// update by read-copy-update: WithX hands f a copy of the value, and
+// publishes the result once f returns.  Readers can take the Mutex in S as
+// usual, or skip it altogether with OptimisticGet.  It needs generics and
+// atomic.Pointer, and so Go 1.19 or later.
+//
+// The embedded Mutex can be used like any other, e.g. as part of a
+// LockPath, but only WithX updates the value.
+type MutexOf[T any] struct {
+	*Mutex
+	val     atomic.Pointer[T]
+	version uint64 // Bumped by every WithX; accessed atomically
+}
+
+// NewMutexOf returns a MutexOf protecting v, with its Mutex created from
+// opts as New would.
+func NewMutexOf[T any](v T, opts ...Option) *MutexOf[T] {
+	m := &MutexOf[T]{Mutex: New(opts...)}
+	m.val.Store(&v)
+	return m
+}
+
+// WithX runs f on a copy of the value with the Mutex held in X, and then
+// publishes the copy as the new value.  If f panics, the value is left as
+// it was.
+func (m *MutexOf[T]) WithX(f func(*T)) {
+	m.XLock()
+	defer m.XUnlockMust()
+	v := *m.val.Load()
+	f(&v)
+	m.val.Store(&v)
+	atomic.AddUint64(&m.version, 1)
+}
+
+// WithS runs f on the value with the Mutex held in S.
+func (m *MutexOf[T]) WithS(f func(T)) {
+	m.SLock()
+	defer m.SUnlockMust()
+	f(*m.val.Load())
+}
+
+// OptimisticGet returns the value without taking the Mutex, along with a
+// version to be handed to ValidateGet once the caller has used it:
+//
+//	for {
+//		val, v := m.OptimisticGet()
+//		use(val)
+//		if m.ValidateGet(v) {
+//			break
+//		}
+//	}
+//
+// The value is always one that WithX published in full, never a torn one,
+// but a concurrent WithX may have replaced it by the time it's used.
+func (m *MutexOf[T]) OptimisticGet() (T, uint64) {
+	// The version has to be loaded first: if a WithX gets in between, it
+	// bumps the version after publishing, so ValidateGet catches it either
+	// way.  Atomic operations aren't reordered with one another.
+	v := atomic.LoadUint64(&m.version)
+	return *m.val.Load(), v
+}
+
+// ValidateGet reports whether no WithX has published a new value since
+// OptimisticGet returned v, i.e. whether the value it returned is still
+// current.
+func (m *MutexOf[T]) ValidateGet(v uint64) bool {
+	return atomic.LoadUint64(&m.version) == v
+}
@@ -0,0 +1,73 @@
+//go:build go1.19
+// +build go1.19
+
+package ilock
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type pair struct {
+	a, b int
+}
+
+func TestMutexOf(t *testing.T) {
+	m := NewMutexOf(pair{1, 1}, WithStats())
+	val, v := m.OptimisticGet()
+	assert.Equal(t, pair{1, 1}, val)
+	assert.True(t, m.ValidateGet(v))
+
+	m.WithX(func(p *pair) {
+		p.a, p.b = 2, 2
+	})
+	assert.False(t, m.ValidateGet(v), "Version not bumped by WithX")
+	val, v = m.OptimisticGet()
+	assert.Equal(t, pair{2, 2}, val)
+	assert.True(t, m.ValidateGet(v))
+
+	m.WithS(func(p pair) {
+		assert.Equal(t, pair{2, 2}, p)
+		assert.Equal(t, setS(0, 1), m.load())
+	})
+	assert.Equal(t, uint64(0), m.load())
+	assert.Equal(t, uint64(1), m.Stats().Acquisitions[ModeX], "Options not applied")
+
+	// A panicking writer leaves the value alone.
+	assert.Panics(t, func() {
+		m.WithX(func(p *pair) {
+			p.a = 3
+			panic("oops")
+		})
+	})
+	val, _ = m.OptimisticGet()
+	assert.Equal(t, pair{2, 2}, val)
+	assert.True(t, m.ValidateGet(v))
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestMutexOfOptimisticReads(t *testing.T) {
+	m := NewMutexOf(pair{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 1000; i++ {
+			m.WithX(func(p *pair) {
+				p.a = i
+				p.b = i
+			})
+		}
+	}()
+
+	for done := false; !done; {
+		val, v := m.OptimisticGet()
+		assert.Equal(t, val.a, val.b, "Torn read")
+		if m.ValidateGet(v) && val.a == 1000 {
+			done = true
+		}
+	}
+	wg.Wait()
+}
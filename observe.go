@@ -0,0 +1,121 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LockStateChange is a change to a Mutex's lock state, as reported by
+// Observe: a hold in Mode was taken if Acquired is set, or released
+// otherwise.
+type LockStateChange struct {
+	Before, After LockState
+	Mode          LockMode
+	Acquired      bool
+	Time          time.Time
+}
+
+// observers are the channels returned by Observe.  Like an EventBus, they
+// cost a single atomic load when there are none.
+type observers struct {
+	mtx   sync.RWMutex
+	chans []chan LockStateChange
+	count int32  // len(chans), accessed atomically
+	drops uint64 // Changes that didn't fit in a channel; accessed atomically
+}
+
+// Observe returns a channel that receives every subsequent change to the
+// Mutex's lock state, with the state before and after it, e.g. for drawing
+// a live diagram of who holds what.  Unlike subscribing to an EventBus, it
+// only covers this Mutex, and reports whole states rather than events.
+//
+// Before and After are the exact states that the change took the Mutex
+// from and to, so each change is reported once, and the changes chain
+// together.  Changes made concurrently may arrive out of order, though;
+// they can be put back in order by matching one's Before with another's
+// After.  A change that takes the Mutex through several holds at once, such
+// as SwitchMode or Batch, is reported as one change per hold, through
+// states that nobody else could see.
+//
+// Sending never blocks: changes that don't fit in the channel's buffer of
+// bufSize are dropped, and counted by ObserverDrops.  The returned function
+// stops the observation and closes the channel.
+func (m *Mutex) Observe(bufSize int) (<-chan LockStateChange, func()) {
+	o := &m.observers
+	c := make(chan LockStateChange, bufSize)
+	o.mtx.Lock()
+	o.chans = append(o.chans, c)
+	atomic.StoreInt32(&o.count, int32(len(o.chans)))
+	o.mtx.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			o.mtx.Lock()
+			defer o.mtx.Unlock()
+			for i, other := range o.chans {
+				if other == c {
+					o.chans = append(o.chans[:i], o.chans[i+1:]...)
+					break
+				}
+			}
+			atomic.StoreInt32(&o.count, int32(len(o.chans)))
+			close(c)
+		})
+	}
+}
+
+// ObserverDrops returns the number of changes that have been dropped
+// because an Observe channel's buffer was full.
+func (m *Mutex) ObserverDrops() uint64 {
+	return atomic.LoadUint64(&m.observers.drops)
+}
+
+// observe reports a hold in the given mode having been taken or released,
+// taking the lock state from before to after, to the Mutex's observers.  It
+// must be called by whoever made the change, with the states it swapped.
+func (m *Mutex) observe(mode LockMode, acquired bool, before, after uint64) {
+	o := &m.observers
+	if atomic.LoadInt32(&o.count) == 0 {
+		return
+	}
+
+	change := LockStateChange{
+		Before:   lockState(before),
+		After:    lockState(after),
+		Mode:     mode,
+		Acquired: acquired,
+		Time:     time.Now(),
+	}
+
+	o.mtx.RLock()
+	defer o.mtx.RUnlock()
+	for _, c := range o.chans {
+		select {
+		case c <- change:
+		default:
+			atomic.AddUint64(&o.drops, 1)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package ilock
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stateChange struct {
+	before, after LockState
+	mode          LockMode
+	acquired      bool
+}
+
+func drainChanges(c <-chan LockStateChange) []stateChange {
+	var ret []stateChange
+	for {
+		select {
+		case ch := <-c:
+			ret = append(ret, stateChange{ch.Before, ch.After, ch.Mode, ch.Acquired})
+		default:
+			return ret
+		}
+	}
+}
+
+func TestObserve(t *testing.T) {
+	m := New()
+	c, stop := m.Observe(8)
+
+	m.IXLock()
+	m.ISLock()
+	assert.NoError(t, m.IXUnlock())
+	assert.NoError(t, m.SwitchMode(ModeIS, ModeS))
+	assert.Equal(t, []stateChange{
+		{LockState{}, LockState{IX: 1}, ModeIX, true},
+		{LockState{IX: 1}, LockState{IX: 1, IS: 1}, ModeIS, true},
+		{LockState{IX: 1, IS: 1}, LockState{IS: 1}, ModeIX, false},
+		{LockState{IS: 1}, LockState{}, ModeIS, false},
+		{LockState{}, LockState{S: 1}, ModeS, true},
+	}, drainChanges(c))
+
+	stop()
+	stop()
+	assert.NoError(t, m.SUnlock())
+	_, ok := <-c
+	assert.False(t, ok, "Channel not closed by stop")
+}
+
+func TestObserveDrops(t *testing.T) {
+	m := New()
+	c, stop := m.Observe(1)
+	defer stop()
+
+	m.ISLock()
+	assert.NoError(t, m.ISUnlock())
+	m.ISLock()
+	assert.Equal(t, uint64(2), m.ObserverDrops())
+	assert.Equal(t, []stateChange{
+		{LockState{}, LockState{IS: 1}, ModeIS, true},
+	}, drainChanges(c))
+}
+
+func TestObserveConcurrent(t *testing.T) {
+	const n = 50
+	m := New()
+	c, stop := m.Observe(2 * n)
+	defer stop()
+
+	// However the goroutines interleave, each IS count from 0 to n has to
+	// be passed through exactly once on the way up, and again on the way
+	// down.
+	run := func(f func()) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f()
+			}()
+		}
+		wg.Wait()
+	}
+	check := func(acquired bool) {
+		seen := make(map[uint16]bool)
+		for _, ch := range drainChanges(c) {
+			assert.Equal(t, ModeIS, ch.mode)
+			assert.Equal(t, acquired, ch.acquired)
+			from := ch.before.IS
+			if acquired {
+				assert.Equal(t, from+1, ch.after.IS)
+			} else {
+				assert.Equal(t, from-1, ch.after.IS)
+				from = ch.after.IS
+			}
+			assert.False(t, seen[from], "Transition from IS=%d reported twice", from)
+			seen[from] = true
+		}
+		assert.Equal(t, n, len(seen), "Transitions missing")
+	}
+
+	run(m.ISLock)
+	check(true)
+	run(m.ISUnlockMust)
+	check(false)
+	assert.Equal(t, uint64(0), m.ObserverDrops())
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// XHolderIDs returns the IDs of the goroutines holding the Mutex in X, in
+// ascending order.  Goroutine IDs are only tracked in builds with the
+// ilock_goroutineid build tag, since finding out the current goroutine's ID
+// means parsing a stack trace; otherwise it returns nil.
+//
+// Go doesn't tie locks to goroutines, but the tracking can only follow a
+// hold from one goroutine to another when it's handed off by TransferX or a
+// LockChan, in which case it's attributed to the goroutine that releases it,
+// or claims it with AssertMode.  Any other release by a goroutine that
+// doesn't hold the lock is logged as a warning, and the hold stays with the
+// goroutine that took it.
+func (m *Mutex) XHolderIDs() []int64 {
+	return m.owners.holders(ModeX)
+}
+
+// SHolderIDs is like XHolderIDs, for S.
+func (m *Mutex) SHolderIDs() []int64 {
+	return m.owners.holders(ModeS)
+}
+
+// IXHolderIDs is like XHolderIDs, for IX.
+func (m *Mutex) IXHolderIDs() []int64 {
+	return m.owners.holders(ModeIX)
+}
+
+// ISHolderIDs is like XHolderIDs, for IS.
+func (m *Mutex) ISHolderIDs() []int64 {
+	return m.owners.holders(ModeIS)
+}
+
+// LeakedHold is a hold on a Mutex by a goroutine that has since exited.
+type LeakedHold struct {
+	Mode        LockMode
+	GoroutineID int64
+}
+
+// CheckLeaks looks for goroutines that have exited while still holding the
+// Mutex, typically because they panicked, or returned early without
+// unlocking.  It is a debugging aid, only available in builds with the
+// ilock_goroutineid build tag, and returns nil otherwise.
+//
+// The check is inherently racy, and is only as good as the ownership
+// tracking described in XHolderIDs: a hold that another goroutine released
+// on the owner's behalf is still reported once the owner exits.  Holds
+// cleared by ForceUnlock are forgotten, so CheckLeaks followed by
+// ForceUnlock is enough to recover from a leak.
+func (m *Mutex) CheckLeaks() []LeakedHold {
+	live := liveGoroutines()
+	if live == nil {
+		return nil
+	}
+
+	var leaked []LeakedHold
+	for _, mode := range modes {
+		for _, id := range m.owners.holders(mode) {
+			if !live[id] {
+				leaked = append(leaked, LeakedHold{Mode: mode, GoroutineID: id})
+			}
+		}
+	}
+	return leaked
+}
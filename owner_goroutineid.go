@@ -0,0 +1,184 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build ilock_goroutineid
+// +build ilock_goroutineid
+
+package ilock
+
+import (
+	"bytes"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// goroutineID returns the ID of the calling goroutine, from the first line
+// of its stack trace, which looks like "goroutine 123 [running]:".
+func goroutineID() int64 {
+	var buf [64]byte
+	return parseGoroutineID(buf[:runtime.Stack(buf[:], false)])
+}
+
+// parseGoroutineID parses the ID from the header line of a goroutine's stack
+// trace, returning -1 if it can't.
+func parseGoroutineID(b []byte) int64 {
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return id
+}
+
+// liveGoroutines returns the IDs of every goroutine in the process, from a
+// dump of all their stack traces.
+func liveGoroutines() map[int64]bool {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	live := make(map[int64]bool)
+	for _, trace := range bytes.Split(buf, []byte("\n\n")) {
+		if id := parseGoroutineID(trace); id >= 0 {
+			live[id] = true
+		}
+	}
+	return live
+}
+
+// ownerTracker counts how many times each goroutine holds the Mutex in each
+// mode.  Holds that have been handed off to a goroutine we don't know yet,
+// by TransferX or a LockChan, are unclaimed until that goroutine releases
+// them or asserts that it holds them.
+type ownerTracker struct {
+	mtx       sync.Mutex
+	counts    [4]map[int64]int
+	unclaimed [4]int
+}
+
+func (t *ownerTracker) acquired(mode LockMode) {
+	id := goroutineID()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.add(mode, id)
+}
+
+func (t *ownerTracker) released(mode LockMode) {
+	id := goroutineID()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	switch {
+	case t.counts[mode][id] > 0:
+		t.remove(mode, id)
+	case t.unclaimed[mode] > 0:
+		t.unclaimed[mode]--
+	default:
+		// Released on some other goroutine's behalf; rather than guess
+		// whose, leave the hold where it is, so that it shows up in
+		// CheckLeaks once its owner exits.
+		log.Printf("ilock: WARNING: goroutine %d released a %v hold that it doesn't own", id, mode)
+	}
+}
+
+// transfer hands one of the calling goroutine's holds in the given mode off
+// to whichever goroutine claims it.
+func (t *ownerTracker) transfer(mode LockMode) {
+	id := goroutineID()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.counts[mode][id] > 0 {
+		t.remove(mode, id)
+		t.unclaimed[mode]++
+	}
+}
+
+// claim attributes an unclaimed hold in the given mode to the calling
+// goroutine, and reports whether there was one.
+func (t *ownerTracker) claim(mode LockMode) bool {
+	id := goroutineID()
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.unclaimed[mode] == 0 {
+		return false
+	}
+	t.unclaimed[mode]--
+	t.add(mode, id)
+	return true
+}
+
+// move attributes one of goroutine from's holds in the given mode to
+// goroutine to instead, if from has one.
+func (t *ownerTracker) move(mode LockMode, from, to int64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.counts[mode][from] > 0 {
+		t.remove(mode, from)
+		t.add(mode, to)
+	}
+}
+
+// clear forgets every hold in the given mode.
+func (t *ownerTracker) clear(mode LockMode) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	t.counts[mode] = nil
+	t.unclaimed[mode] = 0
+}
+
+func (t *ownerTracker) add(mode LockMode, id int64) {
+	if t.counts[mode] == nil {
+		t.counts[mode] = make(map[int64]int)
+	}
+	t.counts[mode][id]++
+}
+
+func (t *ownerTracker) remove(mode LockMode, id int64) {
+	if t.counts[mode][id] > 1 {
+		t.counts[mode][id]--
+	} else {
+		delete(t.counts[mode], id)
+	}
+}
+
+func (t *ownerTracker) holders(mode LockMode) []int64 {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if len(t.counts[mode]) == 0 {
+		return nil
+	}
+	ids := make([]int64, 0, len(t.counts[mode]))
+	for id := range t.counts[mode] {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
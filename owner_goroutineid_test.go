@@ -0,0 +1,186 @@
+//go:build ilock_goroutineid
+// +build ilock_goroutineid
+
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolderIDs(t *testing.T) {
+	self := goroutineID()
+	assert.True(t, self > 0)
+
+	m := New()
+	m.ISLock()
+	m.ISLock()
+
+	other := make(chan int64)
+	go func() {
+		m.IXLock()
+		other <- goroutineID()
+	}()
+	id := <-other
+	assert.NotEqual(t, self, id)
+
+	assert.Equal(t, []int64{self}, m.ISHolderIDs())
+	assert.Equal(t, []int64{id}, m.IXHolderIDs())
+	assert.Nil(t, m.SHolderIDs())
+	assert.Nil(t, m.XHolderIDs())
+
+	// Released on the other goroutine's behalf: we can't tell whose hold
+	// that was, so it stays with its owner.
+	assert.NoError(t, m.IXUnlock())
+	assert.Equal(t, []int64{id}, m.IXHolderIDs())
+
+	assert.NoError(t, m.ISUnlock())
+	assert.Equal(t, []int64{self}, m.ISHolderIDs())
+	assert.NoError(t, m.ISUnlock())
+	assert.Nil(t, m.ISHolderIDs())
+}
+
+func TestCheckLeaks(t *testing.T) {
+	m := New()
+	m.IXLock()
+	assert.Nil(t, m.CheckLeaks())
+
+	exited := make(chan int64)
+	go func() {
+		defer func() {
+			recover()
+			exited <- goroutineID()
+		}()
+		m.ISLock()
+		panic("forgot to unlock")
+	}()
+	id := <-exited
+	// Give the goroutine a moment to actually exit.
+	for i := 0; i < 100 && liveGoroutines()[id]; i++ {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.Equal(t, []LeakedHold{{Mode: ModeIS, GoroutineID: id}}, m.CheckLeaks())
+	assert.Equal(t, 1, m.ForceUnlock(ModeIS))
+	assert.NoError(t, m.IXUnlock())
+	assert.Nil(t, m.CheckLeaks())
+}
+
+func TestAssertModeOtherGoroutine(t *testing.T) {
+	if !assertionsEnabled {
+		t.Skip("assertions are disabled in ilock_noassert builds")
+	}
+	m := New()
+	held := make(chan bool)
+	go func() {
+		m.SLock()
+		held <- true
+	}()
+	<-held
+	assert.Panics(t, func() { m.AssertMode(ModeS) }, "S is held, but not by us")
+
+	m.SLock()
+	assert.NotPanics(t, func() { m.AssertMode(ModeS) })
+}
+
+func TestCheckLeaksForceUnlock(t *testing.T) {
+	m := New()
+	exited := make(chan int64)
+	go func() {
+		m.SLock()
+		m.SLock()
+		exited <- goroutineID()
+	}()
+	id := <-exited
+	for i := 0; i < 100 && liveGoroutines()[id]; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []LeakedHold{{Mode: ModeS, GoroutineID: id}}, m.CheckLeaks())
+
+	assert.Equal(t, 2, m.ForceUnlock(ModeS))
+	assert.Nil(t, m.CheckLeaks())
+	assert.Nil(t, m.SHolderIDs())
+}
+
+func TestTransferXOwnership(t *testing.T) {
+	self := goroutineID()
+	m := New()
+	m.XLock()
+	assert.Equal(t, []int64{self}, m.XHolderIDs())
+
+	token := m.TransferX()
+	assert.Nil(t, m.XHolderIDs(), "Hold still attributed to the sender")
+
+	received := make(chan int64)
+	released := make(chan bool)
+	go func() {
+		<-token
+		m.AssertMode(ModeX)
+		received <- goroutineID()
+		<-released
+		m.XUnlockMust()
+		released <- true
+	}()
+	id := <-received
+	assert.Equal(t, []int64{id}, m.XHolderIDs())
+	released <- true
+	<-released
+	assert.Nil(t, m.XHolderIDs())
+}
+
+func TestLockChanOwnership(t *testing.T) {
+	m := New()
+	m.XLock()
+	lc := m.SLockChan()
+
+	done := make(chan int64)
+	go func() {
+		<-lc.C
+		done <- goroutineID()
+		m.SUnlockMust()
+		done <- 0
+	}()
+	m.XUnlockMust()
+	<-done
+	<-done
+	assert.Nil(t, m.SHolderIDs())
+	assert.Equal(t, uint64(0), m.load())
+}
+
+func TestRequestUpgradeOwnership(t *testing.T) {
+	self := goroutineID()
+	m := New()
+	m.IXLock()
+	m.ISLock()
+
+	// The upgrade has to wait for the IS hold, so it's made in the
+	// background, but the X hold is still ours.
+	upgraded := m.RequestUpgrade(ModeIX, ModeX)
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, <-upgraded)
+	assert.Equal(t, []int64{self}, m.XHolderIDs())
+	assert.Nil(t, m.IXHolderIDs())
+	assert.Empty(t, m.CheckLeaks())
+
+	assert.NoError(t, m.XUnlock())
+	assert.Nil(t, m.XHolderIDs())
+}
+
+func TestSchedulePromotionOwnership(t *testing.T) {
+	self := goroutineID()
+	m := New()
+	m.ISLock()
+	m.SLock()
+
+	promoted := m.SchedulePromotion(ModeIS, ModeIX)
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, <-promoted)
+	assert.Equal(t, []int64{self}, m.IXHolderIDs())
+	assert.Nil(t, m.ISHolderIDs())
+	assert.Empty(t, m.CheckLeaks())
+
+	assert.NoError(t, m.IXUnlock())
+	assert.Nil(t, m.IXHolderIDs())
+}
@@ -0,0 +1,57 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build !ilock_goroutineid
+// +build !ilock_goroutineid
+
+package ilock
+
+// goroutineID returns -1 outside of ilock_goroutineid builds, meaning that
+// the current goroutine is unknown.
+func goroutineID() int64 {
+	return -1
+}
+
+// liveGoroutines returns nil outside of ilock_goroutineid builds.
+func liveGoroutines() map[int64]bool {
+	return nil
+}
+
+// ownerTracker is empty outside of ilock_goroutineid builds, so that
+// ownership tracking has no overhead in production.
+type ownerTracker struct{}
+
+func (t *ownerTracker) acquired(mode LockMode) {}
+
+func (t *ownerTracker) released(mode LockMode) {}
+
+func (t *ownerTracker) transfer(mode LockMode) {}
+
+func (t *ownerTracker) claim(mode LockMode) bool {
+	return false
+}
+
+func (t *ownerTracker) move(mode LockMode, from, to int64) {}
+
+func (t *ownerTracker) clear(mode LockMode) {}
+
+func (t *ownerTracker) holders(mode LockMode) []int64 {
+	return nil
+}
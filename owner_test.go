@@ -0,0 +1,30 @@
+//go:build !ilock_goroutineid
+// +build !ilock_goroutineid
+
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHolderIDsUntracked(t *testing.T) {
+	assert.Equal(t, int64(-1), goroutineID())
+
+	m := New()
+	m.XLock()
+	assert.Nil(t, m.XHolderIDs())
+	assert.NoError(t, m.XUnlock())
+}
+
+func TestCheckLeaksUntracked(t *testing.T) {
+	m := New()
+	done := make(chan bool)
+	go func() {
+		m.ISLock()
+		done <- true
+	}()
+	<-done
+	assert.Nil(t, m.CheckLeaks())
+}
@@ -0,0 +1,311 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+// ErrPathTooDeep is returned when a BoundedLockPath would grow beyond its
+// maximum depth.
+var ErrPathTooDeep = errors.New("ilock: lock path exceeds maximum depth")
+
+// LockPath is the sequence of Mutexes guarding each node on the path from
+// the root of a tree down to some target node, which is the last element.
+// Locking a path takes the appropriate intention lock on every ancestor,
+// from the root down, before locking the target itself.
+type LockPath []*Mutex
+
+// SLock takes every ancestor in IS and the target in S.
+func (p LockPath) SLock() {
+	p.lock(ModeIS, ModeS)
+}
+
+// SUnlock releases a path taken with SLock, from the target up.  Returns the
+// first error encountered, but carries on releasing the rest of the path.
+func (p LockPath) SUnlock() error {
+	return p.unlock(ModeIS, ModeS)
+}
+
+// XLock takes every ancestor in IX and the target in X.
+func (p LockPath) XLock() {
+	p.lock(ModeIX, ModeX)
+}
+
+// XUnlock releases a path taken with XLock, from the target up.  Returns the
+// first error encountered, but carries on releasing the rest of the path.
+func (p LockPath) XUnlock() error {
+	return p.unlock(ModeIX, ModeX)
+}
+
+// ISLock takes every node on the path, the target included, in IS, for a
+// traversal that is only passing through on its way to something deeper.
+func (p LockPath) ISLock() {
+	p.lock(ModeIS, ModeIS)
+}
+
+// ISUnlock releases a path taken with ISLock, from the target up.  Returns
+// the first error encountered, but carries on releasing the rest of the
+// path.
+func (p LockPath) ISUnlock() error {
+	return p.unlock(ModeIS, ModeIS)
+}
+
+// IXLock takes every node on the path, the target included, in IX.
+func (p LockPath) IXLock() {
+	p.lock(ModeIX, ModeIX)
+}
+
+// IXUnlock releases a path taken with IXLock, from the target up.  Returns
+// the first error encountered, but carries on releasing the rest of the
+// path.
+func (p LockPath) IXUnlock() error {
+	return p.unlock(ModeIX, ModeIX)
+}
+
+func (p LockPath) lock(intention, leaf LockMode) {
+	for i, m := range p {
+		mode := intention
+		if i == len(p)-1 {
+			mode = leaf
+		}
+		m.mustAcquire(mode)
+	}
+}
+
+// lockCtx is like lock, but gives up if ctx is done before the whole path
+// has been taken, in which case it releases whatever it had already taken.
+func (p LockPath) lockCtx(ctx context.Context, intention, leaf LockMode) error {
+	for i, m := range p {
+		mode := intention
+		if i == len(p)-1 {
+			mode = leaf
+		}
+		if err := m.acquire(ctx, mode); err != nil {
+			p[:i].unlock(intention, intention)
+			return err
+		}
+	}
+	return nil
+}
+
+func (p LockPath) unlock(intention, leaf LockMode) error {
+	var err error
+	for i := len(p) - 1; i >= 0; i-- {
+		mode := intention
+		if i == len(p)-1 {
+			mode = leaf
+		}
+		if e := p[i].unlock(mode); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// TryXLockOrAbort is like XLock, but all or nothing within a time limit: if
+// the whole path can't be taken within timeout, it releases whatever it had
+// taken, leaving every node as it found it, and returns false.  Each node
+// may wait for as much of the timeout as the nodes before it left over.
+func (p LockPath) TryXLockOrAbort(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return p.lockCtx(ctx, ModeIX, ModeX) == nil
+}
+
+// Upgrade switches a path locked for access to its target in mode from, e.g.
+// by SLock, to one locked for access in mode to, as XLock would have: the
+// target is switched from from to to, and every ancestor between the
+// matching intention modes.  Each node is switched with SwitchMode, so
+// Upgrade doesn't block; if any node can't be switched, the nodes already
+// switched are switched back and the error is returned, leaving the path as
+// it was.
+//
+// Despite the name, Upgrade handles downgrades (e.g. X to S) as well.
+// Ancestors are strengthened from the root down before the target, and
+// weakened from the target up after it, so that the path never holds the
+// target in a mode that its ancestors' intention modes don't cover.
+func (p LockPath) Upgrade(from, to LockMode) error {
+	fromIntention, err := intentionFor(from)
+	if err != nil {
+		return err
+	}
+	toIntention, err := intentionFor(to)
+	if err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		return nil
+	}
+
+	type step struct {
+		m        *Mutex
+		from, to LockMode
+	}
+	steps := []step{{p[len(p)-1], from, to}}
+	if fromIntention != toIntention {
+		ancestors := make([]step, 0, len(p))
+		for _, m := range p[:len(p)-1] {
+			ancestors = append(ancestors, step{m, fromIntention, toIntention})
+		}
+		if toIntention == ModeIX {
+			steps = append(ancestors, steps...)
+		} else {
+			for i := len(ancestors) - 1; i >= 0; i-- {
+				steps = append(steps, ancestors[i])
+			}
+		}
+	}
+
+	for i, s := range steps {
+		if err := s.m.SwitchMode(s.from, s.to); err != nil {
+			for j := i - 1; j >= 0; j-- {
+				if err := steps[j].m.SwitchMode(steps[j].to, steps[j].from); err != nil {
+					// We held this mode a moment ago, so this can only
+					// happen if someone else has broken the path.
+					panic(err)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Reorder returns a copy of the path with its Mutexes sorted by key, e.g.
+// (*Mutex).ID, to give a canonical acquisition order.  A path built by
+// walking down a tree is ordered from the root down, but a set of nodes
+// spanning several branches, say the union of the paths to two siblings,
+// has no such natural order, and two goroutines locking overlapping sets in
+// different orders can deadlock.  Sorting both sets by the same key avoids
+// that.
+//
+// The reordered path is locked like any other, so its last Mutex is the
+// one taken in the terminal mode.  Build and reorder the whole path before
+// locking any of it: reordering a path that's partly held doesn't change
+// the order in which those locks were taken.
+func (p LockPath) Reorder(key func(*Mutex) uint64) LockPath {
+	ret := append(LockPath(nil), p...)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return key(ret[i]) < key(ret[j])
+	})
+	return ret
+}
+
+// ReorderByAddress is Reorder, sorting by the Mutexes' addresses in memory,
+// as MutexGroup.SortByAddress does.
+func (p LockPath) ReorderByAddress() LockPath {
+	return p.Reorder(mutexAddress)
+}
+
+// TraversePath locks path for access to its target in leafMode, taking every
+// ancestor in the matching intention mode: IS if leafMode is S or IS, and IX
+// if it is X or IX.  The returned function releases the path again, and
+// panics if any of it isn't held any more.
+func TraversePath(path []*Mutex, leafMode LockMode) (unlock func(), err error) {
+	intention, err := intentionFor(leafMode)
+	if err != nil {
+		return nil, err
+	}
+	p := LockPath(path)
+	p.lock(intention, leafMode)
+	return func() {
+		if err := p.unlock(intention, leafMode); err != nil {
+			panic(err)
+		}
+	}, nil
+}
+
+// intentionFor returns the mode that the ancestors of a node locked in mode
+// have to be held in.
+func intentionFor(mode LockMode) (LockMode, error) {
+	switch mode {
+	case ModeS, ModeIS:
+		return ModeIS, nil
+	case ModeX, ModeIX:
+		return ModeIX, nil
+	}
+	return 0, ErrInvalidMode
+}
+
+// BoundedLockPath is a LockPath that refuses to grow beyond a maximum depth,
+// to stop accidentally deep tree traversals from running away.  It is built
+// up and torn down like a stack as the traversal descends and returns.
+type BoundedLockPath struct {
+	maxDepth int
+	nodes    []*Mutex
+}
+
+// NewBoundedLockPath returns an empty path that can hold at most maxDepth
+// Mutexes.
+func NewBoundedLockPath(maxDepth int) *BoundedLockPath {
+	return &BoundedLockPath{maxDepth: maxDepth}
+}
+
+// Push appends m to the path, or returns ErrPathTooDeep if the path is
+// already at its maximum depth.
+func (p *BoundedLockPath) Push(m *Mutex) error {
+	if len(p.nodes) >= p.maxDepth {
+		return ErrPathTooDeep
+	}
+	p.nodes = append(p.nodes, m)
+	return nil
+}
+
+// Pop removes and returns the last Mutex on the path, or nil if the path is
+// empty.
+func (p *BoundedLockPath) Pop() *Mutex {
+	if len(p.nodes) == 0 {
+		return nil
+	}
+	m := p.nodes[len(p.nodes)-1]
+	p.nodes = p.nodes[:len(p.nodes)-1]
+	return m
+}
+
+// Depth returns the number of Mutexes on the path.
+func (p *BoundedLockPath) Depth() int {
+	return len(p.nodes)
+}
+
+// SLock is like LockPath.SLock.  Push keeps the path within its maximum
+// depth, so there's nothing left to check here.
+func (p *BoundedLockPath) SLock() {
+	LockPath(p.nodes).SLock()
+}
+
+// SUnlock is like LockPath.SUnlock.
+func (p *BoundedLockPath) SUnlock() error {
+	return LockPath(p.nodes).SUnlock()
+}
+
+// XLock is like LockPath.XLock.
+func (p *BoundedLockPath) XLock() {
+	LockPath(p.nodes).XLock()
+}
+
+// XUnlock is like LockPath.XUnlock.
+func (p *BoundedLockPath) XUnlock() error {
+	return LockPath(p.nodes).XUnlock()
+}
@@ -0,0 +1,194 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPath(n int) LockPath {
+	p := make(LockPath, n)
+	for i := range p {
+		p[i] = New()
+	}
+	return p
+}
+
+func TestLockPath(t *testing.T) {
+	p := newPath(3)
+
+	p.SLock()
+	assert.Equal(t, setIS(0, 1), p[0].load())
+	assert.Equal(t, setIS(0, 1), p[1].load())
+	assert.Equal(t, setS(0, 1), p[2].load())
+	assert.NoError(t, p.SUnlock())
+
+	p.XLock()
+	assert.Equal(t, setIX(0, 1), p[0].load())
+	assert.Equal(t, setIX(0, 1), p[1].load())
+	assert.Equal(t, setX(0, 1), p[2].load())
+	assert.NoError(t, p.XUnlock())
+
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Error(t, p.XUnlock())
+}
+
+func TestLockPathIntention(t *testing.T) {
+	p := newPath(3)
+
+	p.ISLock()
+	for _, m := range p {
+		assert.Equal(t, setIS(0, 1), m.load())
+	}
+	assert.NoError(t, p.ISUnlock())
+
+	p.IXLock()
+	for _, m := range p {
+		assert.Equal(t, setIX(0, 1), m.load())
+	}
+	assert.NoError(t, p.IXUnlock())
+
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Error(t, p.ISUnlock())
+}
+
+func TestBoundedLockPath(t *testing.T) {
+	p := NewBoundedLockPath(2)
+	assert.Nil(t, p.Pop())
+
+	a, b := New(), New()
+	assert.NoError(t, p.Push(a))
+	assert.NoError(t, p.Push(b))
+	assert.Equal(t, ErrPathTooDeep, p.Push(New()))
+	assert.Equal(t, 2, p.Depth())
+
+	p.XLock()
+	assert.Equal(t, setIX(0, 1), a.load())
+	assert.Equal(t, setX(0, 1), b.load())
+	assert.NoError(t, p.XUnlock())
+
+	p.SLock()
+	assert.NoError(t, p.SUnlock())
+
+	assert.Equal(t, b, p.Pop())
+	assert.Equal(t, 1, p.Depth())
+	assert.NoError(t, p.Push(b))
+}
+
+func TestTraversePath(t *testing.T) {
+	p := newPath(3)
+
+	for _, tc := range []struct {
+		leaf, intention LockMode
+	}{
+		{ModeS, ModeIS},
+		{ModeIS, ModeIS},
+		{ModeX, ModeIX},
+		{ModeIX, ModeIX},
+	} {
+		unlock, err := TraversePath(p, tc.leaf)
+		assert.NoError(t, err)
+		assert.Equal(t, setMode(tc.intention, 0, 1), p[0].load(), "leaf %v", tc.leaf)
+		assert.Equal(t, setMode(tc.intention, 0, 1), p[1].load(), "leaf %v", tc.leaf)
+		assert.Equal(t, setMode(tc.leaf, 0, 1), p[2].load(), "leaf %v", tc.leaf)
+		unlock()
+		for _, m := range p {
+			assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+		}
+	}
+
+	unlock, err := TraversePath(p, LockMode(42))
+	assert.Equal(t, ErrInvalidMode, err)
+	assert.Nil(t, unlock)
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Invalid mode locked something")
+	}
+}
+
+func TestLockPathUpgrade(t *testing.T) {
+	p := newPath(3)
+	p.SLock()
+	assert.NoError(t, p.Upgrade(ModeS, ModeX))
+	assert.Equal(t, setIX(0, 1), p[0].load())
+	assert.Equal(t, setIX(0, 1), p[1].load())
+	assert.Equal(t, setX(0, 1), p[2].load())
+
+	assert.NoError(t, p.Upgrade(ModeX, ModeS))
+	assert.Equal(t, setIS(0, 1), p[0].load())
+	assert.Equal(t, setIS(0, 1), p[1].load())
+	assert.Equal(t, setS(0, 1), p[2].load())
+
+	// Intention modes that don't change are left alone.
+	assert.NoError(t, p.Upgrade(ModeS, ModeIS))
+	assert.Equal(t, setIS(0, 1), p[1].load())
+	assert.Equal(t, setIS(0, 1), p[2].load())
+	assert.NoError(t, p.Upgrade(ModeIS, ModeS))
+
+	assert.Equal(t, ErrInvalidMode, p.Upgrade(ModeS, LockMode(42)))
+	assert.NoError(t, p.SUnlock())
+}
+
+func TestLockPathUpgradeRollback(t *testing.T) {
+	p := newPath(3)
+	p.SLock()
+
+	// Someone else reading the target stops it from being upgraded, by
+	// which time the ancestors have been.
+	p[2].SLock()
+	assert.Equal(t, ErrIncompatibleUpgrade, p.Upgrade(ModeS, ModeX))
+	assert.Equal(t, setIS(0, 1), p[0].load())
+	assert.Equal(t, setIS(0, 1), p[1].load())
+	assert.Equal(t, setS(0, 2), p[2].load())
+	assert.NoError(t, p[2].SUnlock())
+
+	// Likewise for an ancestor partway down.
+	p[1].SLock()
+	assert.Equal(t, ErrIncompatibleUpgrade, p.Upgrade(ModeS, ModeX))
+	assert.Equal(t, setIS(0, 1), p[0].load())
+	assert.Equal(t, setS(setIS(0, 1), 1), p[1].load())
+	assert.Equal(t, setS(0, 1), p[2].load())
+}
+
+func TestTryXLockOrAbort(t *testing.T) {
+	p := newPath(3)
+	assert.True(t, p.TryXLockOrAbort(time.Second))
+	assert.Equal(t, setIX(0, 1), p[0].load())
+	assert.Equal(t, setIX(0, 1), p[1].load())
+	assert.Equal(t, setX(0, 1), p[2].load())
+	assert.NoError(t, p.XUnlock())
+
+	// Someone reading the target stops us partway down the path.
+	p[0].ISLock()
+	p[2].SLock()
+	before := make([]uint64, len(p))
+	for i, m := range p {
+		before[i] = m.load()
+	}
+	start := time.Now()
+	assert.False(t, p.TryXLockOrAbort(10*time.Millisecond))
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	for i, m := range p {
+		assert.Equal(t, before[i], m.load(), "Node %d not rolled back", i)
+	}
+}
+
+func TestLockPathReorder(t *testing.T) {
+	a, b, c := New(), New(), New()
+	p := LockPath{c, a, b}
+	assert.Equal(t, LockPath{a, b, c}, p.Reorder((*Mutex).ID))
+	assert.Equal(t, LockPath{c, a, b}, p, "Reorder modified the original path")
+
+	byAddress := p.ReorderByAddress()
+	assert.ElementsMatch(t, p, byAddress)
+	for i := 1; i < len(byAddress); i++ {
+		assert.True(t, mutexAddress(byAddress[i-1]) < mutexAddress(byAddress[i]))
+	}
+
+	// Overlapping paths given in different orders come out the same.
+	assert.Equal(t, LockPath{b, c}.Reorder((*Mutex).ID), LockPath{c, b}.Reorder((*Mutex).ID))
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "time"
+
+// LockPolicy hooks into every acquisition and release of a Mutex, e.g. to
+// refuse acquisitions while a circuit breaker is open, or for fine-grained
+// instrumentation.  Policies can be layered by having one wrap another.
+//
+// The hooks run on the goroutine taking or releasing the lock, without any
+// of the Mutex's internal locks held, but they must not themselves take or
+// release the Mutex they're called for.  The exception is AfterAcquire for
+// a LockChan, which is granted the lock by whichever goroutine releases it:
+// that goroutine calls AfterAcquire once it's done with the Mutex's internal
+// locks.
+type LockPolicy interface {
+	// BeforeAcquire is called before an attempt to take the Mutex in the
+	// given mode.  Returning an error refuses the acquisition without
+	// blocking: error-returning lock methods return it, the Try methods
+	// return false, and the lock methods that can't report an error panic
+	// with it.
+	BeforeAcquire(m *Mutex, mode LockMode) error
+
+	// AfterAcquire is called once the Mutex has been taken in the given
+	// mode, after waiting for it for the given time.
+	AfterAcquire(m *Mutex, mode LockMode, waited time.Duration)
+
+	// BeforeRelease is called when a release of the given mode starts,
+	// even if it is going to fail because the Mutex isn't held in it.
+	BeforeRelease(m *Mutex, mode LockMode)
+
+	// AfterRelease is called once the Mutex has been released from the
+	// given mode.
+	AfterRelease(m *Mutex, mode LockMode)
+}
+
+// NopLockPolicy is a LockPolicy that does nothing.  Embed it in policies
+// that only need some of the hooks.
+type NopLockPolicy struct{}
+
+// BeforeAcquire implements LockPolicy.
+func (NopLockPolicy) BeforeAcquire(m *Mutex, mode LockMode) error { return nil }
+
+// AfterAcquire implements LockPolicy.
+func (NopLockPolicy) AfterAcquire(m *Mutex, mode LockMode, waited time.Duration) {}
+
+// BeforeRelease implements LockPolicy.
+func (NopLockPolicy) BeforeRelease(m *Mutex, mode LockMode) {}
+
+// AfterRelease implements LockPolicy.
+func (NopLockPolicy) AfterRelease(m *Mutex, mode LockMode) {}
+
+// WithPolicy has the Mutex consult p on every acquisition and release.
+func WithPolicy(p LockPolicy) Option {
+	return func(m *Mutex) {
+		m.policy = p
+	}
+}
+
+// beforeAcquire is called at the start of every attempt to take the Mutex,
+// and returns an error if the attempt is to be refused outright.
+func (m *Mutex) beforeAcquire(mode LockMode) error {
+	if m.isShutdown() {
+		return ErrShutdown
+	}
+	if m.policy == nil {
+		return nil
+	}
+	return m.policy.BeforeAcquire(m, mode)
+}
@@ -0,0 +1,104 @@
+package ilock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errBreakerOpen = errors.New("breaker open")
+
+// recordingPolicy records the hooks it sees, and refuses everything while
+// open is set.
+type recordingPolicy struct {
+	calls []string
+	open  bool
+}
+
+func (p *recordingPolicy) BeforeAcquire(m *Mutex, mode LockMode) error {
+	p.calls = append(p.calls, fmt.Sprintf("BeforeAcquire %v", mode))
+	if p.open {
+		return errBreakerOpen
+	}
+	return nil
+}
+
+func (p *recordingPolicy) AfterAcquire(m *Mutex, mode LockMode, waited time.Duration) {
+	p.calls = append(p.calls, fmt.Sprintf("AfterAcquire %v", mode))
+}
+
+func (p *recordingPolicy) BeforeRelease(m *Mutex, mode LockMode) {
+	p.calls = append(p.calls, fmt.Sprintf("BeforeRelease %v", mode))
+}
+
+func (p *recordingPolicy) AfterRelease(m *Mutex, mode LockMode) {
+	p.calls = append(p.calls, fmt.Sprintf("AfterRelease %v", mode))
+}
+
+func TestLockPolicy(t *testing.T) {
+	p := &recordingPolicy{}
+	m := New(WithPolicy(p))
+
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, []string{
+		"BeforeAcquire S", "AfterAcquire S", "BeforeRelease S", "AfterRelease S",
+	}, p.calls)
+
+	p.calls = nil
+	p.open = true
+	assert.Equal(t, errBreakerOpen, m.XLockCtx(context.Background()))
+	assert.Equal(t, errBreakerOpen, m.LockRetry(ModeIX))
+	assert.False(t, m.TryISLock())
+	assert.PanicsWithValue(t, errBreakerOpen, m.XLock)
+	assert.Equal(t, uint64(0), m.load(), "Refused acquisition took the lock")
+	assert.Equal(t, []string{
+		"BeforeAcquire X", "BeforeAcquire IX", "BeforeAcquire IS", "BeforeAcquire X",
+	}, p.calls)
+}
+
+func TestLockPolicyLockChan(t *testing.T) {
+	p := &recordingPolicy{}
+	m := New(WithPolicy(p))
+
+	lc := m.ISLockChan()
+	<-lc.C
+	assert.NoError(t, lc.Err())
+	assert.NoError(t, m.ISUnlock())
+	assert.Equal(t, []string{
+		"BeforeAcquire IS", "AfterAcquire IS", "BeforeRelease IS", "AfterRelease IS",
+	}, p.calls)
+
+	// Granted by whoever releases the Mutex.
+	p.calls = nil
+	m.XLock()
+	lc = m.SLockChan()
+	assert.NoError(t, m.XUnlock())
+	<-lc.C
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, []string{
+		"BeforeAcquire X", "AfterAcquire X",
+		"BeforeAcquire S",
+		"BeforeRelease X", "AfterAcquire S", "AfterRelease X",
+		"BeforeRelease S", "AfterRelease S",
+	}, p.calls)
+
+	p.calls = nil
+	p.open = true
+	lc = m.XLockChan()
+	<-lc.C
+	assert.Equal(t, errBreakerOpen, lc.Err())
+	assert.False(t, lc.Cancel())
+	assert.Equal(t, uint64(0), m.load(), "Refused acquisition took the lock")
+	assert.Equal(t, []string{"BeforeAcquire X"}, p.calls)
+}
+
+func TestNopLockPolicy(t *testing.T) {
+	m := New(WithPolicy(NopLockPolicy{}))
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+}
@@ -0,0 +1,142 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// PriorityTable ranks the lock modes, indexed by mode, for deciding which
+// waiters to wake when the Mutex is released: higher values win.  Modes may
+// share a rank, in which case they're woken together.
+type PriorityTable [4]int
+
+// WriterPreference is the conventional priority table, and the one to reach
+// for by default: X > S > IX > IS.
+var WriterPreference = PriorityTable{ModeX: 4, ModeS: 3, ModeIX: 2, ModeIS: 1}
+
+// ReaderPreference favours the shared modes: S > X > IS > IX.
+var ReaderPreference = PriorityTable{ModeS: 4, ModeX: 3, ModeIS: 2, ModeIX: 1}
+
+// WithPriorityTable makes the Mutex pick who to wake when it's released,
+// rather than waking every waiter and letting them race for it.  Of the
+// modes that waiters are blocked in and that could take the lock there and
+// then, only those ranked highest by pt are woken; the rest keep waiting
+// until the next release, in whatever mode.  For instance, with WriterPreference, once the
+// last S holder leaves, X waiters get the lock ahead of IX waiters, rather
+// than whichever of them happens to run first.
+//
+// This costs throughput: waiters in modes compatible with the winners', say
+// IS alongside S, stay asleep until the winners release, even though they
+// could have shared the lock with them.  Channel waiters (see SLockChan et
+// al) are granted the lock in arrival order as usual.
+func WithPriorityTable(pt PriorityTable) Option {
+	return func(m *Mutex) {
+		m.priorities = &pt
+	}
+}
+
+// prioritize narrows the modes set in wake down to those, among the ones
+// with waiters that could take the lock right now, that rank highest in the
+// Mutex's PriorityTable.  The modes with waiters that it leaves out are
+// recorded in m.passedOver, for the next release to wake: that release may
+// well be one the sleepers are compatible with, which wouldn't otherwise
+// wake them.  Must be called with m.mtx held.
+func (m *Mutex) prioritize(wake [4]bool) [4]bool {
+	var ret [4]bool
+	var best int
+	found := false
+	state := m.load()
+	for _, mode := range modes {
+		if !wake[mode] || atomic.LoadInt32(&m.modeWaiters[mode]) == 0 || !m.canAcquire(mode, state) {
+			continue
+		}
+		p := m.priorities[mode]
+		if !found || p > best {
+			ret = [4]bool{}
+			best, found = p, true
+		}
+		if p == best {
+			ret[mode] = true
+		}
+	}
+	for _, mode := range modes {
+		if wake[mode] && !ret[mode] && atomic.LoadInt32(&m.modeWaiters[mode]) > 0 {
+			m.passedOver[mode] = true
+		}
+	}
+	return ret
+}
+
+// WithDrainCompatibleWaiters makes every release wake, in one round, as
+// many waiters as can hold the Mutex together: of the modes that waiters
+// are blocked in, it picks those that are compatible with the lock state
+// and with each other, and wakes only them, so that they all get in,
+// rather than waking everyone to race and re-evaluating after each grant.
+// For instance, when X is released with IS, S, IX and X waiters, the IS and
+// S waiters are all let in at once, and the IX and X waiters keep waiting.
+// This coalesces bursts of readers.
+//
+// Modes are considered in the order IS, S, IX, X, or, if the Mutex also has
+// a PriorityTable, in order of priority, so that the highest-priority mode
+// that can get in is woken along with everyone compatible with it.
+func WithDrainCompatibleWaiters() Option {
+	return func(m *Mutex) {
+		m.drainCompatible = true
+	}
+}
+
+// drainOrder is the order in which coalesce considers modes by default:
+// readers first, as they're the most likely to get in together.
+var drainOrder = [4]LockMode{ModeIS, ModeS, ModeIX, ModeX}
+
+// selectiveWakeups reports whether releases only wake some of the modes
+// they may have let in, in which case a waiter that gives up has to pass
+// its wakeup on.
+func (m *Mutex) selectiveWakeups() bool {
+	return m.priorities != nil || m.drainCompatible
+}
+
+// coalesce narrows the modes set in wake down to a set of modes with
+// waiters that could all take the lock right now, together; see
+// WithDrainCompatibleWaiters.  Must be called with m.mtx held.
+func (m *Mutex) coalesce(wake [4]bool) [4]bool {
+	order := drainOrder
+	if m.priorities != nil {
+		sort.SliceStable(order[:], func(i, j int) bool {
+			return m.priorities[order[i]] > m.priorities[order[j]]
+		})
+	}
+
+	var ret [4]bool
+	state := m.load()
+	for _, mode := range order {
+		if !wake[mode] || atomic.LoadInt32(&m.modeWaiters[mode]) == 0 || !m.canAcquire(mode, state) {
+			continue
+		}
+		ret[mode] = true
+		// Count the mode as held, so that later modes have to be
+		// compatible with it too.
+		state = setMode(mode, state, extractMode(mode, state)+1)
+	}
+	return ret
+}
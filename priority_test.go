@@ -0,0 +1,204 @@
+package ilock
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityTable(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		pt    PriorityTable
+		order []LockMode
+	}{
+		{"WriterPreference", WriterPreference, []LockMode{ModeS, ModeIX}},
+		{"IX first", PriorityTable{ModeIX: 1}, []LockMode{ModeIX, ModeS}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			m := New(WithPriorityTable(tc.pt))
+			m.XLock()
+
+			// S and IX are incompatible, so whichever is woken first
+			// has to release before the other can get in.
+			acquired := make(chan LockMode, 2)
+			go func() {
+				m.SLock()
+				acquired <- ModeS
+				m.SUnlock()
+			}()
+			go func() {
+				m.IXLock()
+				acquired <- ModeIX
+				m.IXUnlock()
+			}()
+			time.Sleep(5 * time.Millisecond)
+
+			assert.NoError(t, m.XUnlock())
+			for _, mode := range tc.order {
+				select {
+				case got := <-acquired:
+					assert.Equal(t, mode, got)
+				case <-time.After(time.Second):
+					t.Fatalf("%v waiter never woken", mode)
+				}
+			}
+		})
+	}
+}
+
+func TestPriorityTablePassedOverWaiters(t *testing.T) {
+	m := New(WithPriorityTable(WriterPreference))
+	m.XLock()
+
+	// S wins when X is released, and IS, though compatible with it, is
+	// left asleep; S's release mustn't forget about it.
+	acquired := make(chan LockMode, 2)
+	go func() {
+		m.SLock()
+		acquired <- ModeS
+		m.SUnlock()
+	}()
+	go func() {
+		m.ISLock()
+		acquired <- ModeIS
+		m.ISUnlock()
+	}()
+	for m.NumWaiters(ModeS) != 1 || m.NumWaiters(ModeIS) != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	assert.NoError(t, m.XUnlock())
+	for i := 0; i < 2; i++ {
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatalf("Waiter never woken: state %x, %d IS waiters", m.load(), m.NumWaiters(ModeIS))
+		}
+	}
+}
+
+func TestPrioritize(t *testing.T) {
+	m := New(WithPriorityTable(WriterPreference))
+	assert.Equal(t, [4]bool{}, m.prioritize(allModes), "No waiters to wake")
+
+	m.modeWaiters = [4]int32{ModeIX: 1, ModeIS: 2}
+	assert.Equal(t, [4]bool{ModeIX: true}, m.prioritize(allModes))
+	assert.Equal(t, [4]bool{ModeIS: true}, m.passedOver, "IS should be woken next time")
+	assert.Equal(t, [4]bool{ModeIS: true}, m.prioritize([4]bool{ModeIS: true}))
+
+	// IX can't get in while S is held, so IS is the best we can do.
+	m.SLock()
+	assert.Equal(t, [4]bool{ModeIS: true}, m.prioritize(allModes))
+	assert.NoError(t, m.SUnlock())
+
+	m = New(WithPriorityTable(PriorityTable{ModeS: 1, ModeIS: 1}))
+	m.modeWaiters = [4]int32{ModeX: 1, ModeS: 1, ModeIS: 1}
+	assert.Equal(t, [4]bool{ModeS: true, ModeIS: true}, m.prioritize(allModes), "Ties should be woken together")
+}
+
+func TestDrainCompatibleWaiters(t *testing.T) {
+	m := New(WithDrainCompatibleWaiters())
+	m.XLock()
+
+	acquired := make(chan LockMode, 4)
+	var release sync.WaitGroup
+	release.Add(1)
+	for _, mode := range []LockMode{ModeIX, ModeS, ModeIS, ModeX} {
+		mode := mode
+		go func() {
+			m.Lock(mode)
+			acquired <- mode
+			release.Wait()
+			m.Unlock(mode)
+		}()
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// S and IS get in together, and hold IX and X off until they release.
+	assert.NoError(t, m.XUnlock())
+	var got []LockMode
+	for i := 0; i < 2; i++ {
+		select {
+		case mode := <-acquired:
+			got = append(got, mode)
+		case <-time.After(time.Second):
+			t.Fatalf("Only %v woken", got)
+		}
+	}
+	assert.ElementsMatch(t, []LockMode{ModeS, ModeIS}, got)
+	select {
+	case mode := <-acquired:
+		t.Fatalf("%v woken alongside S and IS", mode)
+	case <-time.After(5 * time.Millisecond):
+	}
+	release.Done()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("IX and X waiters never woken")
+		}
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	m := New(WithDrainCompatibleWaiters())
+	m.modeWaiters = [4]int32{1, 1, 1, 1}
+	assert.Equal(t, [4]bool{ModeS: true, ModeIS: true}, m.coalesce(allModes))
+	assert.Equal(t, [4]bool{ModeIX: true, ModeIS: true}, m.coalesce([4]bool{ModeX: true, ModeIX: true, ModeIS: true}))
+
+	// With priorities, the highest-priority mode goes first.
+	m = New(WithDrainCompatibleWaiters(), WithPriorityTable(PriorityTable{ModeIX: 1}))
+	m.modeWaiters = [4]int32{1, 1, 1, 1}
+	assert.Equal(t, [4]bool{ModeIX: true, ModeIS: true}, m.coalesce(allModes))
+}
+
+// benchmarkBurstReads has a writer take X periodically while readers pile
+// up behind it in S and IS, and are released in a burst when it leaves.
+func benchmarkBurstReads(b *testing.B, opts ...Option) {
+	m := New(opts...)
+	stop := make(chan struct{})
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			m.XLock()
+			time.Sleep(10 * time.Microsecond)
+			m.XUnlock()
+			time.Sleep(10 * time.Microsecond)
+		}
+	}()
+
+	b.SetParallelism(8)
+	b.RunParallel(func(pb *testing.PB) {
+		mode := ModeS
+		for pb.Next() {
+			m.Lock(mode)
+			m.Unlock(mode)
+			if mode == ModeS {
+				mode = ModeIS
+			} else {
+				mode = ModeS
+			}
+		}
+	})
+	close(stop)
+	writer.Wait()
+}
+
+func BenchmarkBurstReads(b *testing.B) {
+	benchmarkBurstReads(b)
+}
+
+func BenchmarkBurstReadsDrainCompatible(b *testing.B) {
+	benchmarkBurstReads(b, WithDrainCompatibleWaiters())
+}
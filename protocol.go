@@ -0,0 +1,76 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// ProtocolViolation is a node found by VerifyProtocol to be locked without
+// the intention lock it needs on one of its ancestors.
+type ProtocolViolation struct {
+	Node, Ancestor *Mutex
+	Violation      string
+}
+
+// VerifyProtocol walks the tree of Mutexes below root, as given by children,
+// and checks that the intention lock protocol is being followed: every
+// node held in S has every ancestor held in IS or IX, and every node held
+// in X has every ancestor held in IX.  It returns a ProtocolViolation for
+// each ancestor that isn't, in depth-first order.
+//
+// It's meant for tests of tree-based code, to be called between operations
+// while the tree is quiescent, to catch any node that was locked without
+// first taking the intention locks above it.  The check reads each Mutex's
+// state once, without blocking, so run concurrently with locking it can
+// report violations that are only half-way through being set up, or miss
+// real ones.  children must not return any node more than once.
+func VerifyProtocol(root *Mutex, children func(*Mutex) []*Mutex) []ProtocolViolation {
+	var violations []ProtocolViolation
+	var walk func(node *Mutex, ancestors []*Mutex)
+	walk = func(node *Mutex, ancestors []*Mutex) {
+		if node.IsShared() {
+			for _, a := range ancestors {
+				if !a.IsIntentionShared() && !a.IsIntentionExclusive() {
+					violations = append(violations, ProtocolViolation{
+						Node:      node,
+						Ancestor:  a,
+						Violation: "S held without IS or IX on ancestor",
+					})
+				}
+			}
+		}
+		if node.IsExclusive() {
+			for _, a := range ancestors {
+				if !a.IsIntentionExclusive() {
+					violations = append(violations, ProtocolViolation{
+						Node:      node,
+						Ancestor:  a,
+						Violation: "X held without IX on ancestor",
+					})
+				}
+			}
+		}
+
+		ancestors = append(ancestors[:len(ancestors):len(ancestors)], node)
+		for _, child := range children(node) {
+			walk(child, ancestors)
+		}
+	}
+	walk(root, nil)
+	return violations
+}
@@ -0,0 +1,42 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyProtocol(t *testing.T) {
+	//      root
+	//     /    \
+	//    a      b
+	//    |
+	//    c
+	root, a, b, c := New(), New(), New(), New()
+	tree := map[*Mutex][]*Mutex{root: {a, b}, a: {c}}
+	children := func(m *Mutex) []*Mutex { return tree[m] }
+
+	assert.Empty(t, VerifyProtocol(root, children))
+
+	LockPath{root, a, c}.SLock()
+	LockPath{root, b}.XLock()
+	assert.Empty(t, VerifyProtocol(root, children))
+	assert.NoError(t, LockPath{root, b}.XUnlock())
+	assert.NoError(t, LockPath{root, a, c}.SUnlock())
+
+	// c is taken in S with IS on a, but nothing on the root.
+	a.ISLock()
+	c.SLock()
+	assert.Equal(t, []ProtocolViolation{
+		{Node: c, Ancestor: root, Violation: "S held without IS or IX on ancestor"},
+	}, VerifyProtocol(root, children))
+	assert.NoError(t, c.SUnlock())
+	assert.NoError(t, a.ISUnlock())
+
+	// b is taken in X with only IS on the root.
+	root.ISLock()
+	b.XLock()
+	assert.Equal(t, []ProtocolViolation{
+		{Node: b, Ancestor: root, Violation: "X held without IX on ancestor"},
+	}, VerifyProtocol(root, children))
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// The functions in this file expose the Mutex's packed state word, for
+// building custom locking protocols on top of it.  Nothing here checks mode
+// compatibility, holder limits or shutdown, and nothing wakes up goroutines
+// blocked on the Mutex; callers that change the state are responsible for
+// all of that themselves, and for leaving the Mutex in a state that its own
+// methods can make sense of.  Holder counts are 16 bits wide, and the Set
+// functions don't check that the value they're given fits.
+
+// RawState returns the Mutex's packed state word; see the Mutex
+// documentation for its layout.
+func (m *Mutex) RawState() uint64 {
+	return m.load()
+}
+
+// CAS atomically replaces the Mutex's packed state word with desired, if it
+// is currently expected, and reports whether it did so.
+func (m *Mutex) CAS(expected, desired uint64) bool {
+	return m.cas(expected, desired)
+}
+
+// ExtractX returns the number of X holders recorded in a state word.
+func ExtractX(state uint64) uint64 { return extractX(state) }
+
+// ExtractS returns the number of S holders recorded in a state word.
+func ExtractS(state uint64) uint64 { return extractS(state) }
+
+// ExtractIX returns the number of IX holders recorded in a state word.
+func ExtractIX(state uint64) uint64 { return extractIX(state) }
+
+// ExtractIS returns the number of IS holders recorded in a state word.
+func ExtractIS(state uint64) uint64 { return extractIS(state) }
+
+// SetX returns state with its X holder count replaced by val.
+func SetX(state, val uint64) uint64 { return setX(state, val) }
+
+// SetS returns state with its S holder count replaced by val.
+func SetS(state, val uint64) uint64 { return setS(state, val) }
+
+// SetIX returns state with its IX holder count replaced by val.
+func SetIX(state, val uint64) uint64 { return setIX(state, val) }
+
+// SetIS returns state with its IS holder count replaced by val.
+func SetIS(state, val uint64) uint64 { return setIS(state, val) }
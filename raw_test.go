@@ -0,0 +1,28 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRawState(t *testing.T) {
+	m := New()
+	m.SLock()
+	state := m.RawState()
+	assert.Equal(t, uint64(1), ExtractS(state))
+	assert.Equal(t, uint64(0), ExtractX(state)+ExtractIX(state)+ExtractIS(state))
+
+	// A hand-rolled IS acquisition.
+	assert.True(t, m.CAS(state, SetIS(state, ExtractIS(state)+1)))
+	assert.False(t, m.CAS(state, SetIX(state, 1)), "CAS succeeded against a stale state")
+	assert.Equal(t, SetIS(SetS(0, 1), 1), m.RawState())
+
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, uint64(0), m.RawState())
+
+	state = SetIX(SetX(0, 3), 4)
+	assert.Equal(t, uint64(3), ExtractX(state))
+	assert.Equal(t, uint64(4), ExtractIX(state))
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// LockRegistry tracks a set of named Mutexes so that the state of every lock
+// in the process can be inspected at once, e.g. from a /debug/ilocks HTTP
+// handler.  A LockRegistry is safe for concurrent use.
+//
+// The registry holds a reference to each registered Mutex, so a Mutex that
+// is no longer needed should be unregistered in order for it to be garbage
+// collected.
+type LockRegistry struct {
+	mtx     sync.Mutex
+	mutexes map[*Mutex]string
+}
+
+var defaultRegistry = NewLockRegistry()
+
+// NewLockRegistry returns a new, empty, LockRegistry.
+func NewLockRegistry() *LockRegistry {
+	return &LockRegistry{mutexes: make(map[*Mutex]string)}
+}
+
+// DefaultRegistry returns the registry that Mutexes created with WithName
+// are registered with.
+func DefaultRegistry() *LockRegistry {
+	return defaultRegistry
+}
+
+// WithName names the Mutex and registers it with the default registry.
+func WithName(name string) Option {
+	return func(m *Mutex) {
+		m.name = name
+	}
+}
+
+// SetName names the Mutex after it has been created, e.g. for a trie node
+// that only learns its path once it is linked in.  It may be called
+// concurrently with the Mutex's other methods.
+//
+// Unlike WithName, SetName doesn't touch any registry; a Mutex that has
+// already been registered keeps its old name there until it is registered
+// again under the new one.
+func (m *Mutex) SetName(name string) {
+	m.mtx.Lock()
+	m.name = name
+	m.mtx.Unlock()
+}
+
+// Name returns the name set by WithName or SetName, or the empty string if
+// the Mutex is unnamed.
+func (m *Mutex) Name() string {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.name
+}
+
+// logName returns the Mutex's name for use in log messages, which is
+// "(unnamed)" if it doesn't have one.
+func (m *Mutex) logName() string {
+	if name := m.Name(); name != "" {
+		return name
+	}
+	return "(unnamed)"
+}
+
+// Register adds m to the registry under the given name.  Registering a Mutex
+// a second time replaces its name.
+func (r *LockRegistry) Register(m *Mutex, name string) {
+	r.mtx.Lock()
+	r.mutexes[m] = name
+	r.mtx.Unlock()
+}
+
+// Unregister removes m from the registry.  It is a no-op if m was never
+// registered.
+func (r *LockRegistry) Unregister(m *Mutex) {
+	r.mtx.Lock()
+	delete(r.mutexes, m)
+	r.mtx.Unlock()
+}
+
+// Dump writes a table of the current state of all registered Mutexes to w,
+// ordered by name.  Each Mutex's state is read atomically, but the table as a
+// whole is not a consistent snapshot across Mutexes.
+func (r *LockRegistry) Dump(w io.Writer) error {
+	type entry struct {
+		name  string
+		state uint64
+	}
+
+	r.mtx.Lock()
+	entries := make([]entry, 0, len(r.mutexes))
+	for m, name := range r.mutexes {
+		entries = append(entries, entry{name, m.load()})
+	}
+	r.mtx.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tX\tS\tIX\tIS")
+	for _, e := range entries {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\n", e.name,
+			extractX(e.state), extractS(e.state), extractIX(e.state), extractIS(e.state))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,75 @@
+package ilock
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistryDump(t *testing.T) {
+	r := NewLockRegistry()
+
+	a := New()
+	b := New()
+	r.Register(b, "b")
+	r.Register(a, "a")
+
+	a.XLock()
+	b.IXLock()
+	b.ISLock()
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Dump(&buf))
+	assert.Equal(t, ""+
+		"NAME  X  S  IX  IS\n"+
+		"a     1  0  0   0\n"+
+		"b     0  0  1   1\n", buf.String())
+
+	r.Unregister(a)
+	buf.Reset()
+	assert.NoError(t, r.Dump(&buf))
+	assert.Equal(t, ""+
+		"NAME  X  S  IX  IS\n"+
+		"b     0  0  1   1\n", buf.String())
+
+	a.XUnlock()
+	b.ISUnlock()
+	b.IXUnlock()
+}
+
+func TestWithNameRegisters(t *testing.T) {
+	m := New(WithName("TestWithNameRegisters"))
+	defer DefaultRegistry().Unregister(m)
+
+	var buf bytes.Buffer
+	assert.NoError(t, DefaultRegistry().Dump(&buf))
+	assert.Contains(t, buf.String(), "TestWithNameRegisters")
+}
+
+func TestSetName(t *testing.T) {
+	m := New()
+	assert.Equal(t, "", m.Name())
+
+	done := make(chan bool)
+	go func() {
+		m.XLock()
+		m.XUnlockMust()
+		done <- true
+	}()
+	m.SetName("renamed")
+	<-done
+	assert.Equal(t, "renamed", m.Name())
+
+	m = New(WithName("constructed"))
+	defer DefaultRegistry().Unregister(m)
+	assert.Equal(t, "constructed", m.Name())
+}
+
+func TestLogName(t *testing.T) {
+	m := New()
+	assert.Equal(t, "(unnamed)", m.logName())
+	m.SetName("named")
+	defer DefaultRegistry().Unregister(m)
+	assert.Equal(t, "named", m.logName())
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// LockReleaseGroup collects the locks taken during a traversal so that they
+// can all be released at once, in the reverse of the order they were taken:
+//
+//	var g LockReleaseGroup
+//	defer g.ReleaseAll()
+//	for _, m := range path {
+//		m.ISLock()
+//		g.Add(m, ModeIS)
+//	}
+//
+// The zero value is an empty group.  A LockReleaseGroup is not safe for
+// concurrent use.
+type LockReleaseGroup struct {
+	entries []releaseEntry
+}
+
+type releaseEntry struct {
+	m    *Mutex
+	mode LockMode
+}
+
+// Add records that m is held in the given mode.
+func (g *LockReleaseGroup) Add(m *Mutex, mode LockMode) {
+	g.entries = append(g.entries, releaseEntry{m, mode})
+}
+
+// ReleaseAll releases every lock in the group, most recently added first,
+// and empties the group.  Returns the first error encountered, but carries
+// on releasing the rest.
+func (g *LockReleaseGroup) ReleaseAll() error {
+	var err error
+	for i := len(g.entries) - 1; i >= 0; i-- {
+		if e := g.entries[i].m.unlock(g.entries[i].mode); e != nil && err == nil {
+			err = e
+		}
+	}
+	g.Clear()
+	return err
+}
+
+// Len returns the number of locks in the group.
+func (g *LockReleaseGroup) Len() int {
+	return len(g.entries)
+}
+
+// Clear empties the group without releasing anything, so that it can be
+// reused.
+func (g *LockReleaseGroup) Clear() {
+	g.entries = g.entries[:0]
+}
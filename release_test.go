@@ -0,0 +1,38 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockReleaseGroup(t *testing.T) {
+	p := newPath(3)
+
+	var g LockReleaseGroup
+	for _, m := range p[:2] {
+		m.IXLock()
+		g.Add(m, ModeIX)
+	}
+	p[2].XLock()
+	g.Add(p[2], ModeX)
+	assert.Equal(t, 3, g.Len())
+
+	assert.NoError(t, g.ReleaseAll())
+	assert.Equal(t, 0, g.Len())
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+
+	// A bad entry doesn't stop the rest from being released.
+	p[0].SLock()
+	g.Add(p[0], ModeS)
+	g.Add(p[1], ModeS)
+	assert.Equal(t, &LockUnderflowError{Mode: ModeS}, g.ReleaseAll())
+	assert.Equal(t, uint64(0), p[0].load())
+
+	g.Add(p[0], ModeX)
+	g.Clear()
+	assert.Equal(t, 0, g.Len())
+	assert.NoError(t, g.ReleaseAll())
+}
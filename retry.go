@@ -0,0 +1,171 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRetryAborted is returned by LockRetry when the Mutex's RetryPolicy gives
+// up on taking the lock.
+var ErrRetryAborted = errors.New("ilock: retry policy aborted lock acquisition")
+
+// RetryPolicy decides how LockRetry behaves while the lock is unavailable.
+// attempt counts the failed attempts so far, starting from 1, and elapsed is
+// the time since the first one.
+type RetryPolicy interface {
+	// NextWait returns how long to sleep before the next attempt.
+	NextWait(attempt int, elapsed time.Duration) time.Duration
+	// ShouldAbort reports whether to give up instead of trying again.
+	ShouldAbort(attempt int, elapsed time.Duration) bool
+}
+
+// defaultRetryPolicy is used by Mutexes that weren't given a RetryPolicy.
+var defaultRetryPolicy RetryPolicy = ExponentialRetryPolicy{
+	Starting: 50 * time.Microsecond,
+	Max:      500 * time.Millisecond,
+	Factor:   2,
+}
+
+// WithRetryPolicy sets the policy that LockRetry follows when the Mutex can't
+// be taken straight away.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(m *Mutex) {
+		m.retryPolicy = p
+	}
+}
+
+// ExponentialRetryPolicy waits Starting before the first retry, multiplies
+// the wait by Factor after every subsequent failure up to a limit of Max, and
+// never gives up.
+type ExponentialRetryPolicy struct {
+	Starting, Max time.Duration
+	Factor        float64
+}
+
+// NextWait implements RetryPolicy.
+func (p ExponentialRetryPolicy) NextWait(attempt int, elapsed time.Duration) time.Duration {
+	wait := p.Starting
+	for i := 1; i < attempt && wait < p.Max; i++ {
+		wait = time.Duration(float64(wait) * p.Factor)
+	}
+	if wait > p.Max {
+		wait = p.Max
+	}
+	return wait
+}
+
+// ShouldAbort implements RetryPolicy.
+func (p ExponentialRetryPolicy) ShouldAbort(attempt int, elapsed time.Duration) bool {
+	return false
+}
+
+// LinearRetryPolicy waits Step longer after every failure, up to a limit of
+// Max, and never gives up.
+type LinearRetryPolicy struct {
+	Step, Max time.Duration
+}
+
+// NextWait implements RetryPolicy.
+func (p LinearRetryPolicy) NextWait(attempt int, elapsed time.Duration) time.Duration {
+	wait := p.Step * time.Duration(attempt)
+	if wait > p.Max {
+		wait = p.Max
+	}
+	return wait
+}
+
+// ShouldAbort implements RetryPolicy.
+func (p LinearRetryPolicy) ShouldAbort(attempt int, elapsed time.Duration) bool {
+	return false
+}
+
+// MaxAttemptsPolicy follows Inner, but gives up after N failed attempts.  If
+// Inner is nil, it retries straight away, without sleeping.
+type MaxAttemptsPolicy struct {
+	N     int
+	Inner RetryPolicy
+}
+
+// NextWait implements RetryPolicy.
+func (p MaxAttemptsPolicy) NextWait(attempt int, elapsed time.Duration) time.Duration {
+	if p.Inner == nil {
+		return 0
+	}
+	return p.Inner.NextWait(attempt, elapsed)
+}
+
+// ShouldAbort implements RetryPolicy.
+func (p MaxAttemptsPolicy) ShouldAbort(attempt int, elapsed time.Duration) bool {
+	return attempt >= p.N || (p.Inner != nil && p.Inner.ShouldAbort(attempt, elapsed))
+}
+
+// NoRetryPolicy gives up as soon as the first attempt fails, which makes
+// LockRetry non-blocking.
+type NoRetryPolicy struct{}
+
+// NextWait implements RetryPolicy.
+func (NoRetryPolicy) NextWait(attempt int, elapsed time.Duration) time.Duration {
+	return 0
+}
+
+// ShouldAbort implements RetryPolicy.
+func (NoRetryPolicy) ShouldAbort(attempt int, elapsed time.Duration) bool {
+	return true
+}
+
+// LockRetry takes the Mutex in the given mode by polling rather than by
+// waiting on the condvar, sleeping between attempts as directed by the
+// Mutex's RetryPolicy.  Returns ErrRetryAborted if the policy gives up, or
+// ErrHolderLimitExceeded if it gave up while the only thing stopping the
+// acquisition was the limit set by WithMaxHolders.
+func (m *Mutex) LockRetry(mode LockMode) error {
+	if err := m.beforeAcquire(mode); err != nil {
+		return err
+	}
+	p := m.retryPolicy
+	if p == nil {
+		p = defaultRetryPolicy
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		if m.tryAcquire(mode) {
+			var waited time.Duration
+			if attempt > 1 {
+				waited = time.Since(start)
+				m.waited(mode, waited)
+			}
+			m.acquired(mode, waited)
+			return nil
+		}
+
+		elapsed := time.Since(start)
+		if p.ShouldAbort(attempt, elapsed) {
+			if state := m.load(); m.compatible(mode, state) && !m.underLimit(mode, state) {
+				return ErrHolderLimitExceeded
+			}
+			return ErrRetryAborted
+		}
+		time.Sleep(p.NextWait(attempt, elapsed))
+	}
+}
@@ -0,0 +1,85 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponentialRetryPolicy(t *testing.T) {
+	p := ExponentialRetryPolicy{Starting: time.Millisecond, Max: 5 * time.Millisecond, Factor: 2}
+	assert.Equal(t, 1*time.Millisecond, p.NextWait(1, 0))
+	assert.Equal(t, 2*time.Millisecond, p.NextWait(2, 0))
+	assert.Equal(t, 4*time.Millisecond, p.NextWait(3, 0))
+	assert.Equal(t, 5*time.Millisecond, p.NextWait(4, 0))
+	assert.Equal(t, 5*time.Millisecond, p.NextWait(100, 0))
+	assert.False(t, p.ShouldAbort(100, time.Hour))
+}
+
+func TestLinearRetryPolicy(t *testing.T) {
+	p := LinearRetryPolicy{Step: time.Millisecond, Max: 3 * time.Millisecond}
+	assert.Equal(t, 1*time.Millisecond, p.NextWait(1, 0))
+	assert.Equal(t, 2*time.Millisecond, p.NextWait(2, 0))
+	assert.Equal(t, 3*time.Millisecond, p.NextWait(3, 0))
+	assert.Equal(t, 3*time.Millisecond, p.NextWait(4, 0))
+	assert.False(t, p.ShouldAbort(100, time.Hour))
+}
+
+func TestNoRetryPolicy(t *testing.T) {
+	m := New(WithRetryPolicy(NoRetryPolicy{}))
+	assert.NoError(t, m.LockRetry(ModeX))
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeS))
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeX))
+	m.XUnlock()
+
+	assert.NoError(t, m.LockRetry(ModeS))
+	m.SUnlock()
+}
+
+type countingPolicy struct {
+	attempts int
+}
+
+func (p *countingPolicy) NextWait(attempt int, elapsed time.Duration) time.Duration {
+	p.attempts = attempt
+	return 0
+}
+
+func (p *countingPolicy) ShouldAbort(attempt int, elapsed time.Duration) bool {
+	return false
+}
+
+func TestMaxAttemptsPolicy(t *testing.T) {
+	inner := &countingPolicy{}
+	m := New(WithRetryPolicy(MaxAttemptsPolicy{N: 3, Inner: inner}))
+	m.IXLock()
+
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeS))
+	assert.Equal(t, 2, inner.attempts, "Expected two waits between three attempts")
+	m.IXUnlock()
+}
+
+func TestMaxAttemptsPolicyNilInner(t *testing.T) {
+	p := MaxAttemptsPolicy{N: 3}
+	assert.Equal(t, time.Duration(0), p.NextWait(1, time.Second))
+	assert.False(t, p.ShouldAbort(2, time.Second))
+	assert.True(t, p.ShouldAbort(3, time.Second))
+
+	m := New(WithRetryPolicy(p))
+	m.IXLock()
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeS))
+	m.IXUnlock()
+}
+
+func TestLockRetryEventuallySucceeds(t *testing.T) {
+	m := New()
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlock()
+	}()
+
+	assert.NoError(t, m.LockRetry(ModeX))
+	m.XUnlock()
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+// Package semaphore implements a counting semaphore on top of an
+// ilock.Mutex, by capping the number of goroutines that may hold it in S.
+package semaphore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dijkstracula/go-ilock"
+)
+
+// Semaphore admits up to a fixed number of concurrent holders.
+type Semaphore struct {
+	m *ilock.Mutex
+}
+
+// NewSemaphore returns a Semaphore admitting up to n holders at once, which
+// takes over m's S holder limit.  m should not be in use by anyone else;
+// while the semaphore is in use, taking m in any mode other than S or IS
+// blocks out every holder.
+func NewSemaphore(m *ilock.Mutex, n int) *Semaphore {
+	if n <= 0 || n > 0xffff {
+		panic(fmt.Sprintf("semaphore: size %d out of range", n))
+	}
+	m.SetMaxHolders(ilock.ModeS, uint16(n))
+	return &Semaphore{m: m}
+}
+
+// Acquire blocks until the semaphore has room for another holder.
+func (s *Semaphore) Acquire() error {
+	return s.AcquireCtx(context.Background())
+}
+
+// AcquireCtx blocks until the semaphore has room for another holder, or ctx
+// is done, in which case it returns ctx.Err().
+func (s *Semaphore) AcquireCtx(ctx context.Context) error {
+	return s.m.SLockCtx(ctx)
+}
+
+// Release gives up a slot taken by Acquire.  It panics if there are no
+// holders.
+func (s *Semaphore) Release() {
+	s.m.SUnlockMust()
+}
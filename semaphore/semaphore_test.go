@@ -0,0 +1,78 @@
+package semaphore
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dijkstracula/go-ilock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSemaphoreBound(t *testing.T) {
+	s := NewSemaphore(ilock.New(), 3)
+
+	var holders, peak int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, s.Acquire())
+			n := atomic.AddInt32(&holders, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+			s.Release()
+		}()
+	}
+	wg.Wait()
+	assert.True(t, peak <= 3, "Saw %d concurrent holders", peak)
+}
+
+func TestSemaphoreAcquireCtx(t *testing.T) {
+	s := NewSemaphore(ilock.New(), 1)
+	assert.NoError(t, s.Acquire())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.AcquireCtx(ctx))
+
+	s.Release()
+	assert.NoError(t, s.AcquireCtx(context.Background()))
+	s.Release()
+	assert.Panics(t, s.Release)
+}
+
+// chanSemaphore is the usual buffered channel idiom, for comparison.
+type chanSemaphore chan struct{}
+
+func (c chanSemaphore) Acquire() { c <- struct{}{} }
+func (c chanSemaphore) Release() { <-c }
+
+func BenchmarkSemaphore(b *testing.B) {
+	s := NewSemaphore(ilock.New(), 4)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.Acquire()
+			s.Release()
+		}
+	})
+}
+
+func BenchmarkChanSemaphore(b *testing.B) {
+	c := make(chanSemaphore, 4)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Acquire()
+			c.Release()
+		}
+	})
+}
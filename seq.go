@@ -0,0 +1,79 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// The Mutex doubles as a seqlock, for read-mostly data whose writers are
+// brief: a reader that can tolerate retrying doesn't need to take the lock
+// at all.  Writers take the Mutex in X as usual, while readers do:
+//
+//	for {
+//		v := m.SeqBegin()
+//		// ...copy out the protected data...
+//		if m.SeqEnd(v) {
+//			break
+//		}
+//	}
+//
+// The data a reader copies may be torn by a concurrent writer, so it mustn't
+// act on it until SeqEnd has confirmed there wasn't one; and since the
+// reader holds no lock, it can't see or be seen by S or IS holders.
+
+// SeqRead returns the Mutex's sequence number, which is odd while it is held
+// in X and even otherwise, and changes with every X acquisition and release.
+func (m *Mutex) SeqRead() uint64 {
+	return atomic.LoadUint64(&m.seq)
+}
+
+// SeqBegin waits until the Mutex isn't held in X and returns the (even)
+// sequence number, to be handed to SeqEnd after reading.
+func (m *Mutex) SeqBegin() uint64 {
+	for {
+		if v := m.SeqRead(); v&1 == 0 {
+			return v
+		}
+		runtime.Gosched()
+	}
+}
+
+// SeqEnd reports whether no writer has held the Mutex since SeqBegin returned
+// v, i.e. whether what was read in between is consistent.
+func (m *Mutex) SeqEnd(v uint64) bool {
+	return m.SeqRead() == v
+}
+
+// beginWrite marks the start of an X hold.
+func (m *Mutex) beginWrite() {
+	atomic.AddUint64(&m.seq, 1)
+}
+
+// endWrite marks the end of an X hold, if there is one.  It must be called
+// with m.mtx held, at a point where no new X holder can have come along and
+// begun writing.
+func (m *Mutex) endWrite() {
+	if m.SeqRead()&1 == 1 {
+		atomic.AddUint64(&m.seq, 1)
+	}
+}
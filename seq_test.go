@@ -0,0 +1,69 @@
+package ilock
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeq(t *testing.T) {
+	m := New()
+	v := m.SeqBegin()
+	assert.Equal(t, uint64(0), v)
+
+	m.SLock()
+	assert.True(t, m.SeqEnd(v), "Readers disturbed the sequence")
+	assert.NoError(t, m.SUnlock())
+
+	m.XLock()
+	assert.Equal(t, uint64(1), m.SeqRead()&1, "Sequence even while held in X")
+	assert.False(t, m.SeqEnd(v))
+	assert.NoError(t, m.XUnlock())
+	assert.Equal(t, uint64(2), m.SeqRead())
+
+	assert.Error(t, m.XUnlock())
+	assert.Equal(t, uint64(2), m.SeqRead(), "Failed unlock moved the sequence")
+
+	m.XLock()
+	assert.NoError(t, m.SwitchMode(ModeX, ModeS))
+	assert.Equal(t, uint64(4), m.SeqRead())
+	assert.NoError(t, m.SUnlock())
+
+	quietLog(t)
+	m.XLock()
+	m.ForceUnlock(ModeX)
+	assert.Equal(t, uint64(6), m.SeqRead())
+}
+
+func TestSeqReaders(t *testing.T) {
+	m := New()
+	var a, b int64
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := int64(1); i <= 1000; i++ {
+			m.XLock()
+			atomic.StoreInt64(&a, i)
+			atomic.StoreInt64(&b, -i)
+			m.XUnlockMust()
+		}
+	}()
+
+	for done := false; !done; {
+		var x, y int64
+		for {
+			v := m.SeqBegin()
+			x, y = atomic.LoadInt64(&a), atomic.LoadInt64(&b)
+			if m.SeqEnd(v) {
+				break
+			}
+		}
+		assert.Equal(t, x, -y, "Read a torn write")
+		done = x == 1000
+	}
+	wg.Wait()
+}
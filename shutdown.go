@@ -0,0 +1,122 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrShutdown is returned by attempts to take a Mutex that has been shut
+// down by GracefulShutdown.
+var ErrShutdown = errors.New("ilock: mutex has been shut down")
+
+// GracefulShutdown retires the Mutex: from now on, every attempt to take it
+// fails with ErrShutdown (or, for the lock methods that can't return an
+// error, panics with it), including those already blocked.  Existing
+// holders are left alone, and GracefulShutdown blocks until they have all
+// released the Mutex, returning ctx.Err() if ctx is done first.  The Mutex
+// stays shut down either way; there's no undoing it.
+//
+// Pending LockChans are never granted once the Mutex has been shut down.
+func (m *Mutex) GracefulShutdown(ctx context.Context) error {
+	m.mtx.Lock()
+	atomic.StoreInt32(&m.shutdown, 1)
+	m.broadcast()
+	m.mtx.Unlock()
+
+	return m.waitUntil(ctx, func(state uint64) bool {
+		return state == 0
+	})
+}
+
+// QuiesceChan returns a channel that's closed once the Mutex has quiesced:
+// GracefulShutdown has been called, so no new acquisitions are let in, and
+// the last holder has left.  Any number of goroutines can wait on the
+// channel, and they're all released together.  Until GracefulShutdown is
+// called, the channel stays open however often the Mutex drains, as new
+// holders could still arrive.
+//
+// Unlike GracefulShutdown, waiting doesn't tie up a goroutine, so it fits
+// into a select, e.g. in a shutdown sequence where someone else calls
+// GracefulShutdown:
+//
+//	select {
+//	case <-m.QuiesceChan():
+//		proceed()
+//	case <-ctx.Done():
+//		abort()
+//	}
+//
+// A Mutex that has been shut down can't be taken again, so once the channel
+// has been closed, QuiesceChan keeps returning it.
+func (m *Mutex) QuiesceChan() <-chan struct{} {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.quiesced == nil {
+		m.quiesced = make(chan struct{})
+	}
+	m.checkQuiesced()
+	return m.quiesced
+}
+
+// checkQuiesced closes the channel returned by QuiesceChan, if there is one
+// and it's due.  Called with m.mtx held from every broadcast, which covers
+// GracefulShutdown and every release in the slow path, and so the one that
+// drains the Mutex.
+func (m *Mutex) checkQuiesced() {
+	if m.quiesced == nil || m.quiesceClosed || !m.isShutdown() || m.load() != 0 {
+		return
+	}
+	close(m.quiesced)
+	m.quiesceClosed = true
+}
+
+// isShutdown reports whether GracefulShutdown has been called.
+func (m *Mutex) isShutdown() bool {
+	return atomic.LoadInt32(&m.shutdown) != 0
+}
+
+// revoke backs out an acquisition in the given mode made by a lock-free
+// fast path that raced with GracefulShutdown.  As with any other release,
+// someone may have been waiting for our hold to go away.
+func (m *Mutex) revoke(mode LockMode) {
+	m.mtx.Lock()
+	m.unregister(mode)
+	m.broadcast()
+	m.mtx.Unlock()
+}
+
+// validate is called after a lock-free fast path has taken the Mutex in the
+// given mode, and reports whether the acquisition stands.  The fast paths
+// don't check whether the Mutex has been shut down, so one that raced with
+// GracefulShutdown has to back out again.  Checking after the acquisition
+// rather than before closes the race: GracefulShutdown sets its flag and
+// then waits for the lock state to drain, so either we see the flag here,
+// or it sees our hold and waits for it.
+func (m *Mutex) validate(mode LockMode) bool {
+	if !m.isShutdown() {
+		return true
+	}
+	m.revoke(mode)
+	return false
+}
@@ -0,0 +1,164 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracefulShutdownIdle(t *testing.T) {
+	m := New()
+	assert.False(t, m.Inspect().Shutdown)
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+	assert.True(t, m.Inspect().Shutdown)
+
+	for _, mode := range modes {
+		assert.Equal(t, ErrShutdown, m.LockCtx(context.Background(), mode), "%v", mode)
+		assert.False(t, m.TryLock(mode), "%v", mode)
+		assert.Equal(t, ErrShutdown, m.LockRetry(mode), "%v", mode)
+		assert.PanicsWithValue(t, ErrShutdown, func() { m.Lock(mode) }, "%v", mode)
+	}
+	assert.Equal(t, uint64(0), m.load())
+
+	// Shutting down again is harmless.
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+}
+
+func TestGracefulShutdownDrains(t *testing.T) {
+	m := New()
+	m.SLock()
+	m.ISLock()
+
+	blocked := make(chan error)
+	go func() {
+		blocked <- m.XLockCtx(context.Background())
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- m.GracefulShutdown(context.Background())
+	}()
+	select {
+	case err := <-blocked:
+		assert.Equal(t, ErrShutdown, err, "Blocked acquisition wasn't refused")
+	case <-time.After(time.Second):
+		t.Fatal("Blocked acquisition not woken by the shutdown")
+	}
+
+	assert.NoError(t, m.SUnlock())
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown finished with IS still held: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.NoError(t, m.ISUnlock())
+	select {
+	case err := <-shutdown:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown didn't finish once the last holder left")
+	}
+}
+
+func TestGracefulShutdownTimeout(t *testing.T) {
+	m := New()
+	m.IXLock()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.GracefulShutdown(ctx))
+
+	// The Mutex stays shut down, but its holders can still release it.
+	assert.Equal(t, ErrShutdown, m.LockCtx(context.Background(), ModeIX))
+	assert.NoError(t, m.IXUnlock())
+}
+
+func TestGracefulShutdownPendingUpgrade(t *testing.T) {
+	m := New()
+	m.SLock()
+	m.SLock()
+	upgraded := m.RequestUpgrade(ModeS, ModeX)
+
+	go m.GracefulShutdown(context.Background())
+	select {
+	case err := <-upgraded:
+		assert.Equal(t, ErrShutdown, err)
+	case <-time.After(time.Second):
+		t.Fatal("Pending upgrade not refused by the shutdown")
+	}
+	assert.Equal(t, setS(0, 2), m.load())
+}
+
+func TestShutdownRevokesFastPath(t *testing.T) {
+	m := New()
+	assert.True(t, m.fastPathISLock())
+	assert.True(t, m.validate(ModeIS))
+
+	// As if GracefulShutdown had come in between the fast path and the
+	// check.
+	m.shutdown = 1
+	assert.True(t, m.fastPathISLock())
+	assert.False(t, m.validate(ModeIS))
+	assert.Equal(t, setIS(0, 1), m.load(), "Revoked acquisition wasn't backed out")
+}
+
+func TestQuiesceChan(t *testing.T) {
+	m := New()
+	ch := m.QuiesceChan()
+	select {
+	case <-ch:
+		t.Fatal("QuiesceChan closed for a Mutex that hasn't been shut down")
+	default:
+	}
+
+	// Draining a live Mutex doesn't quiesce it: new holders may yet
+	// arrive.
+	m.ISLock()
+	m.IXLock()
+	assert.Equal(t, ch, m.QuiesceChan(), "Every call should return the same channel")
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.IXUnlock())
+	select {
+	case <-ch:
+		t.Fatal("QuiesceChan closed by a plain unlock, without a shutdown")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	// Shutting down an unheld Mutex quiesces it straight away.
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("QuiesceChan not closed once the Mutex was shut down")
+	}
+	assert.Equal(t, ch, m.QuiesceChan())
+}
+
+func TestQuiesceChanShutdown(t *testing.T) {
+	m := New()
+	m.XLock()
+	ch := m.QuiesceChan()
+	shutdown := make(chan error)
+	go func() {
+		shutdown <- m.GracefulShutdown(context.Background())
+	}()
+	for !m.isShutdown() {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-ch:
+		t.Fatal("QuiesceChan closed while the Mutex was still held")
+	default:
+	}
+
+	assert.NoError(t, m.XUnlock())
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("QuiesceChan not closed once the Mutex drained")
+	}
+	assert.NoError(t, <-shutdown)
+	assert.Equal(t, ch, m.QuiesceChan(), "Channel replaced after the Mutex quiesced")
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// MutexSnapshot is the state of a Mutex at some moment, e.g. for recording
+// in an error report what a lock looked like when an operation started.
+type MutexSnapshot struct {
+	State LockState
+
+	// Version counts the changes made to the Mutex's state before the
+	// snapshot was taken, and so orders snapshots of the same Mutex: two
+	// snapshots with the same Version have the same State.
+	Version uint64
+
+	Time time.Time
+}
+
+// Snapshot captures the current state of the Mutex.
+//
+// The state is read as with a seqlock: the read only counts if no change
+// to the state was in flight either side of it, and none completed in the
+// meantime, so that the version matches the state exactly.
+func (m *Mutex) Snapshot() MutexSnapshot {
+	for {
+		version := atomic.LoadUint64(&m.version)
+		if atomic.LoadInt32(&m.changing) != 0 {
+			runtime.Gosched()
+			continue
+		}
+		state := m.load()
+		if atomic.LoadInt32(&m.changing) == 0 && atomic.LoadUint64(&m.version) == version {
+			return MutexSnapshot{
+				State:   lockState(state),
+				Version: version,
+				Time:    time.Now(),
+			}
+		}
+	}
+}
+
+// IsCompatibleWith reports whether the Mutex, as it was when the snapshot was
+// taken, could have been taken in the given mode without blocking.
+func (s MutexSnapshot) IsCompatibleWith(mode LockMode) bool {
+	return compatableWithMode(mode, s.State.packed())
+}
@@ -0,0 +1,95 @@
+package ilock
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	m := New()
+	m.IXLock()
+	m.ISLock()
+	before := m.Snapshot()
+	assert.Equal(t, LockState{IX: 1, IS: 1}, before.State)
+	assert.True(t, before.IsCompatibleWith(ModeIS))
+	assert.False(t, before.IsCompatibleWith(ModeS))
+
+	assert.NoError(t, m.IXUnlock())
+	after := m.Snapshot()
+	assert.True(t, after.Version > before.Version)
+	assert.True(t, after.IsCompatibleWith(ModeS))
+
+	// The earlier snapshot is unaffected.
+	assert.False(t, before.IsCompatibleWith(ModeS))
+
+	b, err := json.Marshal(after)
+	assert.NoError(t, err)
+	var decoded MutexSnapshot
+	assert.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, after.State, decoded.State)
+	assert.Equal(t, after.Version, decoded.Version)
+	assert.True(t, after.Time.Equal(decoded.Time))
+}
+
+func TestSnapshotChangeInFlight(t *testing.T) {
+	m := New()
+	before := m.Snapshot()
+
+	// A change that has been made, but whose version hasn't been bumped
+	// yet, mustn't be seen under the old version.
+	m.beginChange()
+	m.state = setIS(0, 1)
+	taken := make(chan MutexSnapshot)
+	go func() {
+		taken <- m.Snapshot()
+	}()
+	select {
+	case s := <-taken:
+		t.Fatalf("Snapshot taken mid-change: %+v", s)
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	m.endChange(true)
+	after := <-taken
+	assert.Equal(t, before.Version+1, after.Version)
+	assert.Equal(t, LockState{IS: 1}, after.State)
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+	m := New()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, mode := range []LockMode{ModeIS, ModeIS, ModeS, ModeIX, ModeX} {
+		mode := mode
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m.Lock(mode)
+				m.Unlock(mode)
+			}
+		}()
+	}
+
+	// However the snapshots interleave with the changes, a version always
+	// goes with the same state.
+	seen := make(map[uint64]LockState)
+	for i := 0; i < 20000; i++ {
+		s := m.Snapshot()
+		if state, ok := seen[s.Version]; ok {
+			assert.Equal(t, state, s.State, "Version %d seen with different states", s.Version)
+		}
+		seen[s.Version] = s.State
+	}
+	close(stop)
+	wg.Wait()
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "time"
+
+// WithStarvationThreshold arranges for handler to be called whenever a
+// goroutine has had to wait longer than d to take the Mutex, in any mode.
+// The handler is passed the mode that was requested and how long the
+// goroutine actually waited, and runs in its own goroutine so as not to
+// delay the caller any further.
+//
+// This is intended for emitting alerts or metrics.  The handler must not
+// call any methods on an ilock.Mutex that it could block on: it may run
+// concurrently with arbitrary lock operations and re-entering the lock from
+// it invites deadlock.
+func WithStarvationThreshold(d time.Duration, handler func(mode LockMode, waitDuration time.Duration)) Option {
+	return func(m *Mutex) {
+		m.starvationThreshold = d
+		m.starvationHandler = handler
+	}
+}
+
+// WithAntiStarvationThreshold stops a steady stream of readers from starving
+// writers.  Once n S acquisitions have been granted since some goroutine
+// started waiting for X, new S acquisitions block until that goroutine has
+// been granted X (goroutines already holding S carry on as normal).  Each X
+// waiter is counted separately, so an X acquisition proceeds within roughly
+// n times the longest S hold time of its arrival.
+//
+// S acquisitions on such a Mutex can't use the lock-free fast path.
+func WithAntiStarvationThreshold(n int) Option {
+	return func(m *Mutex) {
+		m.antiStarvation = n
+	}
+}
+
+// starving reports, with m.mtx held, whether a new acquisition in the given
+// mode has to be held back so as not to starve a waiting writer.
+func (m *Mutex) starving(mode LockMode) bool {
+	if mode != ModeS || m.antiStarvation == 0 || len(m.xWaiters) == 0 {
+		return false
+	}
+	// xWaiters is in order of arrival, so the first waiter has been
+	// skipped the most.
+	return m.sGrants-m.xWaiters[0] >= uint64(m.antiStarvation)
+}
@@ -0,0 +1,104 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type starvation struct {
+	mode LockMode
+	d    time.Duration
+}
+
+func TestStarvationThreshold(t *testing.T) {
+	ch := make(chan starvation, 1)
+	m := New(WithStarvationThreshold(10*time.Millisecond, func(mode LockMode, d time.Duration) {
+		ch <- starvation{mode, d}
+	}))
+
+	// An uncontended acquisition never waits, so can't starve.
+	m.XLock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.XUnlock()
+	}()
+
+	m.SLock()
+	m.SUnlock()
+
+	select {
+	case s := <-ch:
+		assert.Equal(t, ModeS, s.mode)
+		assert.True(t, s.d > 10*time.Millisecond, "waited only %v", s.d)
+	case <-time.After(time.Second):
+		t.Fatal("Starvation handler was never called")
+	}
+}
+
+func TestNoStarvationUnderThreshold(t *testing.T) {
+	ch := make(chan starvation, 1)
+	m := New(WithStarvationThreshold(time.Hour, func(mode LockMode, d time.Duration) {
+		ch <- starvation{mode, d}
+	}))
+
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlock()
+	}()
+	m.XLock()
+	m.XUnlock()
+
+	select {
+	case s := <-ch:
+		t.Fatalf("Starvation handler called after waiting %v", s.d)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestAntiStarvation(t *testing.T) {
+	m := New(WithAntiStarvationThreshold(2), WithRetryPolicy(NoRetryPolicy{}))
+	m.SLock()
+
+	acquired := make(chan bool)
+	go func() {
+		m.XLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// The writer lets two more readers skip ahead of it...
+	assert.NoError(t, m.LockRetry(ModeS))
+	assert.NoError(t, m.LockRetry(ModeS))
+	// ...but no more.
+	assert.Equal(t, ErrRetryAborted, m.LockRetry(ModeS))
+	assert.Equal(t, setS(0, 3), m.load())
+
+	blocked := make(chan bool)
+	go func() {
+		m.SLock()
+		blocked <- true
+	}()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, m.SUnlock())
+	}
+	select {
+	case <-acquired:
+	case <-blocked:
+		t.Fatal("Reader overtook a starving writer")
+	case <-time.After(time.Second):
+		t.Fatal("Writer never got the lock")
+	}
+
+	// Once the writer's done, readers are let back in.
+	assert.NoError(t, m.XUnlock())
+	select {
+	case <-blocked:
+	case <-time.After(time.Second):
+		t.Fatal("Reader never got the lock")
+	}
+	assert.NoError(t, m.LockRetry(ModeS))
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "sync/atomic"
+
+// StateStore holds a Mutex's packed state word (see the Mutex documentation
+// for its layout) in place of the Mutex itself, e.g. so that a test can
+// watch or interfere with every access to it.  All three methods must be
+// atomic with respect to each other.  The Mutex only ever uses Load and
+// CAS, the latter for every change to the state, including on the
+// lock-free fast paths; Store is for setting up and resetting the state
+// from outside.
+//
+// The state may live outside the process, say in a distributed key-value
+// store with a compare-and-swap operation, to have several processes share
+// the same intention lock.  Each Mutex can only wake up its own waiters,
+// though, so processes waiting on a change made by another one have to poll
+// for it, with LockRetry or the Try methods.
+type StateStore interface {
+	Load() uint64
+	Store(state uint64)
+	CAS(old, new uint64) bool
+}
+
+// WithStateStore has the Mutex keep its state in ss rather than in a field
+// of its own.  The state is used as it stands, so ss should normally start
+// out at zero, i.e. unlocked.  Every access to the state goes through an
+// interface call, which makes the Mutex slower; the IS fast path in
+// particular loses its atomic add, and falls back to a CAS loop.
+func WithStateStore(ss StateStore) Option {
+	return func(m *Mutex) {
+		m.store = ss
+	}
+}
+
+// Uint64StateStore is a StateStore kept in memory, and behaves just as a
+// Mutex without a StateStore does.  It's a starting point for StateStores
+// that wrap it, e.g. to count or delay accesses.
+type Uint64StateStore struct {
+	state uint64
+}
+
+// Load implements StateStore.
+func (s *Uint64StateStore) Load() uint64 {
+	return atomic.LoadUint64(&s.state)
+}
+
+// Store implements StateStore.
+func (s *Uint64StateStore) Store(state uint64) {
+	atomic.StoreUint64(&s.state, state)
+}
+
+// CAS implements StateStore.
+func (s *Uint64StateStore) CAS(old, new uint64) bool {
+	return atomic.CompareAndSwapUint64(&s.state, old, new)
+}
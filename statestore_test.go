@@ -0,0 +1,73 @@
+package ilock
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore is a StateStore that counts the CASes made on it.
+type countingStore struct {
+	Uint64StateStore
+	cases int32
+}
+
+func (s *countingStore) CAS(old, new uint64) bool {
+	atomic.AddInt32(&s.cases, 1)
+	return s.Uint64StateStore.CAS(old, new)
+}
+
+func TestStateStore(t *testing.T) {
+	ss := &countingStore{}
+	m := New(WithStateStore(ss))
+
+	m.ISLock()
+	m.IXLock()
+	assert.Equal(t, setIX(setIS(0, 1), 1), ss.Load(), "State not kept in the store")
+	assert.Equal(t, uint64(0), m.state, "State kept in the Mutex as well as the store")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&ss.cases), "IS fast path didn't go through CAS")
+
+	assert.False(t, m.TryXLock())
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.IXUnlock())
+	assert.True(t, m.TryXLock())
+	assert.NoError(t, m.XUnlock())
+
+	// Someone else changes the state behind the Mutex's back.
+	ss.Store(setS(0, 1))
+	assert.True(t, m.IsShared())
+	assert.False(t, m.TryIXLock())
+	ss.Store(0)
+
+	c := m.Clone()
+	c.XLock()
+	assert.Equal(t, uint64(0), ss.Load(), "Clone shares the StateStore")
+}
+
+func TestStateStoreConcurrent(t *testing.T) {
+	m := New(WithStateStore(&Uint64StateStore{}))
+	var wg sync.WaitGroup
+	var writing int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%4 == 0 {
+					m.XLock()
+					assert.True(t, atomic.CompareAndSwapInt32(&writing, 0, 1), "Concurrent writers")
+					atomic.StoreInt32(&writing, 0)
+					m.XUnlock()
+				} else {
+					m.ISLock()
+					assert.Equal(t, int32(0), atomic.LoadInt32(&writing), "IS held alongside X")
+					m.ISUnlock()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(0), m.RawState())
+}
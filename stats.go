@@ -0,0 +1,221 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// LockStats is a snapshot of the statistics kept by a Mutex created with
+// WithStats.  Arrays are indexed by LockMode.
+type LockStats struct {
+	Since time.Time // When the statistics were last reset
+
+	Acquisitions [4]uint64
+
+	// WaitTimeHistogram records how long acquisitions that had to wait for
+	// the Mutex waited; its Count is the number of contended acquisitions.
+	WaitTimeHistogram [4]Histogram
+
+	// HoldTimeHistogram records how long the Mutex was held, from each
+	// acquisition to the matching release.
+	HoldTimeHistogram [4]Histogram
+}
+
+// lockStats accumulates statistics about how the Mutex is used.
+type lockStats struct {
+	mtx sync.Mutex
+	LockStats
+
+	// When each of the current holds in a given mode was taken, oldest
+	// first.  Releases don't say which hold they end, so in the shared modes
+	// they're matched with the oldest outstanding one: the total time held
+	// comes out right, but individual hold times are only approximations.
+	// Holds in X, which has a single holder, are measured exactly.
+	holds [4]holdQueue
+}
+
+// holdQueue is a FIFO of acquisition times.
+type holdQueue struct {
+	times []time.Time
+	head  int // The index of the oldest time in times
+}
+
+func (q *holdQueue) push(t time.Time) {
+	q.times = append(q.times, t)
+}
+
+// pop removes and returns the oldest time, if there is one.
+func (q *holdQueue) pop() (time.Time, bool) {
+	if q.head == len(q.times) {
+		return time.Time{}, false
+	}
+	t := q.times[q.head]
+	q.head++
+
+	// Reclaim the popped prefix once it makes up half of the slice, so that
+	// pops stay amortized O(1) without the slice growing forever.
+	switch {
+	case q.head == len(q.times):
+		q.times, q.head = q.times[:0], 0
+	case q.head >= 32 && 2*q.head >= len(q.times):
+		n := copy(q.times, q.times[q.head:])
+		q.times, q.head = q.times[:n], 0
+	}
+	return t, true
+}
+
+// WithStats has the Mutex keep statistics on how it is used, at the cost of
+// some bookkeeping on every acquisition.
+func WithStats() Option {
+	return func(m *Mutex) {
+		m.stats = &lockStats{LockStats: LockStats{Since: time.Now()}}
+	}
+}
+
+// Stats returns a snapshot of the Mutex's statistics, or the zero LockStats
+// if it wasn't created with WithStats.
+func (m *Mutex) Stats() LockStats {
+	if m.stats == nil {
+		return LockStats{}
+	}
+	m.stats.mtx.Lock()
+	defer m.stats.mtx.Unlock()
+	return m.stats.LockStats
+}
+
+// ResetStats clears the Mutex's statistics.
+func (m *Mutex) ResetStats() {
+	if m.stats == nil {
+		return
+	}
+	m.stats.mtx.Lock()
+	m.stats.LockStats = LockStats{Since: time.Now()}
+	m.stats.mtx.Unlock()
+}
+
+// HoldTime returns a copy of the distribution of how long goroutines held
+// the Mutex in the given mode, from acquisition to release; holds that are
+// still ongoing aren't counted.  In the shared modes, releases are matched
+// with acquisitions in order, so only the total time held is exact.  Returns
+// an empty Histogram if the Mutex wasn't created with WithStats.
+func (m *Mutex) HoldTime(mode LockMode) Histogram {
+	return m.Stats().HoldTimeHistogram[mode]
+}
+
+// WaitHistogram returns a copy of the distribution of how long goroutines
+// that had to wait for the Mutex in the given mode waited.  Uncontended
+// acquisitions aren't counted.  Returns an empty Histogram if the Mutex
+// wasn't created with WithStats.
+func (m *Mutex) WaitHistogram(mode LockMode) Histogram {
+	return m.Stats().WaitTimeHistogram[mode]
+}
+
+// Report returns a summary of the Mutex's statistics; see WriteReport.
+func (m *Mutex) Report() string {
+	var sb strings.Builder
+	m.WriteReport(&sb)
+	return sb.String()
+}
+
+// WriteReport writes a summary of the Mutex's statistics since they were
+// last reset, along with its current state, to w.  The report is a table of
+// variable names and values, in the style of a database's SHOW STATUS:
+//
+//	Variable_name        Value
+//	Timestamp            2020-06-01T12:00:00Z
+//	Uptime               1m30s
+//	State                X=0 S=2 IX=0 IS=1
+//	X_acquisitions       12
+//	X_contention_ratio   0.250
+//	X_avg_wait           1.2ms
+//	X_max_wait           5ms
+//	...
+func (m *Mutex) WriteReport(w io.Writer) error {
+	now := time.Now()
+	stats := m.Stats()
+	state := m.extractState()
+
+	tw := tabwriter.NewWriter(w, 0, 8, 3, ' ', 0)
+	fmt.Fprintf(tw, "Variable_name\tValue\n")
+	if name := m.Name(); name != "" {
+		fmt.Fprintf(tw, "Name\t%s\n", name)
+	}
+	fmt.Fprintf(tw, "Timestamp\t%s\n", now.Format(time.RFC3339))
+	if !stats.Since.IsZero() {
+		fmt.Fprintf(tw, "Uptime\t%v\n", now.Sub(stats.Since).Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "State\t%v\n", state)
+	for _, mode := range modes {
+		acquisitions := stats.Acquisitions[mode]
+		waits := stats.WaitTimeHistogram[mode]
+
+		var ratio float64
+		var avg time.Duration
+		if acquisitions > 0 {
+			ratio = float64(waits.Count()) / float64(acquisitions)
+		}
+		if n := waits.Count(); n > 0 {
+			avg = waits.Sum / time.Duration(n)
+		}
+		fmt.Fprintf(tw, "%v_acquisitions\t%d\n", mode, acquisitions)
+		fmt.Fprintf(tw, "%v_contention_ratio\t%.3f\n", mode, ratio)
+		fmt.Fprintf(tw, "%v_avg_wait\t%v\n", mode, avg)
+		fmt.Fprintf(tw, "%v_max_wait\t%v\n", mode, waits.Max)
+	}
+	return tw.Flush()
+}
+
+func (s *lockStats) acquired(mode LockMode) {
+	now := time.Now()
+	s.mtx.Lock()
+	s.Acquisitions[mode]++
+	s.holds[mode].push(now)
+	s.mtx.Unlock()
+}
+
+func (s *lockStats) released(mode LockMode) {
+	now := time.Now()
+	s.mtx.Lock()
+	if start, ok := s.holds[mode].pop(); ok {
+		s.HoldTimeHistogram[mode].observe(now.Sub(start))
+	}
+	s.mtx.Unlock()
+}
+
+// forgetHolds drops the acquisition times of the current holds in the given
+// mode, which have been ended without being released.
+func (s *lockStats) forgetHolds(mode LockMode) {
+	s.mtx.Lock()
+	s.holds[mode] = holdQueue{}
+	s.mtx.Unlock()
+}
+
+func (s *lockStats) waited(mode LockMode, d time.Duration) {
+	s.mtx.Lock()
+	s.WaitTimeHistogram[mode].observe(d)
+	s.mtx.Unlock()
+}
@@ -0,0 +1,159 @@
+package ilock
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitHistogram(t *testing.T) {
+	m := New(WithStats())
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, uint64(0), m.WaitHistogram(ModeS).Count(), "Uncontended acquisition counted")
+
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlockMust()
+	}()
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+
+	h := m.WaitHistogram(ModeS)
+	assert.Equal(t, uint64(1), h.Count())
+	assert.True(t, h.Percentile(50) >= 5*time.Millisecond)
+	assert.Equal(t, uint64(0), m.WaitHistogram(ModeX).Count())
+
+	assert.Equal(t, Histogram{}, New().WaitHistogram(ModeS), "Stats kept without WithStats")
+}
+
+func TestReport(t *testing.T) {
+	m := New(WithStats(), WithName("reported"))
+	defer DefaultRegistry().Unregister(m)
+
+	m.XLock()
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlockMust()
+	}()
+	m.SLock()
+	m.SLock()
+
+	stats := m.Stats()
+	assert.Equal(t, [4]uint64{ModeX: 1, ModeS: 2}, stats.Acquisitions)
+	assert.Equal(t, uint64(1), stats.WaitTimeHistogram[ModeS].Count())
+
+	report := m.Report()
+	lines := strings.Split(strings.TrimSpace(report), "\n")
+	assert.Equal(t, 5+4*4, len(lines))
+	assert.Regexp(t, `^Variable_name\s+Value$`, lines[0])
+	assert.Regexp(t, `^Name\s+reported$`, lines[1])
+	assert.Regexp(t, `^Timestamp\s+\d{4}-`, lines[2])
+	assert.Regexp(t, `^Uptime\s+\d`, lines[3])
+	assert.Regexp(t, `^State\s+X=0 S=2 IX=0 IS=0$`, lines[4])
+	assert.Contains(t, report, "S_acquisitions ")
+	assert.Regexp(t, `S_contention_ratio\s+0\.500\n`, report)
+	assert.Regexp(t, `X_max_wait\s+0s\n`, report)
+
+	m.ResetStats()
+	assert.Equal(t, [4]uint64{}, m.Stats().Acquisitions)
+	assert.True(t, m.Stats().Since.After(stats.Since))
+}
+
+func TestHoldTime(t *testing.T) {
+	m := New(WithStats())
+	m.XLock()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, uint64(0), m.HoldTime(ModeX).Count(), "Ongoing hold counted")
+	assert.NoError(t, m.XUnlock())
+
+	h := m.HoldTime(ModeX)
+	assert.Equal(t, uint64(1), h.Count())
+	assert.True(t, h.Sum >= 5*time.Millisecond)
+	assert.Equal(t, h.Sum, h.Max)
+
+	// Shared holds are matched with releases oldest first.
+	m.SLock()
+	time.Sleep(5 * time.Millisecond)
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+	assert.True(t, m.HoldTime(ModeS).Max >= 5*time.Millisecond)
+	assert.NoError(t, m.SUnlock())
+	assert.Equal(t, uint64(2), m.HoldTime(ModeS).Count())
+
+	// Resetting the statistics doesn't forget about ongoing holds.
+	m.IXLock()
+	m.ResetStats()
+	assert.NoError(t, m.IXUnlock())
+	assert.Equal(t, uint64(1), m.HoldTime(ModeIX).Count())
+	assert.Equal(t, uint64(0), m.HoldTime(ModeX).Count())
+
+	assert.Equal(t, Histogram{}, New().HoldTime(ModeX), "Stats kept without WithStats")
+}
+
+func TestHoldTimeForceUnlock(t *testing.T) {
+	m := New(WithStats())
+	m.SLock()
+	m.SLock()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, 2, m.ForceUnlock(ModeS))
+
+	// The forcibly released holds mustn't be matched with later releases.
+	m.SLock()
+	assert.NoError(t, m.SUnlock())
+	h := m.HoldTime(ModeS)
+	assert.Equal(t, uint64(1), h.Count())
+	assert.True(t, h.Max < 5*time.Millisecond, "Release matched with a forcibly released hold")
+}
+
+func TestHoldQueue(t *testing.T) {
+	var q holdQueue
+	_, ok := q.pop()
+	assert.False(t, ok)
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		q.push(start.Add(time.Duration(i)))
+	}
+	for i := 0; i < 100; i++ {
+		got, ok := q.pop()
+		assert.True(t, ok)
+		assert.Equal(t, start.Add(time.Duration(i)), got)
+		q.push(start.Add(time.Duration(100 + i)))
+	}
+	assert.True(t, len(q.times) <= 200, "Popped times weren't reclaimed")
+	for i := 100; i < 200; i++ {
+		got, _ := q.pop()
+		assert.Equal(t, start.Add(time.Duration(i)), got)
+	}
+	_, ok = q.pop()
+	assert.False(t, ok)
+	assert.Equal(t, 0, len(q.times))
+}
+
+// BenchmarkHoldTimeAccuracy holds the Mutex in X for a known time on every
+// iteration, and checks that the recorded hold times agree with it.
+func BenchmarkHoldTimeAccuracy(b *testing.B) {
+	const hold = 100 * time.Microsecond
+	m := New(WithStats())
+
+	var want time.Duration
+	for i := 0; i < b.N; i++ {
+		m.XLock()
+		start := time.Now()
+		for time.Since(start) < hold {
+		}
+		want += time.Since(start)
+		m.XUnlockMust()
+	}
+
+	got := m.HoldTime(ModeX).Sum
+	errPct := 100 * float64(got-want) / float64(want)
+	b.ReportMetric(errPct, "%err")
+	if errPct < -10 || errPct > 10 {
+		b.Fatalf("Recorded %v of hold time, want %v to within 10%%", got, want)
+	}
+}
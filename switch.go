@@ -0,0 +1,91 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "errors"
+
+// ErrIncompatibleUpgrade is returned by SwitchMode when the requested mode
+// isn't compatible with the rest of the lock state.
+var ErrIncompatibleUpgrade = errors.New("ilock: mode switch incompatible with current lock state")
+
+// SwitchMode atomically trades one of the caller's holds on the Mutex in
+// mode from for a hold in mode to, covering every upgrade (e.g. IS to S, IX
+// to X) and downgrade (e.g. X to S) in one place.  It does not block: if to
+// isn't compatible with the lock state it returns ErrIncompatibleUpgrade and
+// the caller keeps holding from.  Returns a *LockUnderflowError if the Mutex
+// isn't held in from at all.
+func (m *Mutex) SwitchMode(from, to LockMode) error {
+	if err := m.beforeAcquire(to); err != nil {
+		return err
+	}
+	m.mtx.Lock()
+	err := m.trySwitch(from, to)
+	m.mtx.Unlock()
+	if err != nil {
+		return err
+	}
+
+	m.released(from)
+	m.acquired(to, 0)
+	return nil
+}
+
+// trySwitch is the body of SwitchMode, and must be called with m.mtx held.
+// On success, the caller has to follow up with released and acquired once
+// it has unlocked m.mtx.
+func (m *Mutex) trySwitch(from, to LockMode) error {
+	for {
+		state := m.load()
+		curr := extractMode(from, state)
+		if curr == 0 {
+			return &LockUnderflowError{Mode: from}
+		}
+
+		// Take ourselves out of from before checking to, as our own hold
+		// mustn't count against us: a sole S holder can upgrade to X, say,
+		// even though X is incompatible with S.
+		without := setMode(from, state, curr-1)
+		if !m.compatible(to, without) || !m.underLimit(to, without) {
+			return ErrIncompatibleUpgrade
+		}
+		prev := extractMode(to, without)
+		if next := setMode(to, without, prev+1); m.cas(state, next) {
+			if curr == 1 && from != to {
+				m.zeroed(from)
+			}
+			if prev == 0 && from != to {
+				m.activated(to, next)
+			}
+			m.observe(from, false, state, without)
+			m.observe(to, true, without, next)
+			break
+		}
+	}
+	if from == ModeX {
+		m.xTrace.clear()
+		m.xBudget.stop()
+		m.endWrite()
+	}
+
+	// Giving up from may well have made someone else's mode compatible.
+	m.broadcast()
+	return nil
+}
@@ -0,0 +1,55 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwitchModeUpgrade(t *testing.T) {
+	m := New()
+	m.SLock()
+	assert.NoError(t, m.SwitchMode(ModeS, ModeX), "Sole S holder should be able to upgrade to X")
+	assert.Equal(t, setX(0, 1), m.load())
+	assert.NoError(t, m.XUnlock())
+
+	m.SLock()
+	m.SLock()
+	assert.Equal(t, ErrIncompatibleUpgrade, m.SwitchMode(ModeS, ModeX))
+	assert.Equal(t, setS(0, 2), m.load(), "Failed switch modified the lock state")
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.SUnlock())
+
+	m.IXLock()
+	m.ISLock()
+	assert.Equal(t, ErrIncompatibleUpgrade, m.SwitchMode(ModeIS, ModeS))
+	assert.NoError(t, m.SwitchMode(ModeIS, ModeIX))
+	assert.Equal(t, setIX(0, 2), m.load())
+}
+
+func TestSwitchModeDowngrade(t *testing.T) {
+	m := New()
+	m.XLock()
+
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.NoError(t, m.SwitchMode(ModeX, ModeS))
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("Downgrade from X didn't wake up the S waiter")
+	}
+	assert.Equal(t, setS(0, 2), m.load())
+}
+
+func TestSwitchModeUnderflow(t *testing.T) {
+	m := New()
+	assert.Equal(t, &LockUnderflowError{Mode: ModeIS}, m.SwitchMode(ModeIS, ModeIX))
+	assert.Equal(t, uint64(0), m.load())
+}
@@ -0,0 +1,47 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// TransferX hands the caller's X hold over to another goroutine, e.g. from a
+// producer that set up some work under the lock to the worker that finishes
+// it, without letting anyone else in between.  The caller must hold X, and
+// must not unlock it after calling TransferX; instead, whoever receives from
+// the returned channel owns the lock, and is responsible for calling
+// XUnlock.  The channel delivers exactly one value, so exactly one receiver
+// gets the lock.
+//
+// TransferX panics with a *LockUnderflowError if the Mutex isn't held in X.
+func (m *Mutex) TransferX() chan struct{} {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if extractX(m.load()) == 0 {
+		panic(&LockUnderflowError{Mode: ModeX})
+	}
+
+	// The stack we recorded is no longer that of the holder, and nor are
+	// we; the receiver claims the hold when it first releases or asserts it.
+	m.xTrace.clear()
+	m.owners.transfer(ModeX)
+
+	token := make(chan struct{}, 1)
+	token <- struct{}{}
+	return token
+}
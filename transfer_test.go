@@ -0,0 +1,34 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferX(t *testing.T) {
+	m := New()
+	m.XLock()
+	token := m.TransferX()
+
+	done := make(chan bool)
+	for i := 0; i < 2; i++ {
+		go func() {
+			<-token
+			assert.Equal(t, setX(0, 1), m.load())
+			assert.NoError(t, m.XUnlock())
+			done <- true
+		}()
+	}
+
+	<-done
+	select {
+	case <-done:
+		t.Fatal("Two goroutines received the lock")
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.Equal(t, uint64(0), m.load())
+
+	assert.Panics(t, func() { m.TransferX() })
+}
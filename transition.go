@@ -0,0 +1,111 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// transitionCallback is a callback registered by OnTransition.
+type transitionCallback struct {
+	from, to LockMode
+	f        func(*Mutex)
+}
+
+// transitions holds the callbacks registered by OnTransition.  They have
+// their own lock, rather than m.mtx, as the lock-free fast paths have to
+// consult them too.
+type transitions struct {
+	mtx sync.Mutex
+	cbs []*transitionCallback
+	n   int32 // len(cbs), accessed atomically
+
+	// When each mode's holder count last dropped to zero, as a count of
+	// the drains of any mode so far, or zero if it never has; all accessed
+	// atomically.
+	drains    uint64
+	drainedAt [4]uint64
+}
+
+// OnTransition registers cb to be called whenever the Mutex passes from
+// from to to, or vice versa: that is, when the number of holders in one of
+// the two modes goes up from zero, and the other has had its holders drop
+// to zero more recently, and still has none.  For example,
+// OnTransition(ModeX, ModeS, cb) fires when X has been released and S
+// becomes active, whether by SwitchMode or by a fresh acquisition, and
+// when S has been released and X becomes active.  Other modes coming and
+// going in between don't matter.  The returned function deregisters cb.
+//
+// Callbacks are called on a new goroutine, so they may take and release
+// the Mutex, but by the time they run the state may have moved on again.
+func (m *Mutex) OnTransition(from, to LockMode, cb func(*Mutex)) func() {
+	t := &m.transitions
+	c := &transitionCallback{from: from, to: to, f: cb}
+	t.mtx.Lock()
+	t.cbs = append(t.cbs, c)
+	atomic.StoreInt32(&t.n, int32(len(t.cbs)))
+	t.mtx.Unlock()
+
+	return func() {
+		t.mtx.Lock()
+		for i, cb := range t.cbs {
+			if cb == c {
+				t.cbs = append(t.cbs[:i], t.cbs[i+1:]...)
+				break
+			}
+		}
+		atomic.StoreInt32(&t.n, int32(len(t.cbs)))
+		t.mtx.Unlock()
+	}
+}
+
+// drained records that the number of holders in the given mode has dropped
+// to zero.
+func (t *transitions) drained(mode LockMode) {
+	atomic.StoreUint64(&t.drainedAt[mode], atomic.AddUint64(&t.drains, 1))
+}
+
+// passedFrom reports whether, now that the given mode has become active,
+// leaving the lock state as given, the Mutex has passed to it from other.
+func (t *transitions) passedFrom(other, mode LockMode, state uint64) bool {
+	return other != mode && extractMode(other, state) == 0 &&
+		atomic.LoadUint64(&t.drainedAt[other]) > atomic.LoadUint64(&t.drainedAt[mode])
+}
+
+// activated is called whenever the number of holders in the given mode goes
+// up from zero, leaving the lock state as given, and fires the transition
+// callbacks that that matches.  It costs an atomic load if there are none.
+func (m *Mutex) activated(mode LockMode, state uint64) {
+	t := &m.transitions
+	if atomic.LoadInt32(&t.n) == 0 {
+		return
+	}
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, c := range t.cbs {
+		if (c.to == mode && t.passedFrom(c.from, mode, state)) ||
+			(c.from == mode && t.passedFrom(c.to, mode, state)) {
+			go c.f(m)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOnTransition(t *testing.T) {
+	m := New()
+	fired := make(chan *Mutex, 4)
+	deregister := m.OnTransition(ModeX, ModeS, func(m *Mutex) { fired <- m })
+
+	expectFired := func(msg string) {
+		select {
+		case got := <-fired:
+			assert.Equal(t, m, got)
+		case <-time.After(time.Second):
+			t.Fatal(msg)
+		}
+	}
+	expectQuiet := func(msg string) {
+		select {
+		case <-fired:
+			t.Fatal(msg)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	// Nothing has been released yet.
+	m.SLock()
+	expectQuiet("Fired without X having been released")
+	assert.NoError(t, m.SUnlock())
+
+	m.XLock()
+	expectFired("Not fired when X followed S")
+	assert.NoError(t, m.XUnlock())
+	m.SLock()
+	expectFired("Not fired when S followed X")
+	m.SLock()
+	expectQuiet("Fired for a second S holder")
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.SUnlock())
+
+	// S drained more recently than X.
+	m.SLock()
+	expectQuiet("Fired when S followed S")
+	assert.NoError(t, m.SUnlock())
+
+	m.XLock()
+	expectFired("Not fired when X followed S")
+	assert.NoError(t, m.SwitchMode(ModeX, ModeS))
+	expectFired("Not fired when X was switched to S")
+	assert.NoError(t, m.SUnlock())
+
+	deregister()
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+	m.SLock()
+	expectQuiet("Fired after being deregistered")
+	assert.NoError(t, m.SUnlock())
+}
+
+func TestOnTransitionInterleaved(t *testing.T) {
+	m := New()
+	fired := make(chan bool, 4)
+	m.OnTransition(ModeX, ModeS, func(*Mutex) { fired <- true })
+	expect := func(want bool, msg string) {
+		select {
+		case <-fired:
+			assert.True(t, want, msg)
+		case <-time.After(5 * time.Millisecond):
+			assert.False(t, want, msg)
+		}
+	}
+
+	// IS and IX coming and going after X has drained don't stop X passing
+	// to S.
+	m.XLock()
+	assert.NoError(t, m.XUnlock())
+	m.ISLock()
+	assert.NoError(t, m.ISUnlock())
+	m.IXLock()
+	assert.NoError(t, m.IXUnlock())
+	m.SLock()
+	expect(true, "Not fired when S followed X with IS and IX in between")
+
+	// Nor do they stop S passing back to X.
+	m.ISLock()
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.ISUnlock())
+	m.IXLock()
+	assert.NoError(t, m.IXUnlock())
+	m.XLock()
+	expect(true, "Not fired when X followed S with IS and IX in between")
+	assert.NoError(t, m.XUnlock())
+
+	// But if S was active in the meantime, X no longer passes to it.
+	m.IXLock()
+	assert.NoError(t, m.IXUnlock())
+	m.SLock()
+	expect(true, "Not fired when S followed X")
+	assert.NoError(t, m.SUnlock())
+	m.ISLock()
+	assert.NoError(t, m.ISUnlock())
+	m.SLock()
+	expect(false, "Fired when S followed S with IS in between")
+	assert.NoError(t, m.SUnlock())
+}
+
+func TestOnTransitionISFastPath(t *testing.T) {
+	m := New()
+	fired := make(chan bool, 1)
+	m.OnTransition(ModeIX, ModeIS, func(*Mutex) { fired <- true })
+
+	m.IXLock()
+	assert.NoError(t, m.IXUnlock())
+	m.ISLock()
+	select {
+	case <-fired:
+	case <-time.After(time.Second):
+		t.Fatal("Not fired when IS followed IX")
+	}
+}
+
+func TestOnTransitionISFastPathNoTransients(t *testing.T) {
+	m := New()
+	m.OnTransition(ModeIX, ModeIS, func(*Mutex) {})
+
+	// A failed attempt mustn't add itself to the IS count, even briefly,
+	// or a concurrent attempt could mistake it for a holder.
+	m.XLock()
+	before := m.Snapshot()
+	assert.False(t, m.fastPathISLock())
+	assert.Equal(t, before.Version, m.Snapshot().Version, "Failed IS attempt changed the state")
+	assert.NoError(t, m.XUnlock())
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import "time"
+
+// TryISLock takes the Mutex in IS if it can do so without blocking, and
+// reports whether it did.
+func (m *Mutex) TryISLock() bool {
+	return m.tryLockMode(ModeIS)
+}
+
+// TryIXLock takes the Mutex in IX if it can do so without blocking, and
+// reports whether it did.
+func (m *Mutex) TryIXLock() bool {
+	return m.tryLockMode(ModeIX)
+}
+
+// TrySLock takes the Mutex in S if it can do so without blocking, and
+// reports whether it did.
+func (m *Mutex) TrySLock() bool {
+	return m.tryLockMode(ModeS)
+}
+
+// TryXLock takes the Mutex in X if it can do so without blocking, and
+// reports whether it did.
+func (m *Mutex) TryXLock() bool {
+	return m.tryLockMode(ModeX)
+}
+
+// TryISLockErr is like TryISLock, but returns why the Mutex couldn't be
+// taken, usually as a *LockCompatibilityError, rather than false.
+func (m *Mutex) TryISLockErr() error {
+	return m.tryLockModeErr(ModeIS)
+}
+
+// TryIXLockErr is like TryIXLock, but returns why the Mutex couldn't be
+// taken, usually as a *LockCompatibilityError, rather than false.
+func (m *Mutex) TryIXLockErr() error {
+	return m.tryLockModeErr(ModeIX)
+}
+
+// TrySLockErr is like TrySLock, but returns why the Mutex couldn't be
+// taken, usually as a *LockCompatibilityError, rather than false.
+func (m *Mutex) TrySLockErr() error {
+	return m.tryLockModeErr(ModeS)
+}
+
+// TryXLockErr is like TryXLock, but returns why the Mutex couldn't be
+// taken, usually as a *LockCompatibilityError, rather than false.
+func (m *Mutex) TryXLockErr() error {
+	return m.tryLockModeErr(ModeX)
+}
+
+func (m *Mutex) tryLockModeErr(mode LockMode) error {
+	if err := m.beforeAcquire(mode); err != nil {
+		return err
+	}
+	if !m.tryAcquire(mode) {
+		return &LockCompatibilityError{
+			Mode:      mode,
+			BlockedBy: lockState(m.blockers(mode, m.load())),
+		}
+	}
+	m.acquired(mode, 0)
+	return nil
+}
+
+func (m *Mutex) tryLockMode(mode LockMode) bool {
+	if !mode.valid() || m.beforeAcquire(mode) != nil || !m.tryAcquire(mode) {
+		return false
+	}
+	m.acquired(mode, 0)
+	return true
+}
+
+// TryLockN tries up to attempts times to take the Mutex in the given mode
+// without blocking, sleeping for sleep in between, and reports whether it
+// succeeded.  A sleep of 0 spins.  This is a middle ground between the Try
+// methods, which give up straight away, and the blocking lock methods, which
+// never give up.
+func (m *Mutex) TryLockN(mode LockMode, attempts int, sleep time.Duration) bool {
+	for i := 0; i < attempts; i++ {
+		if i > 0 && sleep > 0 {
+			time.Sleep(sleep)
+		}
+		if m.tryLockMode(mode) {
+			return true
+		}
+	}
+	return false
+}
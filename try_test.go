@@ -0,0 +1,97 @@
+package ilock
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryLock(t *testing.T) {
+	m := New()
+	assert.True(t, m.TryIXLock())
+	assert.True(t, m.TryISLock())
+	assert.False(t, m.TrySLock())
+	assert.False(t, m.TryXLock())
+	assert.Equal(t, setIS(setIX(0, 1), 1), m.load(), "Failed attempts modified the lock state")
+
+	assert.NoError(t, m.IXUnlock())
+	assert.True(t, m.TrySLock())
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.ISUnlock())
+	assert.True(t, m.TryXLock())
+	assert.NoError(t, m.XUnlock())
+}
+
+func TestTryLockErr(t *testing.T) {
+	m := New()
+	assert.NoError(t, m.TryISLockErr())
+	assert.NoError(t, m.TryISLockErr())
+	assert.NoError(t, m.TrySLockErr())
+
+	err := m.TryXLockErr()
+	assert.Equal(t, &LockCompatibilityError{Mode: ModeX, BlockedBy: LockState{S: 1, IS: 2}}, err)
+	assert.EqualError(t, err, "ilock: X blocked by S=1 IS=2 holders")
+	assert.Equal(t, &LockCompatibilityError{Mode: ModeIX, BlockedBy: LockState{S: 1}}, m.TryIXLockErr())
+	assert.Equal(t, setIS(setS(0, 1), 2), m.load(), "Failed attempts modified the lock state")
+
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.TryIXLockErr())
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.ISUnlock())
+	assert.NoError(t, m.IXUnlock())
+
+	m = New(WithMaxHolders(0, 1, 0, 0))
+	assert.NoError(t, m.TrySLockErr())
+	err = m.TrySLockErr()
+	assert.Equal(t, &LockCompatibilityError{Mode: ModeS}, err)
+	assert.EqualError(t, err, "ilock: S blocked, but not by any incompatible holders")
+
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.GracefulShutdown(context.Background()))
+	assert.Equal(t, ErrShutdown, m.TryISLockErr())
+}
+
+func TestTryLockN(t *testing.T) {
+	m := New()
+	assert.False(t, m.TryLockN(LockMode(42), 3, 0))
+	assert.False(t, m.TryLockN(ModeX, 0, 0))
+
+	m.XLock()
+	start := time.Now()
+	assert.False(t, m.TryLockN(ModeS, 3, time.Millisecond))
+	assert.True(t, time.Since(start) >= 2*time.Millisecond, "Didn't sleep between attempts")
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		m.XUnlockMust()
+	}()
+	assert.True(t, m.TryLockN(ModeS, 1000, time.Millisecond))
+	assert.NoError(t, m.SUnlock())
+}
+
+func BenchmarkTryLockN(b *testing.B) {
+	for _, attempts := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("attempts=%d", attempts), func(b *testing.B) {
+			m := New()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if m.TryLockN(ModeX, attempts, 0) {
+						m.XUnlock()
+					}
+				}
+			})
+		})
+	}
+	b.Run("blocking", func(b *testing.B) {
+		m := New()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				m.XLock()
+				m.XUnlock()
+			}
+		})
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrTransactionDone is returned when a LockTransaction is used after
+	// it's been committed or aborted, or released before it's committed.
+	ErrTransactionDone = errors.New("ilock: transaction already committed or aborted")
+
+	// ErrTransactionConflict is returned when preparing a path would require
+	// a lock that the transaction already holds in an incompatible mode,
+	// which would otherwise deadlock the transaction against itself.
+	ErrTransactionConflict = errors.New("ilock: transaction conflicts with itself")
+)
+
+type txnState int
+
+const (
+	txnPreparing txnState = iota
+	txnCommitted
+	txnDone
+)
+
+// LockTransaction locks several LockPaths as a unit, in two phases: paths
+// are first prepared one at a time, which takes their locks as usual, and
+// then the transaction is either committed, or aborted, releasing every
+// lock taken so far.  If preparing any path fails, the transaction is
+// aborted.  Once committed, the locks are held until Release.
+//
+// A LockTransaction is not safe for concurrent use, and the zero value is
+// ready to use.
+type LockTransaction struct {
+	state txnState
+	held  []txnLock // In the order they were taken
+}
+
+type txnLock struct {
+	m    *Mutex
+	mode LockMode
+}
+
+// PrepareSLock takes path as LockPath.SLock would.
+func (t *LockTransaction) PrepareSLock(path LockPath) error {
+	return t.prepare(path, ModeIS, ModeS)
+}
+
+// PrepareXLock takes path as LockPath.XLock would.
+func (t *LockTransaction) PrepareXLock(path LockPath) error {
+	return t.prepare(path, ModeIX, ModeX)
+}
+
+func (t *LockTransaction) prepare(path LockPath, intention, leaf LockMode) error {
+	if t.state != txnPreparing {
+		return ErrTransactionDone
+	}
+	for i, m := range path {
+		mode := intention
+		if i == len(path)-1 {
+			mode = leaf
+		}
+		for _, h := range t.held {
+			if h.m == m && !Compatible(mode, h.mode) {
+				t.Abort()
+				return ErrTransactionConflict
+			}
+		}
+		if err := m.acquire(context.Background(), mode); err != nil {
+			t.Abort()
+			return err
+		}
+		t.held = append(t.held, txnLock{m, mode})
+	}
+	return nil
+}
+
+// Commit ends the prepare phase; no more paths may be added, and the locks
+// stay held until Release.
+func (t *LockTransaction) Commit() error {
+	if t.state != txnPreparing {
+		return ErrTransactionDone
+	}
+	t.state = txnCommitted
+	return nil
+}
+
+// Abort releases every lock taken by an uncommitted transaction.  Returns
+// the first error encountered, but carries on releasing the rest.
+func (t *LockTransaction) Abort() error {
+	if t.state != txnPreparing {
+		return ErrTransactionDone
+	}
+	return t.release()
+}
+
+// Release releases every lock held by a committed transaction.  Returns the
+// first error encountered, but carries on releasing the rest.
+func (t *LockTransaction) Release() error {
+	if t.state != txnCommitted {
+		return ErrTransactionDone
+	}
+	return t.release()
+}
+
+// Committed reports whether the transaction has been committed and not yet
+// released.  Until then, its locks are held but only provisionally.
+func (t *LockTransaction) Committed() bool {
+	return t.state == txnCommitted
+}
+
+func (t *LockTransaction) release() error {
+	var err error
+	for i := len(t.held) - 1; i >= 0; i-- {
+		if e := t.held[i].m.unlock(t.held[i].mode); e != nil && err == nil {
+			err = e
+		}
+	}
+	t.held = nil
+	t.state = txnDone
+	return err
+}
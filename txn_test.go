@@ -0,0 +1,60 @@
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockTransactionCommit(t *testing.T) {
+	root := New()
+	a := LockPath{root, New()}
+	b := LockPath{root, New()}
+
+	var txn LockTransaction
+	assert.NoError(t, txn.PrepareSLock(a))
+	assert.NoError(t, txn.PrepareXLock(b))
+	assert.False(t, txn.Committed())
+	assert.Equal(t, ErrTransactionDone, txn.Release(), "Released an uncommitted transaction")
+
+	assert.NoError(t, txn.Commit())
+	assert.True(t, txn.Committed())
+	assert.Equal(t, setIX(setIS(0, 1), 1), root.load())
+	assert.Equal(t, setS(0, 1), a[1].load())
+	assert.Equal(t, setX(0, 1), b[1].load())
+	assert.Equal(t, ErrTransactionDone, txn.PrepareSLock(a))
+	assert.Equal(t, ErrTransactionDone, txn.Abort())
+
+	assert.NoError(t, txn.Release())
+	assert.False(t, txn.Committed())
+	for _, m := range []*Mutex{root, a[1], b[1]} {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Equal(t, ErrTransactionDone, txn.Release())
+}
+
+func TestLockTransactionAbort(t *testing.T) {
+	p := newPath(2)
+
+	var txn LockTransaction
+	assert.NoError(t, txn.PrepareXLock(p))
+	assert.NoError(t, txn.Abort())
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Equal(t, ErrTransactionDone, txn.Commit())
+}
+
+func TestLockTransactionConflict(t *testing.T) {
+	p := newPath(2)
+
+	// Taking the same leaf in X twice would deadlock, so the whole
+	// transaction is rolled back instead.
+	var txn LockTransaction
+	assert.NoError(t, txn.PrepareXLock(p))
+	assert.Equal(t, ErrTransactionConflict, txn.PrepareSLock(p))
+	for _, m := range p {
+		assert.Equal(t, uint64(0), m.load(), "Lock state not restored")
+	}
+	assert.Equal(t, ErrTransactionDone, txn.Commit())
+}
@@ -0,0 +1,254 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrUpgradeConflict is returned when an upgrade would have to wait behind
+// another goroutine's pending upgrade to an incompatible mode.  As each of
+// them keeps its current hold while it waits, and that hold may be what's
+// blocking the other, waiting could deadlock.
+var ErrUpgradeConflict = errors.New("ilock: conflicting upgrade already pending")
+
+// ErrPromotionTimeout is sent by SchedulePromotion when the promotion still
+// hasn't become possible by the Mutex's promotion timeout.
+var ErrPromotionTimeout = errors.New("ilock: scheduled promotion timed out")
+
+// defaultPromotionTimeout is used by Mutexes that weren't given one with
+// WithPromotionTimeout.
+const defaultPromotionTimeout = 30 * time.Second
+
+// WithPromotionTimeout sets how long SchedulePromotion waits for a promotion
+// to become possible before giving up with ErrPromotionTimeout.
+func WithPromotionTimeout(d time.Duration) Option {
+	return func(m *Mutex) {
+		m.promotionTimeout = d
+	}
+}
+
+// RequestUpgrade asks for one of the caller's holds on the Mutex in mode from
+// to be traded for a hold in mode to, as SwitchMode does, but rather than
+// failing if to isn't compatible with the lock state, it waits until it is.
+// The caller keeps holding from in the meantime.
+//
+// The request is next in line: from the moment RequestUpgrade returns until
+// the upgrade is made, new acquisitions in modes incompatible with to block,
+// so that e.g. an IX holder upgrading to X can't be starved by a stream of
+// new S holders.  Once the upgrade has been made, nil is sent on the
+// returned channel.  Otherwise, it receives the error that prevented it,
+// e.g. ErrUpgradeConflict, ErrShutdown if the Mutex is shut down first, or a
+// *LockUnderflowError if the caller doesn't hold the Mutex in from.
+func (m *Mutex) RequestUpgrade(from, to LockMode) chan error {
+	return m.scheduleUpgrade(from, to, 0)
+}
+
+// SchedulePromotion is RequestUpgrade with a deadline: it asks for one of
+// the caller's holds on the Mutex in mode from to be promoted to mode to,
+// and returns straight away, while a background goroutine waits for the
+// promotion to become compatible with the lock state and makes it.  The
+// caller keeps holding from in the meantime, so it can go on with other
+// work, or schedule promotions on other Mutexes, rather than block.  The
+// promoted hold is still the caller's, as far as XHolderIDs et al are
+// concerned, not the background goroutine's.
+//
+// nil is sent on the returned channel once the promotion has been made.  If
+// it's still not possible after the timeout set by WithPromotionTimeout,
+// e.g. because of a long-lived X holder, ErrPromotionTimeout is sent
+// instead and the caller still holds from.  Any other error that
+// RequestUpgrade can report may be sent too.
+func (m *Mutex) SchedulePromotion(from, to LockMode) <-chan error {
+	timeout := m.promotionTimeout
+	if timeout == 0 {
+		timeout = defaultPromotionTimeout
+	}
+	return m.scheduleUpgrade(from, to, timeout)
+}
+
+// scheduleUpgrade is RequestUpgrade, giving up with ErrPromotionTimeout
+// once the timeout, if non-zero, has elapsed.
+func (m *Mutex) scheduleUpgrade(from, to LockMode, timeout time.Duration) chan error {
+	ret := make(chan error, 1)
+	if err := m.beforeAcquire(to); err != nil {
+		ret <- err
+		return ret
+	}
+
+	m.mtx.Lock()
+	pending, err := m.startUpgrade(from, to)
+	m.mtx.Unlock()
+	if !pending {
+		if err == nil {
+			m.released(from)
+			m.acquired(to, 0)
+		}
+		ret <- err
+		return ret
+	}
+
+	start, owner := time.Now(), goroutineID()
+	go func() {
+		ctx := context.Background()
+		if timeout != 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		err := m.finishUpgrade(ctx, owner, from, to, start)
+		if err == context.DeadlineExceeded {
+			err = ErrPromotionTimeout
+		}
+		ret <- err
+	}()
+	return ret
+}
+
+// UpgradeIStoIXBlocking trades one of the caller's IS holds on the Mutex for
+// an IX hold, waiting for that to become compatible with the lock state if
+// it isn't yet.  Like RequestUpgrade, it holds back new acquisitions that
+// would stop the upgrade from being made, including S acquisitions that were
+// already waiting, so it is guaranteed to get there once the current
+// holders release.  Returns ctx.Err() if ctx is done
+// first, in which case the caller still holds IS.
+func (m *Mutex) UpgradeIStoIXBlocking(ctx context.Context) error {
+	return m.upgrade(ctx, ModeIS, ModeIX)
+}
+
+// UpgradeIStoIXFair trades one of the caller's IS holds on the Mutex for an
+// IX hold without letting S requests overtake it: from the moment it's
+// called, new S acquisitions block, as do those already waiting, until the
+// current S holders have drained and the upgrade has been made.  This is
+// the upgrade reservation from MVCC databases, and is what
+// UpgradeIStoIXBlocking does too; UpgradeIStoIXFair is the name to use
+// where the fairness is what the caller relies on.  Returns ctx.Err(),
+// lifting the reservation, if ctx is done first, in which case the caller
+// still holds IS.
+func (m *Mutex) UpgradeIStoIXFair(ctx context.Context) error {
+	return m.UpgradeIStoIXBlocking(ctx)
+}
+
+// upgrade is the blocking equivalent of RequestUpgrade, giving up if ctx is
+// done first.
+func (m *Mutex) upgrade(ctx context.Context, from, to LockMode) error {
+	if err := m.beforeAcquire(to); err != nil {
+		return err
+	}
+
+	m.mtx.Lock()
+	pending, err := m.startUpgrade(from, to)
+	m.mtx.Unlock()
+	if pending {
+		return m.finishUpgrade(ctx, goroutineID(), from, to, time.Now())
+	}
+	if err == nil {
+		m.released(from)
+		m.acquired(to, 0)
+	}
+	return err
+}
+
+// startUpgrade, with m.mtx held, makes the upgrade straight away if it can.
+// If the upgrade has to wait, it reserves to and returns true, after which
+// the caller must call finishUpgrade.
+func (m *Mutex) startUpgrade(from, to LockMode) (bool, error) {
+	err := m.trySwitch(from, to)
+	if err != ErrIncompatibleUpgrade {
+		return false, err
+	}
+	if m.upgradePending(to) {
+		return false, ErrUpgradeConflict
+	}
+	m.upgrades[to]++
+	atomic.AddInt32(&m.upgrading, 1)
+	return true, nil
+}
+
+// finishUpgrade waits for the upgrade reserved by startUpgrade to become
+// possible and makes it, or gives up if ctx is done first.  Either way, it
+// lifts the reservation.  The hold belongs to the goroutine whose ID is
+// owner, which needn't be the calling one: see scheduleUpgrade.
+func (m *Mutex) finishUpgrade(ctx context.Context, owner int64, from, to LockMode, start time.Time) error {
+	m.mtx.Lock()
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go m.broadcastOnDone(done, stop)
+	}
+
+	var err error
+	for {
+		if err = m.trySwitch(from, to); err != ErrIncompatibleUpgrade {
+			break
+		}
+		if m.isShutdown() {
+			err = ErrShutdown
+			break
+		}
+		if err = ctx.Err(); err != nil {
+			break
+		}
+		m.c.Wait()
+	}
+
+	m.upgrades[to]--
+	atomic.AddInt32(&m.upgrading, -1)
+	if err != nil {
+		// Arrivals we were holding back may now proceed.  (On success,
+		// trySwitch has already woken them.)
+		m.broadcast()
+	}
+	m.mtx.Unlock()
+
+	if err != nil {
+		m.runDueCallbacks()
+		return err
+	}
+	// The bookkeeping is attributed to the calling goroutine, so lend it
+	// the old hold, and hand the new one back to the owner afterwards.
+	if self := goroutineID(); self != owner {
+		m.owners.move(from, owner, self)
+		defer m.owners.move(to, self, owner)
+	}
+	waited := time.Since(start)
+	m.waited(to, waited)
+	m.released(from)
+	m.acquired(to, waited)
+	return nil
+}
+
+// upgradePending reports, with m.mtx held, whether new acquisitions in the
+// given mode have to wait for a pending upgrade to a mode incompatible with
+// it.
+func (m *Mutex) upgradePending(mode LockMode) bool {
+	if atomic.LoadInt32(&m.upgrading) == 0 {
+		return false
+	}
+	for _, to := range modes {
+		if m.upgrades[to] > 0 && !Compatible(mode, to) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,198 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestUpgradeImmediate(t *testing.T) {
+	m := New()
+	m.SLock()
+	assert.NoError(t, <-m.RequestUpgrade(ModeS, ModeX), "Sole S holder should be able to upgrade to X")
+	assert.Equal(t, setX(0, 1), m.load())
+
+	assert.Equal(t, &LockUnderflowError{Mode: ModeIX}, <-m.RequestUpgrade(ModeIX, ModeX))
+	assert.Equal(t, setX(0, 1), m.load())
+}
+
+func TestRequestUpgradeWaits(t *testing.T) {
+	m := New()
+	m.IXLock()
+	m.IXLock()
+
+	upgraded := m.RequestUpgrade(ModeIX, ModeX)
+	select {
+	case err := <-upgraded:
+		t.Fatalf("Upgrade to X made alongside another IX holder: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.Equal(t, setIX(0, 2), m.load(), "Pending upgrade gave up its IX hold")
+
+	assert.NoError(t, m.IXUnlock())
+	select {
+	case err := <-upgraded:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Upgrade not made once the other IX holder left")
+	}
+	assert.Equal(t, setX(0, 1), m.load())
+}
+
+func TestRequestUpgradeHasPriority(t *testing.T) {
+	m := New()
+	m.SLock()
+	m.SLock()
+	upgraded := m.RequestUpgrade(ModeS, ModeX)
+
+	// Without the pending upgrade, S would be compatible with the lock
+	// state, but it mustn't get in ahead of the upgrade.
+	assert.False(t, m.TrySLock(), "New S holder got in ahead of a pending upgrade")
+	acquired := make(chan bool)
+	go func() {
+		m.SLock()
+		acquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, <-upgraded)
+	select {
+	case <-acquired:
+		t.Fatal("S acquired alongside the upgraded X holder")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	assert.NoError(t, m.XUnlock())
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("S waiter not woken after the upgraded X holder left")
+	}
+}
+
+func TestRequestUpgradeConflict(t *testing.T) {
+	m := New()
+	m.SLock()
+	m.SLock()
+	first := m.RequestUpgrade(ModeS, ModeX)
+
+	// Each upgrade would wait for the other's S hold to go away.
+	assert.Equal(t, ErrUpgradeConflict, <-m.RequestUpgrade(ModeS, ModeX))
+	assert.Equal(t, setS(0, 2), m.load(), "Conflicting upgrade modified the lock state")
+
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, <-first)
+	assert.Equal(t, setX(0, 1), m.load())
+}
+
+func TestUpgradeIStoIXBlocking(t *testing.T) {
+	m := New()
+	m.ISLock()
+	m.SLock()
+
+	upgraded := make(chan error)
+	go func() {
+		upgraded <- m.UpgradeIStoIXBlocking(context.Background())
+	}()
+	select {
+	case err := <-upgraded:
+		t.Fatalf("Upgrade to IX made alongside an S holder: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.False(t, m.TrySLock(), "New S holder got in ahead of a pending upgrade")
+
+	assert.NoError(t, m.SUnlock())
+	select {
+	case err := <-upgraded:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Upgrade not made once the S holder left")
+	}
+	assert.Equal(t, setIX(0, 1), m.load())
+}
+
+func TestUpgradeIStoIXBlockingCancelled(t *testing.T) {
+	m := New()
+	m.ISLock()
+	m.SLock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.UpgradeIStoIXBlocking(ctx))
+	assert.Equal(t, setS(setIS(0, 1), 1), m.load(), "Cancelled upgrade gave up IS")
+	assert.True(t, m.TrySLock(), "Cancelled upgrade is still holding back S")
+}
+
+func TestUpgradeIStoIXFair(t *testing.T) {
+	m := New()
+	m.ISLock()
+	m.SLock()
+
+	sAcquired := make(chan bool)
+	upgraded := make(chan error)
+	go func() {
+		upgraded <- m.UpgradeIStoIXFair(context.Background())
+	}()
+	time.Sleep(5 * time.Millisecond)
+	go func() {
+		m.SLock()
+		sAcquired <- true
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	assert.NoError(t, m.SUnlock())
+	select {
+	case err := <-upgraded:
+		assert.NoError(t, err)
+	case <-sAcquired:
+		t.Fatal("S waiter got in ahead of a pending upgrade")
+	case <-time.After(time.Second):
+		t.Fatal("Upgrade not made once the S holder left")
+	}
+
+	assert.NoError(t, m.IXUnlock())
+	select {
+	case <-sAcquired:
+	case <-time.After(time.Second):
+		t.Fatal("S waiter not let in after the upgrade")
+	}
+}
+
+func TestSchedulePromotion(t *testing.T) {
+	m := New()
+	m.ISLock()
+	m.IXLock()
+	promoted := m.SchedulePromotion(ModeIS, ModeS)
+	select {
+	case err := <-promoted:
+		t.Fatalf("Promotion to S made alongside an IX holder: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	assert.NoError(t, m.IXUnlock())
+	select {
+	case err := <-promoted:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Promotion not made once the IX holder left")
+	}
+	assert.Equal(t, setS(0, 1), m.load())
+}
+
+func TestSchedulePromotionTimeout(t *testing.T) {
+	m := New(WithPromotionTimeout(5 * time.Millisecond))
+	m.ISLock()
+	m.IXLock()
+	select {
+	case err := <-m.SchedulePromotion(ModeIS, ModeS):
+		assert.Equal(t, ErrPromotionTimeout, err)
+	case <-time.After(time.Second):
+		t.Fatal("Promotion didn't time out")
+	}
+	assert.Equal(t, setIX(setIS(0, 1), 1), m.load(), "Timed out promotion gave up IS")
+	assert.NoError(t, m.IXUnlock())
+	assert.True(t, m.TrySLock(), "Timed out promotion is still holding back S")
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// waitUntil blocks until pred holds for the lock state, or until ctx is
+// done, in which case it returns ctx.Err().  pred is called with m.mtx held.
+//
+// While anyone is waiting here, every change to the lock state broadcasts
+// on the condvar, including acquisitions, which otherwise don't.  An
+// acquirer registers itself and then checks m.watchers, while we bump
+// m.watchers and then check the state, so at least one of us is guaranteed
+// to see the other.
+func (m *Mutex) waitUntil(ctx context.Context, pred func(state uint64) bool) error {
+	atomic.AddInt32(&m.watchers, 1)
+	defer atomic.AddInt32(&m.watchers, -1)
+
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go m.broadcastOnDone(done, stop)
+	}
+
+	for !pred(m.load()) {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.c.Wait()
+	}
+	return nil
+}
+
+// WaitForS blocks until at least one goroutine holds the Mutex in S, or
+// until ctx is done, in which case it returns ctx.Err().  It doesn't take
+// the lock itself.  This is useful as a "ready" signal, e.g. for a
+// coordinator waiting for a replica to start reading.
+func (m *Mutex) WaitForS(ctx context.Context) error {
+	return m.waitUntil(ctx, func(state uint64) bool {
+		return extractS(state) > 0
+	})
+}
+
+// WaitForX blocks until some goroutine holds the Mutex in X, or until ctx is
+// done, in which case it returns ctx.Err().  It doesn't take the lock itself.
+func (m *Mutex) WaitForX(ctx context.Context) error {
+	return m.waitUntil(ctx, func(state uint64) bool {
+		return extractX(state) > 0
+	})
+}
+
+// WaitUntil blocks until predicate holds for the Mutex's state, or until ctx
+// is done, in which case it returns ctx.Err().  It doesn't take the lock
+// itself.  For example, to wait until at least three goroutines hold the
+// Mutex in IX:
+//
+//	m.WaitUntil(ctx, func(s LockState) bool { return s.IX > 2 })
+//
+// predicate is called with the Mutex's internal lock held, so it must not
+// call any methods on the Mutex.
+func (m *Mutex) WaitUntil(ctx context.Context, predicate func(LockState) bool) error {
+	return m.waitUntil(ctx, func(state uint64) bool {
+		return predicate(lockState(state))
+	})
+}
+
+// Broadcast wakes up every goroutine blocked on the Mutex, so that they
+// re-check whatever they're waiting for.  Use it after changing some state
+// outside the Mutex that a WaitUntil predicate depends on.  Calling it when
+// nothing has changed is harmless, but wasteful, since every waiter wakes
+// up only to go back to sleep.
+func (m *Mutex) Broadcast() {
+	m.mtx.Lock()
+	m.broadcast()
+	m.mtx.Unlock()
+	m.runDueCallbacks()
+}
@@ -0,0 +1,124 @@
+package ilock
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForS(t *testing.T) {
+	m := New()
+	errs := make(chan error)
+	go func() {
+		errs <- m.WaitForS(context.Background())
+	}()
+
+	// Neither of these should count.
+	m.ISLock()
+	m.ISUnlock()
+	m.XLock()
+	m.XUnlock()
+	select {
+	case <-errs:
+		t.Fatal("WaitForS returned before anyone took S")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// The S fast path doesn't go near m.mtx, but has to wake us up anyway.
+	m.SLock()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForS never noticed the S holder")
+	}
+	assert.NoError(t, m.WaitForS(context.Background()), "S is already held")
+	m.SUnlock()
+}
+
+func TestWaitForX(t *testing.T) {
+	m := New()
+	errs := make(chan error)
+	go func() {
+		errs <- m.WaitForX(context.Background())
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	m.XLock()
+	select {
+	case err := <-errs:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitForX never noticed the X holder")
+	}
+	m.XUnlock()
+}
+
+func TestWaitForCancelled(t *testing.T) {
+	m := New()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.WaitForX(ctx))
+}
+
+func TestWaitUntil(t *testing.T) {
+	m := New()
+
+	done := make(chan error)
+	go func() {
+		done <- m.WaitUntil(context.Background(), func(s LockState) bool { return s.IX > 2 })
+	}()
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+			t.Fatalf("WaitUntil returned with %d IX holders", i)
+		case <-time.After(5 * time.Millisecond):
+		}
+		m.IXLock()
+	}
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("WaitUntil never returned")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, m.WaitUntil(ctx, func(s LockState) bool { return s.X > 0 }))
+}
+
+func TestBroadcast(t *testing.T) {
+	m := New()
+
+	var flag int32
+	done := make(chan error)
+	go func() {
+		done <- m.WaitUntil(context.Background(), func(LockState) bool {
+			return atomic.LoadInt32(&flag) != 0
+		})
+	}()
+	time.Sleep(5 * time.Millisecond)
+
+	// A spurious wakeup doesn't satisfy the predicate...
+	m.Broadcast()
+	select {
+	case <-done:
+		t.Fatal("WaitUntil returned before the flag was set")
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	// ...but once the flag's set, it's noticed.
+	atomic.StoreInt32(&flag, 1)
+	m.Broadcast()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Broadcast didn't wake up WaitUntil")
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// ISLockWait is ISLock, reporting whether the caller had to block for the
+// lock, rather than getting it straight away.  That's a cheap contention
+// signal, for callers that want to count contended acquisitions without the
+// overhead of WithStats:
+//
+//	if m.XLockWait() {
+//		contention.Inc()
+//	}
+func (m *Mutex) ISLockWait() bool {
+	return m.mustAcquireWaited(ModeIS)
+}
+
+// IXLockWait is IXLock, reporting whether the caller had to block; see
+// ISLockWait.
+func (m *Mutex) IXLockWait() bool {
+	return m.mustAcquireWaited(ModeIX)
+}
+
+// SLockWait is SLock, reporting whether the caller had to block; see
+// ISLockWait.
+func (m *Mutex) SLockWait() bool {
+	return m.mustAcquireWaited(ModeS)
+}
+
+// XLockWait is XLock, reporting whether the caller had to block; see
+// ISLockWait.
+func (m *Mutex) XLockWait() bool {
+	return m.mustAcquireWaited(ModeX)
+}
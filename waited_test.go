@@ -0,0 +1,37 @@
+package ilock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockWait(t *testing.T) {
+	m := New()
+	assert.False(t, m.ISLockWait())
+	assert.False(t, m.IXLockWait())
+	assert.NoError(t, m.IXUnlock())
+	assert.False(t, m.SLockWait())
+
+	waited := make(chan bool)
+	go func() {
+		waited <- m.XLockWait()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, m.SUnlock())
+	assert.NoError(t, m.ISUnlock())
+	select {
+	case w := <-waited:
+		assert.True(t, w, "XLockWait didn't report blocking behind S and IS")
+	case <-time.After(time.Second):
+		t.Fatal("X waiter never got the lock")
+	}
+
+	go func() {
+		waited <- m.SLockWait()
+	}()
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, m.XUnlock())
+	assert.True(t, <-waited, "SLockWait didn't report blocking behind X")
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"context"
+	"sync"
+)
+
+// MutexWaitGroup holds a Mutex on behalf of a group of goroutines that don't
+// take and release it in matched pairs, e.g. a dispatcher that takes IS for
+// each job it hands out and workers that each release one when they're
+// done.  Like a sync.WaitGroup, Add increases the count of outstanding
+// holds, Done decreases it, and Wait blocks until it is zero; unlike one,
+// every count is a real hold on the Mutex, so e.g. Add(1, ModeX) blocks
+// while the Mutex is held in any other mode.
+type MutexWaitGroup struct {
+	m *Mutex
+
+	mtx    sync.Mutex
+	counts [4]int        // Outstanding holds, by LockMode
+	total  int           // The sum of counts
+	idle   chan struct{} // Closed once total drops back to zero
+}
+
+// NewMutexWaitGroup returns a MutexWaitGroup for m, with no holds
+// outstanding.
+func NewMutexWaitGroup(m *Mutex) *MutexWaitGroup {
+	return &MutexWaitGroup{m: m}
+}
+
+// Add takes the Mutex in the given mode n times, blocking as the Mutex's
+// XLock or SLock etc would.  As with sync.WaitGroup, calls that start from a
+// count of zero have to happen before Wait.
+func (wg *MutexWaitGroup) Add(n int, mode LockMode) {
+	for i := 0; i < n; i++ {
+		wg.m.Lock(mode)
+
+		wg.mtx.Lock()
+		if wg.total == 0 {
+			wg.idle = make(chan struct{})
+		}
+		wg.counts[mode]++
+		wg.total++
+		wg.mtx.Unlock()
+	}
+}
+
+// Done releases one of the holds in the given mode taken by Add.  It panics
+// if there are none left.
+func (wg *MutexWaitGroup) Done(mode LockMode) {
+	wg.mtx.Lock()
+	defer wg.mtx.Unlock()
+	if !mode.valid() || wg.counts[mode] == 0 {
+		panic("ilock: negative MutexWaitGroup counter")
+	}
+	if err := wg.m.Unlock(mode); err != nil {
+		panic(err)
+	}
+	wg.counts[mode]--
+	wg.total--
+	if wg.total == 0 {
+		close(wg.idle)
+	}
+}
+
+// Wait blocks until every hold taken by Add has been released by Done, or
+// until ctx is done, in which case it returns ctx.Err().
+func (wg *MutexWaitGroup) Wait(ctx context.Context) error {
+	wg.mtx.Lock()
+	idle := wg.idle
+	total := wg.total
+	wg.mtx.Unlock()
+	if total == 0 {
+		return nil
+	}
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,68 @@
+package ilock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutexWaitGroup(t *testing.T) {
+	m := New()
+	wg := NewMutexWaitGroup(m)
+	assert.NoError(t, wg.Wait(context.Background()), "Wait blocked on an empty group")
+
+	wg.Add(3, ModeIS)
+	wg.Add(1, ModeIX)
+	assert.Equal(t, setIX(setIS(0, 3), 1), m.load())
+
+	waited := make(chan error)
+	go func() {
+		waited <- wg.Wait(context.Background())
+	}()
+	for i := 0; i < 3; i++ {
+		go wg.Done(ModeIS)
+	}
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait returned with IX still held: %v", err)
+	case <-time.After(5 * time.Millisecond):
+	}
+
+	wg.Done(ModeIX)
+	select {
+	case err := <-waited:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Wait didn't return once every hold was released")
+	}
+	assert.Equal(t, uint64(0), m.load())
+
+	assert.PanicsWithValue(t, "ilock: negative MutexWaitGroup counter", func() { wg.Done(ModeS) })
+}
+
+func TestMutexWaitGroupRespectsCompatibility(t *testing.T) {
+	m := New()
+	m.SLock()
+	wg := NewMutexWaitGroup(m)
+
+	added := make(chan bool)
+	go func() {
+		wg.Add(1, ModeX)
+		added <- true
+	}()
+	select {
+	case <-added:
+		t.Fatal("Add(1, ModeX) didn't block on an S holder")
+	case <-time.After(5 * time.Millisecond):
+	}
+	assert.NoError(t, m.SUnlock())
+	<-added
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, wg.Wait(ctx))
+	wg.Done(ModeX)
+	assert.NoError(t, wg.Wait(context.Background()))
+}
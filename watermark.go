@@ -0,0 +1,64 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// WithHighWatermark arranges for handler to be called when the number of
+// holders in any mode goes above frac of the 65535 that its 16-bit count can
+// hold, so that a pathologically concurrent system hears about it well
+// before the count overflows.  The handler is passed the mode and the count
+// that crossed the watermark, and is called once per crossing, not on every
+// acquisition above it: it is called again only once the count has dropped
+// back to the watermark and then gone over it again.
+//
+// As with WithStarvationThreshold, the handler runs in its own goroutine and
+// must not call any methods on the Mutex that it could block on.  It's up to
+// the handler to shed load, e.g. by refusing new readers further up the
+// stack.
+//
+// WithHighWatermark panics if frac isn't in (0, 1].
+func WithHighWatermark(frac float64, handler func(m *Mutex, mode LockMode, count uint16)) Option {
+	if !(frac > 0 && frac <= 1) {
+		panic(fmt.Sprintf("ilock: high watermark %v out of range", frac))
+	}
+	return func(m *Mutex) {
+		m.watermark = uint64(frac * maxHolders)
+		m.watermarkHandler = handler
+	}
+}
+
+// checkWatermark is called after every acquisition and release in the given
+// mode, to tell the watermark handler about the count crossing the watermark
+// and re-arm it once the count is back under.
+func (m *Mutex) checkWatermark(mode LockMode) {
+	n := extractMode(mode, m.load())
+	if n <= m.watermark {
+		atomic.CompareAndSwapInt32(&m.watermarkCrossed[mode], 1, 0)
+		return
+	}
+	if atomic.CompareAndSwapInt32(&m.watermarkCrossed[mode], 0, 1) {
+		go m.watermarkHandler(m, mode, uint16(n))
+	}
+}
@@ -0,0 +1,70 @@
+package ilock
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type watermarkCrossing struct {
+	mode  LockMode
+	count uint16
+}
+
+func TestHighWatermark(t *testing.T) {
+	crossings := make(chan watermarkCrossing, 10)
+	m := New(WithHighWatermark(2.5/maxHolders, func(m *Mutex, mode LockMode, count uint16) {
+		crossings <- watermarkCrossing{mode, count}
+	}))
+	expect := func(want watermarkCrossing) {
+		select {
+		case got := <-crossings:
+			assert.Equal(t, want, got)
+		case <-time.After(time.Second):
+			t.Fatalf("Handler wasn't called for %v", want)
+		}
+	}
+	expectNone := func() {
+		select {
+		case got := <-crossings:
+			t.Errorf("Unexpected crossing %v", got)
+		case <-time.After(5 * time.Millisecond):
+		}
+	}
+
+	m.ISLock()
+	m.ISLock()
+	expectNone()
+	m.ISLock()
+	expect(watermarkCrossing{ModeIS, 3})
+
+	// Staying above the watermark doesn't call the handler again...
+	m.ISLock()
+	assert.NoError(t, m.ISUnlock())
+	expectNone()
+
+	// ...but dropping back to it and going over again does.
+	assert.NoError(t, m.ISUnlock())
+	m.ISLock()
+	expect(watermarkCrossing{ModeIS, 3})
+
+	for i := 0; i < 3; i++ {
+		m.IXLock()
+	}
+	expect(watermarkCrossing{ModeIX, 3})
+}
+
+func TestHighWatermarkRange(t *testing.T) {
+	nop := func(m *Mutex, mode LockMode, count uint16) {}
+	for _, frac := range []float64{0, -0.5, 1.5, math.NaN(), math.Inf(1)} {
+		assert.Panics(t, func() { WithHighWatermark(frac, nop) }, "frac %v accepted", frac)
+	}
+
+	// At 1, the handler can never be called, as no count can exceed the
+	// maximum; just above 0, it's called as soon as the Mutex is taken.
+	assert.NotPanics(t, func() { WithHighWatermark(1, nop) })
+	assert.Equal(t, uint64(maxHolders), New(WithHighWatermark(1, nop)).watermark)
+	assert.Equal(t, uint64(0), New(WithHighWatermark(math.SmallestNonzeroFloat64, nop)).watermark)
+}
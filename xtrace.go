@@ -0,0 +1,41 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+package ilock
+
+// WithXTracing has every XLock capture the stack of the goroutine that took
+// the lock, so that if some other goroutine is stuck waiting for it (say,
+// its XLockCtx times out) it can find out who is holding it with
+// XHolderStack.
+//
+// Capturing stacks is expensive, so this is only available in builds with
+// the ilock_debug build tag; otherwise it is a no-op and costs nothing.
+func WithXTracing(enabled bool) Option {
+	return func(m *Mutex) {
+		m.xTrace.enable(enabled)
+	}
+}
+
+// XHolderStack returns the stack trace of the goroutine that currently holds
+// the Mutex in X, or the empty string if it isn't held in X or the Mutex
+// wasn't created with WithXTracing in an ilock_debug build.
+func (m *Mutex) XHolderStack() string {
+	return m.xTrace.stack()
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 Nathan Taylor (nbtaylor@gmail.com)
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy of
+// this software and associated documentation files (the "Software"), to deal in
+// the Software without restriction, including without limitation the rights to
+// use, copy, modify, merge, publish, distribute, sublicense, and/or sell copies
+// of the Software, and to permit persons to whom the Software is furnished to do
+// so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build ilock_debug
+// +build ilock_debug
+
+package ilock
+
+import (
+	"runtime"
+	"sync"
+)
+
+const xTraceBufSize = 4096
+
+// xTracer remembers the stack of the goroutine that last took the Mutex in
+// X.
+type xTracer struct {
+	enabled bool
+
+	mtx   sync.Mutex
+	trace string
+}
+
+func (t *xTracer) enable(enabled bool) {
+	t.enabled = enabled
+}
+
+func (t *xTracer) record() {
+	if !t.enabled {
+		return
+	}
+	buf := make([]byte, xTraceBufSize)
+	buf = buf[:runtime.Stack(buf, false)]
+
+	t.mtx.Lock()
+	t.trace = string(buf)
+	t.mtx.Unlock()
+}
+
+func (t *xTracer) clear() {
+	if !t.enabled {
+		return
+	}
+	t.mtx.Lock()
+	t.trace = ""
+	t.mtx.Unlock()
+}
+
+func (t *xTracer) stack() string {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.trace
+}
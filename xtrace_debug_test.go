@@ -0,0 +1,44 @@
+//go:build ilock_debug
+// +build ilock_debug
+
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXTracing(t *testing.T) {
+	m := New(WithXTracing(true))
+	assert.Equal(t, "", m.XHolderStack())
+
+	m.XLock()
+	assert.Contains(t, m.XHolderStack(), "TestXTracing")
+	m.XUnlock()
+	assert.Equal(t, "", m.XHolderStack())
+
+	m.SLock()
+	assert.Equal(t, "", m.XHolderStack())
+	m.SUnlock()
+}
+
+func TestXTracingForceUnlock(t *testing.T) {
+	quietLog(t)
+
+	m := New(WithXTracing(true))
+	m.XLock()
+	m.ForceUnlock(ModeX)
+	assert.Equal(t, "", m.XHolderStack(), "Forced-out holder's stack still reported")
+
+	m.XLock()
+	m.ForceUnlockAll()
+	assert.Equal(t, "", m.XHolderStack(), "Forced-out holder's stack still reported")
+}
+
+func TestXTracingOff(t *testing.T) {
+	m := New()
+	m.XLock()
+	assert.Equal(t, "", m.XHolderStack())
+	m.XUnlock()
+}
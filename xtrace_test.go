@@ -0,0 +1,17 @@
+//go:build !ilock_debug
+// +build !ilock_debug
+
+package ilock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestXTracingDisabled(t *testing.T) {
+	m := New(WithXTracing(true))
+	m.XLock()
+	assert.Equal(t, "", m.XHolderStack(), "X tracing should be compiled out")
+	m.XUnlock()
+}